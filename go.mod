@@ -11,6 +11,7 @@ require (
 	github.com/wirenboard/go-duktape v0.0.0-20240729075045-b4150233e350
 	github.com/wirenboard/wbgong v0.7.3
 	go.etcd.io/bbolt v1.3.9
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -19,5 +20,10 @@ require (
 	github.com/valyala/fastrand v1.1.0 // indirect
 	github.com/valyala/histogram v1.2.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// go-duktape with the execution timeout check enabled, see
+// third_party/go-duktape/duk_go_interrupt.c. To be dropped together
+// with third_party/go-duktape after the patch is released in
+// github.com/wirenboard/go-duktape and the version above is bumped
+replace github.com/wirenboard/go-duktape => ./third_party/go-duktape
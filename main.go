@@ -10,6 +10,7 @@ import (
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/wirenboard/wb-rules/wbrules"
@@ -28,6 +29,7 @@ const (
 	PERSISTENT_DB_FILE      = "/var/lib/wirenboard/wbrules-persistent.db"
 	VIRTUAL_DEVICES_DB_FILE = "/var/lib/wirenboard/wbrules-vdev.db"
 	WBGO_FILE               = "/usr/lib/wb-rules/wbgo.so"
+	CONFIG_FILE             = "/etc/wb-rules.conf"
 
 	WBRULES_MODULES_ENV = "WB_RULES_MODULES"
 
@@ -48,20 +50,42 @@ func main() {
 		fmt.Println(version)
 		os.Exit(0)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "simulate" {
+		simulate(os.Args[2:])
+		return
+	}
 
 	var err error
 
 	brokerAddress := flag.String("broker", DEFAULT_BROKER_URL, "MQTT broker url")
+	configFile := flag.String("config", CONFIG_FILE, "Configuration file (ignored if the default one doesn't exist)")
 	editDir := flag.String("editdir", "", "Editable script directory")
+	rpcWrite := flag.Bool("rpc-write", false, "Allow RPC methods which modify persistent storages and log levels or replay events")
 	debug := flag.Bool("debug", false, "Enable debugging")
 	noQueues := flag.Bool("debug-queues", false, "Don't use queues in wbgo driver (debugging)")
 	useSyslog := flag.Bool("syslog", false, "Use syslog for logging")
 	mqttDebug := flag.Bool("mqttdebug", false, "Enable MQTT debugging")
 	precise := flag.Bool("precise", false, "Don't reown devices without driver")
 	cleanup := flag.Bool("cleanup", false, "Clean up MQTT data on unload")
+	jsonLog := flag.Bool("json-log", false, "Also publish rule log messages as JSON records to /wbrules/log/json")
+	logRingCapacity := flag.Int("log-ring", wbrules.LOG_RING_DEFAULT_CAPACITY, "Number of rule log messages kept for Log/Query RPC (0 disables)")
+	logRingFile := flag.String("log-ring-file", "", "File to keep rule log messages for Log/Query RPC across restarts")
 	httpAddr := flag.String("http", "", "Serve metrics and runtime profiling data")
+	traceCapacity := flag.Int("trace", wbrules.RULE_TRACE_CAPACITY, "Number of execution trace entries kept for every rule (0 disables tracing)")
+	location := flag.String("location", "", "Default location for sun() schedules as latitude,longitude")
+	journalFile := flag.String("journal", "", "Control change event journal file (empty disables the journal)")
+	journalSize := flag.Int64("journal-size", wbrules.EVENT_JOURNAL_DEFAULT_SIZE, "Event journal file size limit in bytes")
+	journalFiles := flag.Int("journal-files", wbrules.EVENT_JOURNAL_DEFAULT_FILES, "Number of rotated event journal files to keep")
+	eventBufferCapacity := flag.Int("event-buffer", wbrules.EVENT_BUFFER_DEFAULT_CAPACITY, "Maximum number of control change events waiting for the rules (0 means no limit)")
+	eventOverflow := flag.String("event-overflow", wbrules.EVENT_OVERFLOW_DROP_OLDEST.String(), "Events to drop when the event buffer is full: drop-oldest or drop-newest")
+	eventCoalesce := flag.Bool("event-coalesce", false, "Keep only the latest pending change event of every control")
+	callbackTimeout := flag.Duration("callback-timeout", 0, "Execution time budget of JS callbacks, e.g. 5s (0 disables the watchdog)")
+	callbackViolations := flag.Int("callback-violations", 0, "Disable a rule after its callbacks exceed the time budget this many times (0 never disables rules)")
+	quarantineErrors := flag.Int("quarantine-errors", 0, "Unload a script after this many runtime errors within the quarantine window (0 disables quarantine)")
+	quarantineWindow := flag.Duration("quarantine-window", time.Minute, "Time window for counting runtime errors of a script")
 
 	persistentDbFile := flag.String("pdb", PERSISTENT_DB_FILE, "Persistent storage DB file")
+	storageSweep := flag.Duration("storage-sweep", time.Hour, "Interval of removing expired persistent storage keys (0 disables the sweeper)")
 	vdevDbFile := flag.String("vdb", VIRTUAL_DEVICES_DB_FILE, "Virtual devices values DB file")
 
 	wbgoso := flag.String("wbgo", WBGO_FILE, "Location to wbgo.so file")
@@ -142,8 +166,50 @@ func main() {
 
 	engineOptions := wbrules.NewESEngineOptions()
 	engineOptions.SetPersistentDBFile(*persistentDbFile)
+	engineOptions.SetStorageSweepInterval(*storageSweep)
 	engineOptions.SetModulesDirs(strings.Split(os.Getenv(WBRULES_MODULES_ENV), ":"))
 	engineOptions.SetCleanupOnStop(*cleanup)
+	engineOptions.SetTraceCapacity(*traceCapacity)
+	overflowPolicy, err := wbrules.ParseEventOverflowPolicy(*eventOverflow)
+	if err != nil {
+		wbgong.Error.Fatalf("invalid -event-overflow: %v", err)
+	}
+	engineOptions.SetEventBufferCapacity(*eventBufferCapacity, overflowPolicy)
+	engineOptions.SetEventCoalescing(*eventCoalesce)
+	engineOptions.SetCallbackWatchdog(*callbackTimeout, *callbackViolations)
+	engineOptions.SetScriptQuarantine(*quarantineErrors, *quarantineWindow)
+	engineOptions.SetJSONLog(*jsonLog)
+	config, err := wbrules.LoadConfig(*configFile)
+	switch {
+	case os.IsNotExist(err) && *configFile == CONFIG_FILE:
+		config = &wbrules.Config{}
+	case err != nil:
+		wbgong.Error.Fatalf("error loading config: %v", err)
+	}
+	logSinks, err := config.Log.NewLogSinks()
+	if err != nil {
+		wbgong.Error.Fatalf("error creating log sinks: %v", err)
+	}
+	if logSinks != nil {
+		logSinks.Start()
+		defer logSinks.Close()
+		engineOptions.SetLogSinks(logSinks)
+	}
+	if *logRingCapacity > 0 {
+		logRing, err := wbrules.NewLogRing(*logRingCapacity, *logRingFile)
+		if err != nil {
+			wbgong.Error.Fatalf("error opening log ring: %v", err)
+		}
+		defer logRing.Close()
+		engineOptions.SetLogRing(logRing)
+	}
+	if *location != "" {
+		loc, err := wbrules.ParseGeoLocation(*location)
+		if err != nil {
+			wbgong.Error.Fatalf("invalid -location: %v", err)
+		}
+		engineOptions.SetLocation(loc)
+	}
 
 	if *noQueues {
 		engineOptions.SetTesting(true)
@@ -154,6 +220,14 @@ func main() {
 	if err != nil {
 		wbgong.Error.Fatalf("error creating engine: %v", err)
 	}
+	if *journalFile != "" {
+		journal, err := wbrules.NewEventJournal(*journalFile, *journalSize, *journalFiles)
+		if err != nil {
+			wbgong.Error.Fatalf("error opening event journal: %v", err)
+		}
+		defer journal.Close()
+		engine.SetEventJournal(journal)
+	}
 	engine.Start()
 	defer engine.Stop()
 
@@ -177,15 +251,27 @@ func main() {
 	}
 	wbgong.Info.Println("all rule files are loaded")
 
+	rpc := wbgong.NewMQTTRPCServer(RPC_DRIVER_NAME, engineMqttClient)
 	if *editDir != "" {
-		rpc := wbgong.NewMQTTRPCServer(RPC_DRIVER_NAME, engineMqttClient)
 		err := rpc.Register(wbrules.NewEditor(engine))
 		if err != nil {
 			wbgong.Error.Fatalf("error registering editor: %v", err)
 		}
-		rpc.Start()
-		defer rpc.Stop()
 	}
+	if err := rpc.Register(wbrules.NewRules(engine, *rpcWrite)); err != nil {
+		wbgong.Error.Fatalf("error registering rules service: %v", err)
+	}
+	if err := rpc.Register(wbrules.NewLog(engine, *rpcWrite)); err != nil {
+		wbgong.Error.Fatalf("error registering log service: %v", err)
+	}
+	if err := rpc.Register(wbrules.NewStorage(engine, *rpcWrite)); err != nil {
+		wbgong.Error.Fatalf("error registering storage service: %v", err)
+	}
+	if err := rpc.Register(wbrules.NewHistory(engine)); err != nil {
+		wbgong.Error.Fatalf("error registering history service: %v", err)
+	}
+	rpc.Start()
+	defer rpc.Stop()
 
 	// wait for quit signal
 	<-exitCh
@@ -38,11 +38,31 @@ var _WbRules = {
   timers: {},
   aliases: {},
 
-  CronEntry: function (spec) {
+  CronEntry: function (spec, options) {
     if (typeof spec != 'string') throw new Error('invalid cron spec');
+    if (options !== undefined && (typeof options != 'object' || options === null))
+      throw new Error('invalid cron options');
+    if (options && options.hasOwnProperty('tz')) {
+      if (typeof options.tz != 'string' || !options.tz)
+        throw new Error('invalid cron time zone');
+      if (/^(CRON_)?TZ=/.test(spec)) throw new Error('cron time zone is specified twice');
+      spec = 'CRON_TZ=' + options.tz + ' ' + spec;
+    }
     this.spec = spec;
   },
 
+  SunEntry: function (event, options) {
+    if (typeof event != 'string') throw new Error('invalid sun event');
+    if (options !== undefined && (typeof options != 'object' || options === null))
+      throw new Error('invalid sun schedule options');
+    this.spec = { event: event };
+    if (options) {
+      ['offset', 'lat', 'lon'].forEach(function (k) {
+        if (options.hasOwnProperty(k)) this.spec[k] = options[k];
+      }, this);
+    }
+  },
+
   IncompleteCellCaught: (function () {
     function IncompleteCellCaught(cellName) {
       this.name = 'IncompleteCellCaught';
@@ -212,12 +232,21 @@ var _WbRules = {
       delete def.when;
     }
 
+    // when: sun('...', {...}) is converted to _sun: {...}
+    if (def.hasOwnProperty('when') && def.when instanceof _WbRules.SunEntry) {
+      def._sun = def.when.spec;
+      delete def.when;
+    }
+
     Object.keys(def).forEach(function (k) {
       var orig = d[k];
       switch (k) {
         case 'readonly':
           d[k] = !!d[k]; // avoid type cast error on the Go side
           break;
+        case 'hysteresis':
+          if (typeof orig != 'function') throw new Error('hysteresis: function expected');
+        // fallthrough
         case 'asSoonAs':
         case 'when':
           d[k] = wrapConditionFunc(orig, false);
@@ -350,8 +379,12 @@ function runShellCommand(cmd, options) {
 
 var defineAlias = _WbRules.defineAlias;
 
-function cron(spec) {
-  return new _WbRules.CronEntry(spec);
+function cron(spec, options) {
+  return new _WbRules.CronEntry(spec, options);
+}
+
+function sun(event, options) {
+  return new _WbRules.SunEntry(event, options);
 }
 
 global.StorableObject = function (obj, ps, pskey) {
@@ -430,10 +463,83 @@ global.StorableObject = function (obj, ps, pskey) {
 };
 
 global.PersistentStorage = function (name, options) {
+  var bucket = _wbPersistentName(name, options);
+
+  // checks the value to be written and subscribes the storage
+  // to the changes of StorableObject
+  var prepare = function (key, value) {
+    // typeof null is 'object', so check for null separately
+    if (value !== null) {
+      // check if this value is an object without StorableObject's prototype
+      if (typeof value === 'object' && value._ps === undefined) {
+        throw new Error(
+          "don't write pure objects to PersistentStorage, use new StorableObject(obj) instead"
+        );
+      } else if (typeof value === 'object') {
+        // check if this storage is not a listener for the object
+
+        var len = value._ps.length;
+        var found = false;
+        for (var i = 0; i < len; i++) {
+          if (value._ps[i].p == p && value._ps[i].k == key) {
+            found = true;
+            break;
+          }
+        }
+        if (!found) {
+          value._ps.push({
+            s: p,
+            k: key,
+          });
+        }
+      }
+    }
+  };
+
+  // storage methods are called via PersistentStorage.keys(ps) etc.,
+  // so they don't hide the keys with the same names
+  var methods = {
+    transaction: function (fn) {
+      return _wbPersistentTx(function () {
+        return fn(p);
+      });
+    },
+    keys: function () {
+      return _wbPersistentKeys(bucket);
+    },
+    has: function (key) {
+      return _wbPersistentHas(bucket, String(key));
+    },
+    clear: function () {
+      _wbPersistentClear(bucket);
+    },
+    // options: { ttl: duration } makes the key expire after
+    // the duration given in milliseconds or as a string like "7d",
+    // writes without ttl keep the expiration time and { ttl: 0 } removes it
+    set: function (key, value, options) {
+      key = String(key);
+      prepare(key, value);
+      _wbPersistentSet(bucket, key, value, options);
+    },
+    // callback is called as callback(newValue, oldValue, key) after the key
+    // is changed by any script, removed values are passed as undefined
+    onChange: function (key, callback) {
+      _wbPersistentOnChange(bucket, String(key), function (change) {
+        var parse = function (value) {
+          return value === undefined ? undefined : JSON.parse(value);
+        };
+        callback(parse(change.value), parse(change.oldValue), change.key);
+      });
+    },
+  };
+
   var p = new Proxy(
-    { name: _wbPersistentName(name, options), _psself: null },
+    { name: bucket, _psself: null },
     {
       get: function (o, key) {
+        if (key === '_psapi') {
+          return methods;
+        }
         var val = _wbPersistentGet(o.name, key);
         if (typeof val === 'object') {
           val = new StorableObject(val, o._psself, key);
@@ -446,33 +552,12 @@ global.PersistentStorage = function (name, options) {
           return true;
         }
 
-        // typeof null is 'object', so check for null separately
-        if (value !== null) {
-          // check if this value is an object without StorableObject's prototype
-          if (typeof value === 'object' && value._ps === undefined) {
-            throw new Error(
-              "don't write pure objects to PersistentStorage, use new StorableObject(obj) instead"
-            );
-          } else if (typeof value === 'object') {
-            // check if this storage is not a listener for the object
-
-            var len = value._ps.length;
-            var found = false;
-            for (var i = 0; i < len; i++) {
-              if (value._ps[i].p == o._psself && value._ps[i].k == key) {
-                found = true;
-                break;
-              }
-            }
-            if (!found) {
-              value._ps.push({
-                s: o._psself,
-                k: key,
-              });
-            }
-          }
+        if (key === '_psapi') {
+          throw new Error("can't write reserved PersistentStorage key '" + key + "'");
         }
 
+        prepare(key, value);
+
         return _wbPersistentSet(o.name, key, value);
       },
     }
@@ -483,6 +568,78 @@ global.PersistentStorage = function (name, options) {
   return p;
 };
 
+var _wbPersistentMethods = function (ps) {
+  var methods = ps !== null && typeof ps === 'object' ? ps._psapi : undefined;
+  if (typeof methods !== 'object') {
+    throw new Error('PersistentStorage expected');
+  }
+  return methods;
+};
+
+PersistentStorage.transaction = function (ps, fn) {
+  return _wbPersistentMethods(ps).transaction(fn);
+};
+
+PersistentStorage.keys = function (ps) {
+  return _wbPersistentMethods(ps).keys();
+};
+
+PersistentStorage.has = function (ps, key) {
+  return _wbPersistentMethods(ps).has(key);
+};
+
+PersistentStorage.clear = function (ps) {
+  _wbPersistentMethods(ps).clear();
+};
+
+PersistentStorage.set = function (ps, key, value, options) {
+  _wbPersistentMethods(ps).set(key, value, options);
+};
+
+PersistentStorage.onChange = function (ps, key, callback) {
+  _wbPersistentMethods(ps).onChange(key, callback);
+};
+
+global.defineVirtualDeviceTemplate = function (name, descr) {
+  if (typeof name != 'string' || typeof descr != 'object')
+    throw new Error('invalid virtual device template definition');
+
+  // rules are made per instance by the functions
+  // which take the device object and its id
+  var rules = descr.rules || {};
+  var d = {};
+  Object.keys(descr).forEach(function (k) {
+    if (k != 'rules') d[k] = descr[k];
+  });
+  Object.keys(rules).forEach(function (k) {
+    if (typeof rules[k] != 'function')
+      throw new Error('template rule ' + k + ': function expected');
+  });
+  _wbDefineVdevTemplate(name, d);
+
+  return {
+    name: name,
+    rules: rules,
+    instantiate: function (id, overrides) {
+      return instantiate(this, id, overrides);
+    },
+  };
+};
+
+global.instantiate = function (template, id, overrides) {
+  var device;
+  _wbInstantiateVdev(template.name, id, overrides || {}, function () {
+    device = getDevice(id);
+    Object.keys(template.rules).forEach(function (name) {
+      defineRule(id + '_' + name, template.rules[name](device, id));
+    });
+  });
+  device.remove = function () {
+    _wbRemoveVdevInstance(id);
+  };
+  return device;
+};
+
 __wbVdevPrototype.getCellValue = function (cell) {
   return dev[this.getCellId(cell)];
 };
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wirenboard/wb-rules/wbrules"
+	"github.com/wirenboard/wbgong"
+)
+
+// simulate runs rule scripts against an event script in virtual
+// time without connecting to MQTT broker:
+//
+//	wb-rules simulate -events events.yaml rules/
+func simulate(args []string) {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	eventsFile := flags.String("events", "", "Event script file (YAML or JSON)")
+	debug := flags.Bool("debug", false, "Enable debugging")
+	persistentDbFile := flags.String("pdb", "", "Persistent storage DB file (temporary file is used by default)")
+	wbgoso := flags.String("wbgo", WBGO_FILE, "Location to wbgo.so file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s simulate -events FILE [options] script|dir...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *eventsFile == "" || flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *debug {
+		wbgong.SetDebuggingEnabled(true)
+	}
+
+	// cleanup is deferred in runSimulate, so exit only after it returns
+	if err := runSimulate(*eventsFile, *persistentDbFile, *wbgoso, flags.Args()); err != nil {
+		wbgong.Error.Fatal(err)
+	}
+}
+
+func runSimulate(eventsFile, persistentDbFile, wbgoso string, paths []string) error {
+	script, err := wbrules.LoadSimScript(eventsFile)
+	if err != nil {
+		return fmt.Errorf("error loading event script: %v", err)
+	}
+	start, err := script.StartTime()
+	if err != nil {
+		return err
+	}
+
+	if err := wbgong.Init(wbgoso); err != nil {
+		return fmt.Errorf("ERROR in init wbgo.so: '%s'", err)
+	}
+
+	if persistentDbFile == "" {
+		tmpDir, err := os.MkdirTemp("", "wbrules-simulate")
+		if err != nil {
+			return fmt.Errorf("can't create temp directory: %v", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		persistentDbFile = filepath.Join(tmpDir, "persistent.db")
+	}
+
+	engineOptions := wbrules.NewESEngineOptions()
+	engineOptions.SetPersistentDBFile(persistentDbFile)
+	engineOptions.SetModulesDirs(strings.Split(os.Getenv(WBRULES_MODULES_ENV), ":"))
+
+	sim, err := wbrules.NewSimulator(os.Stdout, start, engineOptions)
+	if err != nil {
+		return err
+	}
+	defer sim.Stop()
+
+	if err := sim.LoadScripts(paths); err != nil {
+		return fmt.Errorf("error loading scripts: %v", err)
+	}
+	if err := sim.Run(script); err != nil {
+		return fmt.Errorf("simulation failed: %v", err)
+	}
+	return nil
+}
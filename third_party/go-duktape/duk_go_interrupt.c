@@ -0,0 +1,12 @@
+#include "duktape.h"
+
+/* Execution timeout check for DUK_USE_EXEC_TIMEOUT_CHECK.  The heap
+ * udata is either NULL or points to an interrupt flag allocated by
+ * NewInterrupt(), which may be set from another thread.
+ */
+duk_bool_t duk_go_exec_timeout_check(void *udata) {
+	if (udata == NULL) {
+		return 0;
+	}
+	return __atomic_load_n((int *) udata, __ATOMIC_RELAXED) != 0;
+}
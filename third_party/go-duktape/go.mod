@@ -0,0 +1,3 @@
+module github.com/wirenboard/go-duktape
+
+go 1.20
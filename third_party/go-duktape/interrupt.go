@@ -0,0 +1,50 @@
+package duktape
+
+/*
+# include <stdlib.h>
+
+static void duk_go_store_interrupt(int *flag, int value) {
+	__atomic_store_n(flag, value, __ATOMIC_RELAXED);
+}
+
+static int duk_go_load_interrupt(int *flag) {
+	return __atomic_load_n(flag, __ATOMIC_RELAXED);
+}
+*/
+import "C"
+
+import "unsafe"
+
+// Interrupt makes the bytecode executor of the heaps created with
+// NewContextWithInterrupt throw RangeError("execution timeout")
+// while it's set. The error is rethrown by the executor until all
+// catchpoints are exhausted, so even a tight loop without any calls
+// is stopped. Interrupt may be set and cleared from any goroutine.
+// It's allocated in C memory, so it must be freed with Free
+// after all the heaps using it are destroyed
+type Interrupt struct {
+	flag *C.int
+}
+
+func NewInterrupt() *Interrupt {
+	return &Interrupt{(*C.int)(C.calloc(1, C.sizeof_int))}
+}
+
+func (i *Interrupt) Set() {
+	C.duk_go_store_interrupt(i.flag, 1)
+}
+
+func (i *Interrupt) Clear() {
+	C.duk_go_store_interrupt(i.flag, 0)
+}
+
+func (i *Interrupt) IsSet() bool {
+	return C.duk_go_load_interrupt(i.flag) != 0
+}
+
+// Free frees the memory of the interrupt. Neither the interrupt nor
+// the heaps created with it may be used after that
+func (i *Interrupt) Free() {
+	C.free(unsafe.Pointer(i.flag))
+	i.flag = nil
+}
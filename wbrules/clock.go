@@ -0,0 +1,323 @@
+package wbrules
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/wirenboard/wbgong"
+)
+
+// Clock provides timers and cron for the engine
+type Clock interface {
+	Now() time.Time
+	NewTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer
+	// NewCron creates cron that interprets the specs
+	// without explicit time zone in the given location
+	NewCron(loc *time.Location) Cron
+}
+
+type realClock struct{}
+
+// RealClock is the system clock
+var RealClock Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer {
+	if periodic {
+		return wbgong.NewRealTicker(d)
+	}
+
+	return wbgong.NewRealTimer(d)
+}
+
+func (realClock) NewCron(loc *time.Location) Cron {
+	return cron.New(cron.WithParser(cronSpecParser), cron.WithLocation(loc))
+}
+
+type clockEvent struct {
+	at       time.Time
+	seq      uint64
+	index    int
+	callback func()
+}
+
+type clockEventQueue []*clockEvent
+
+func (q clockEventQueue) Len() int { return len(q) }
+
+func (q clockEventQueue) Less(i, j int) bool {
+	if q[i].at.Equal(q[j].at) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].at.Before(q[j].at)
+}
+
+func (q clockEventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *clockEventQueue) Push(x any) {
+	ev := x.(*clockEvent)
+	ev.index = len(*q)
+	*q = append(*q, ev)
+}
+
+func (q *clockEventQueue) Pop() any {
+	old := *q
+	n := len(old)
+	ev := old[n-1]
+	old[n-1] = nil
+	ev.index = -1
+	*q = old[:n-1]
+	return ev
+}
+
+// VirtualClock is a manually advanced clock. It provides timers
+// and cron that fire in virtual time, so scripts may be run
+// against long event sequences (e.g. by Simulator) instantly
+type VirtualClock struct {
+	sync.Mutex
+
+	now    time.Time
+	seq    uint64
+	fired  uint64
+	events clockEventQueue
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+// Fired returns the number of timer and cron events fired so far
+func (c *VirtualClock) Fired() uint64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.fired
+}
+
+func (c *VirtualClock) schedule(at time.Time, callback func()) *clockEvent {
+	c.Lock()
+	defer c.Unlock()
+	c.seq++
+	ev := &clockEvent{at: at, seq: c.seq, callback: callback}
+	heap.Push(&c.events, ev)
+	return ev
+}
+
+func (c *VirtualClock) cancel(ev *clockEvent) {
+	c.Lock()
+	defer c.Unlock()
+	if ev.index >= 0 {
+		heap.Remove(&c.events, ev.index)
+	}
+}
+
+func (c *VirtualClock) popDue(until time.Time) *clockEvent {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.events) == 0 || c.events[0].at.After(until) {
+		c.now = until
+		return nil
+	}
+	ev := heap.Pop(&c.events).(*clockEvent)
+	c.now = ev.at
+	c.fired++
+	return ev
+}
+
+// Advance moves the clock forward by d firing all the events
+// that become due in their order. settle (if not nil) is invoked
+// after each event, so their consequences may be processed before
+// the clock moves further. If settle returns false, the clock
+// stops at the time of the last fired event
+func (c *VirtualClock) Advance(d time.Duration, settle func() bool) {
+	until := c.Now().Add(d)
+	for {
+		ev := c.popDue(until)
+		if ev == nil {
+			return
+		}
+		ev.callback()
+		if settle != nil && !settle() {
+			return
+		}
+	}
+}
+
+// NewTimer creates a timer that fires in virtual time
+func (c *VirtualClock) NewTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer {
+	t := &virtualTimer{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		interval: d,
+		periodic: periodic,
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.event = c.schedule(c.Now().Add(d), t.fire)
+	return t
+}
+
+// NewCron creates cron that runs its entries in virtual time
+func (c *VirtualClock) NewCron(loc *time.Location) Cron {
+	return &virtualCron{
+		clock:    c,
+		location: loc,
+		entries:  make(map[cron.EntryID]*virtualCronEntry),
+	}
+}
+
+type virtualTimer struct {
+	sync.Mutex
+
+	clock    *VirtualClock
+	ch       chan time.Time
+	interval time.Duration
+	periodic bool
+	event    *clockEvent
+}
+
+func (t *virtualTimer) fire() {
+	t.Lock()
+	defer t.Unlock()
+	if t.event == nil {
+		return
+	}
+	now := t.clock.Now()
+	select {
+	case t.ch <- now:
+	default:
+		// like time.Ticker, drop the tick if the previous
+		// one is not received yet
+	}
+	if t.periodic {
+		t.event = t.clock.schedule(now.Add(t.interval), t.fire)
+	} else {
+		t.event = nil
+	}
+}
+
+func (t *virtualTimer) GetChannel() <-chan time.Time {
+	return t.ch
+}
+
+func (t *virtualTimer) Stop() {
+	t.Lock()
+	defer t.Unlock()
+	if t.event != nil {
+		t.clock.cancel(t.event)
+		t.event = nil
+	}
+}
+
+type virtualCronEntry struct {
+	schedule cron.Schedule
+	cmd      cron.Job
+	event    *clockEvent
+}
+
+type virtualCron struct {
+	sync.Mutex
+
+	clock    *VirtualClock
+	location *time.Location
+	started  bool
+	lastId   cron.EntryID
+	entries  map[cron.EntryID]*virtualCronEntry
+}
+
+func (vc *virtualCron) AddFunc(spec string, cmd func()) (cron.EntryID, error) {
+	schedule, err := cronSpecParser.Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	return vc.Schedule(schedule, cron.FuncJob(cmd)), nil
+}
+
+func (vc *virtualCron) Schedule(schedule cron.Schedule, cmd cron.Job) cron.EntryID {
+	vc.Lock()
+	defer vc.Unlock()
+	vc.lastId++
+	entry := &virtualCronEntry{schedule: schedule, cmd: cmd}
+	vc.entries[vc.lastId] = entry
+	if vc.started {
+		vc.scheduleEntry(entry)
+	}
+	return vc.lastId
+}
+
+// scheduleEntry must be called with vc locked
+func (vc *virtualCron) scheduleEntry(entry *virtualCronEntry) {
+	next := entry.schedule.Next(vc.clock.Now().In(vc.location))
+	if next.IsZero() {
+		return
+	}
+	entry.event = vc.clock.schedule(next, func() {
+		vc.Lock()
+		if entry.event == nil {
+			vc.Unlock()
+			return
+		}
+		vc.scheduleEntry(entry)
+		vc.Unlock()
+		entry.cmd.Run()
+	})
+}
+
+func (vc *virtualCron) unscheduleEntry(entry *virtualCronEntry) {
+	if entry.event != nil {
+		vc.clock.cancel(entry.event)
+		entry.event = nil
+	}
+}
+
+func (vc *virtualCron) Remove(id cron.EntryID) {
+	vc.Lock()
+	defer vc.Unlock()
+	if entry, found := vc.entries[id]; found {
+		vc.unscheduleEntry(entry)
+		delete(vc.entries, id)
+	}
+}
+
+func (vc *virtualCron) Start() {
+	vc.Lock()
+	defer vc.Unlock()
+	if vc.started {
+		return
+	}
+	vc.started = true
+	ids := make([]cron.EntryID, 0, len(vc.entries))
+	for id := range vc.entries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		vc.scheduleEntry(vc.entries[id])
+	}
+}
+
+func (vc *virtualCron) Stop() context.Context {
+	vc.Lock()
+	defer vc.Unlock()
+	vc.started = false
+	for _, entry := range vc.entries {
+		vc.unscheduleEntry(entry)
+	}
+	return context.Background()
+}
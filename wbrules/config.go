@@ -0,0 +1,145 @@
+package wbrules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	LOG_FILE_DEFAULT_SIZE  = 1 << 20
+	LOG_FILE_DEFAULT_FILES = 5
+	LOG_SYSLOG_DEFAULT_FAC = "daemon"
+)
+
+// Config is the configuration file of wb-rules
+type Config struct {
+	Log *LogConfig `json:"log"`
+}
+
+type LogConfig struct {
+	Sinks     []LogSinkConfig     `json:"sinks"`
+	RateLimit *LogRateLimitConfig `json:"rateLimit"`
+}
+
+// LogSinkConfig describes a log sink. Type is either "file" or "syslog".
+// Syslog sinks without Address write to the local syslog daemon,
+// otherwise the messages are sent to Address over Network (udp or tcp)
+type LogSinkConfig struct {
+	Type  string `json:"type"`
+	Level string `json:"level"`
+
+	Path     string `json:"path"`
+	MaxSize  int64  `json:"maxSize"`
+	MaxFiles int    `json:"maxFiles"`
+
+	Network  string `json:"network"`
+	Address  string `json:"address"`
+	Facility string `json:"facility"`
+}
+
+type LogRateLimitConfig struct {
+	Messages int    `json:"messages"`
+	Interval string `json:"interval"`
+}
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	config := &Config{}
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+	return config, nil
+}
+
+func (c *LogRateLimitConfig) rateLimit() (LogRateLimit, error) {
+	if c == nil {
+		return LogRateLimit{}, nil
+	}
+	if c.Messages < 0 {
+		return LogRateLimit{}, fmt.Errorf("invalid log rate limit: %d messages", c.Messages)
+	}
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil || interval <= 0 {
+		return LogRateLimit{}, fmt.Errorf("invalid log rate limit interval %q", c.Interval)
+	}
+	return LogRateLimit{Messages: c.Messages, Interval: interval}, nil
+}
+
+func (c *LogSinkConfig) newSink() (LogSink, error) {
+	switch c.Type {
+	case "file":
+		if c.Path == "" {
+			return nil, fmt.Errorf("log file path is not specified")
+		}
+		maxSize, maxFiles := c.MaxSize, c.MaxFiles
+		if maxSize == 0 {
+			maxSize = LOG_FILE_DEFAULT_SIZE
+		}
+		if maxFiles == 0 {
+			maxFiles = LOG_FILE_DEFAULT_FILES
+		}
+		return NewFileLogSink(c.Path, maxSize, maxFiles)
+	case "syslog":
+		facilityName := c.Facility
+		if facilityName == "" {
+			facilityName = LOG_SYSLOG_DEFAULT_FAC
+		}
+		facility, err := ParseSyslogFacility(facilityName)
+		if err != nil {
+			return nil, err
+		}
+		if c.Address == "" {
+			return NewLocalSyslogSink(facility)
+		}
+		network := c.Network
+		if network == "" {
+			network = "udp"
+		}
+		return NewRemoteSyslogSink(network, c.Address, facility)
+	default:
+		return nil, fmt.Errorf("invalid log sink type %q (must be file or syslog)", c.Type)
+	}
+}
+
+// NewLogSinks creates the log sinks described by the config.
+// It returns nil if there are no sinks
+func (c *LogConfig) NewLogSinks() (sinks *LogSinks, err error) {
+	if c == nil || len(c.Sinks) == 0 {
+		return nil, nil
+	}
+	rateLimit, err := c.RateLimit.rateLimit()
+	if err != nil {
+		return nil, err
+	}
+
+	sinks = NewLogSinks(rateLimit)
+	defer func() {
+		if err != nil {
+			sinks.Close()
+			sinks = nil
+		}
+	}()
+	for i := range c.Sinks {
+		level := ENGINE_LOG_DEBUG
+		if c.Sinks[i].Level != "" {
+			if level, err = ParseEngineLogLevel(c.Sinks[i].Level); err != nil {
+				return
+			}
+		}
+		var sink LogSink
+		if sink, err = c.Sinks[i].newSink(); err != nil {
+			err = fmt.Errorf("log sink #%d: %s", i+1, err)
+			return
+		}
+		sinks.AddSink(sink, level)
+	}
+	return
+}
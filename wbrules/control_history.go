@@ -0,0 +1,555 @@
+package wbrules
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/stretchr/objx"
+	duktape "github.com/wirenboard/go-duktape"
+	"github.com/wirenboard/wbgong"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// persistent DB bucket for the history of virtual device
+	// controls, a nested bucket per control
+	CONTROL_HISTORY_BUCKET = INTERNAL_BUCKET_PREFIX + "control_history"
+	// keep times of the control histories, used to remove
+	// the histories which are not recorded anymore
+	CONTROL_HISTORY_KEEP_BUCKET = INTERNAL_BUCKET_PREFIX + "control_history_keep"
+
+	HISTORY_PROP_KEEP  = "keep"
+	HISTORY_PROP_EVERY = "every"
+
+	HISTORY_EVERY_DEFAULT = time.Minute
+	// every sample is a DB commit, so the history
+	// of a control isn't written too often
+	HISTORY_EVERY_MIN = 10 * time.Second
+
+	HISTORY_SAMPLE_SIZE = 32
+)
+
+// history is recorded for all numeric control types (value, range,
+// temperature, power etc.) and switches, but not for the controls
+// with non-numeric values
+var historyUnsupportedTypes = map[string]bool{
+	wbgong.CONV_TYPE_TEXT:       true,
+	wbgong.CONV_TYPE_PUSHBUTTON: true,
+	wbgong.CONV_TYPE_RGB:        true,
+	"alarm":                     true,
+}
+
+var (
+	errHistoryDisabled = errors.New("control history requires persistent storage")
+	errNoHistory       = errors.New("control has no history")
+	errHistoryRange    = errors.New("invalid history time range or window")
+)
+
+// HistorySpec is the 'history' property of a control definition.
+// Values of the control are aggregated every Every and kept for Keep
+type HistorySpec struct {
+	Keep  time.Duration
+	Every time.Duration
+}
+
+// HistorySample aggregates the values of a control over an interval
+// ending at Time. The value at the start of the interval is counted too
+type HistorySample struct {
+	Time  time.Time
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int
+}
+
+func (sample *HistorySample) add(value float64) {
+	if sample.Count == 0 || value < sample.Min {
+		sample.Min = value
+	}
+	if sample.Count == 0 || value > sample.Max {
+		sample.Max = value
+	}
+	sample.Sum += value
+	sample.Count++
+}
+
+func (sample *HistorySample) encode() (key, value []byte) {
+	key = make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(sample.Time.UnixNano()))
+	value = make([]byte, HISTORY_SAMPLE_SIZE)
+	binary.BigEndian.PutUint64(value, math.Float64bits(sample.Min))
+	binary.BigEndian.PutUint64(value[8:], math.Float64bits(sample.Max))
+	binary.BigEndian.PutUint64(value[16:], math.Float64bits(sample.Sum))
+	binary.BigEndian.PutUint64(value[24:], uint64(sample.Count))
+	return
+}
+
+func decodeHistorySample(key, value []byte) (sample HistorySample, ok bool) {
+	if len(key) != 8 || len(value) != HISTORY_SAMPLE_SIZE {
+		return sample, false
+	}
+	sample.Time = time.Unix(0, int64(binary.BigEndian.Uint64(key)))
+	sample.Min = math.Float64frombits(binary.BigEndian.Uint64(value))
+	sample.Max = math.Float64frombits(binary.BigEndian.Uint64(value[8:]))
+	sample.Sum = math.Float64frombits(binary.BigEndian.Uint64(value[16:]))
+	sample.Count = int(binary.BigEndian.Uint64(value[24:]))
+	return sample, true
+}
+
+// HistoryWindow is the aggregate of the samples
+// which were written within [From, To)
+type HistoryWindow struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+	Avg   float64   `json:"avg"`
+	Count int       `json:"count"`
+}
+
+// aggregateHistory splits [from, to) into the windows starting
+// at from and aggregates the samples. Empty windows are skipped
+func aggregateHistory(samples []HistorySample, from, to time.Time, window time.Duration) []HistoryWindow {
+	windows := make([]HistoryWindow, 0)
+	var sum float64
+	for _, sample := range samples {
+		if sample.Time.Before(from) || !sample.Time.Before(to) || sample.Count == 0 {
+			continue
+		}
+		start := from.Add(sample.Time.Sub(from) / window * window)
+		n := len(windows)
+		if n == 0 || !windows[n-1].From.Equal(start) {
+			if n > 0 {
+				windows[n-1].Avg = sum / float64(windows[n-1].Count)
+			}
+			end := start.Add(window)
+			if end.After(to) {
+				end = to
+			}
+			windows = append(windows, HistoryWindow{From: start, To: end, Min: sample.Min, Max: sample.Max})
+			n++
+			sum = 0
+		}
+		w := &windows[n-1]
+		w.Min = math.Min(w.Min, sample.Min)
+		w.Max = math.Max(w.Max, sample.Max)
+		w.Count += sample.Count
+		sum += sample.Sum
+	}
+	if n := len(windows); n > 0 {
+		windows[n-1].Avg = sum / float64(windows[n-1].Count)
+	}
+	return windows
+}
+
+// ControlHistoryStorage keeps the history samples of controls
+type ControlHistoryStorage interface {
+	// AppendHistory writes the sample and removes
+	// the samples written before keepFrom
+	AppendHistory(ctrlSpec ControlSpec, sample HistorySample, keepFrom time.Time) error
+	// ReadHistory returns the samples written within [from, to)
+	ReadHistory(ctrlSpec ControlSpec, from, to time.Time) ([]HistorySample, error)
+}
+
+func historyDurationProp(devId, ctrlId string, history objx.Map, name string) (d time.Duration, found bool, err error) {
+	v, found := history[name]
+	if !found {
+		return 0, false, nil
+	}
+	switch t := v.(type) {
+	case float64:
+		d = time.Duration(t * float64(time.Millisecond))
+	case string:
+		if d, err = ParseDuration(t); err != nil {
+			return 0, true, fmt.Errorf("%s/%s: history %s: %w", devId, ctrlId, name, err)
+		}
+	default:
+		return 0, true, fmt.Errorf("%s/%s: history %s: number or string expected", devId, ctrlId, name)
+	}
+	return d, true, nil
+}
+
+// parseHistorySpec parses the 'history' property of the control
+// definition, nil spec is returned if there is no such property
+func parseHistorySpec(devId, ctrlId string, ctrlDef objx.Map) (*HistorySpec, error) {
+	historyRaw, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_HISTORY]
+	if !ok {
+		return nil, nil
+	}
+	var history objx.Map
+	switch t := historyRaw.(type) {
+	case objx.Map:
+		history = t
+	case map[string]any:
+		history = objx.Map(t)
+	default:
+		return nil, fmt.Errorf("%s/%s: non-object value of history property", devId, ctrlId)
+	}
+
+	if ctrlType, _ := ctrlDef[VDEV_CONTROL_DESCR_PROP_TYPE].(string); historyUnsupportedTypes[ctrlType] {
+		return nil, fmt.Errorf("%s/%s: history is not supported for %s controls", devId, ctrlId, ctrlType)
+	}
+
+	spec := &HistorySpec{Every: HISTORY_EVERY_DEFAULT}
+	keep, found, err := historyDurationProp(devId, ctrlId, history, HISTORY_PROP_KEEP)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s/%s: history keep is not specified", devId, ctrlId)
+	}
+	spec.Keep = keep
+	if every, found, err := historyDurationProp(devId, ctrlId, history, HISTORY_PROP_EVERY); err != nil {
+		return nil, err
+	} else if found {
+		spec.Every = every
+	}
+
+	if spec.Every < HISTORY_EVERY_MIN {
+		return nil, fmt.Errorf("%s/%s: history every must be at least %s", devId, ctrlId, HISTORY_EVERY_MIN)
+	}
+	if spec.Keep < spec.Every {
+		return nil, fmt.Errorf("%s/%s: history keep must not be less than every", devId, ctrlId)
+	}
+	return spec, nil
+}
+
+// historyValue converts the control value to the number, switches
+// are counted as 0 and 1. Non-numeric values are skipped
+func historyValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// historyTracker collects the samples of the control,
+// accessed from the sync loop only
+type historyTracker struct {
+	spec    HistorySpec
+	timer   TimerId
+	current HistorySample
+	last    float64
+	hasLast bool
+}
+
+// trackHistory starts recording the history of the control.
+// The recording stops on cleanup of the current scope
+func (engine *RuleEngine) trackHistory(ctrlSpec ControlSpec, spec *HistorySpec) error {
+	if engine.historyStorage == nil {
+		return fmt.Errorf("%s: %w", ctrlSpec.String(), errHistoryDisabled)
+	}
+	engine.untrackHistory(ctrlSpec)
+
+	tracker := &historyTracker{spec: *spec}
+	tracker.timer = engine.StartTimer(NO_TIMER_NAME, func() {
+		engine.flushHistory(ctrlSpec, tracker)
+	}, spec.Every, true)
+
+	engine.historyMtx.Lock()
+	engine.historyTrackers[ctrlSpec] = tracker
+	engine.historyMtx.Unlock()
+
+	engine.cleanup.AddCleanup(func() {
+		engine.historyMtx.Lock()
+		current := engine.historyTrackers[ctrlSpec]
+		engine.historyMtx.Unlock()
+		// the control may be redefined by another script
+		if current == tracker {
+			engine.untrackHistory(ctrlSpec)
+		}
+	})
+	return nil
+}
+
+func (engine *RuleEngine) untrackHistory(ctrlSpec ControlSpec) {
+	engine.historyMtx.Lock()
+	tracker, found := engine.historyTrackers[ctrlSpec]
+	delete(engine.historyTrackers, ctrlSpec)
+	engine.historyMtx.Unlock()
+
+	if found {
+		engine.StopTimerByIndex(tracker.timer)
+	}
+}
+
+func (engine *RuleEngine) historyTracker(ctrlSpec ControlSpec) *historyTracker {
+	engine.historyMtx.Lock()
+	defer engine.historyMtx.Unlock()
+	return engine.historyTrackers[ctrlSpec]
+}
+
+func (engine *RuleEngine) isHistoryControl(ctrlSpec ControlSpec) bool {
+	return engine.historyTracker(ctrlSpec) != nil
+}
+
+// recordHistory adds the new control value to the current sample.
+// Must be called from the sync loop
+func (engine *RuleEngine) recordHistory(ctrlSpec ControlSpec, value any) {
+	tracker := engine.historyTracker(ctrlSpec)
+	if tracker == nil {
+		return
+	}
+	if v, ok := historyValue(value); ok {
+		tracker.current.add(v)
+		tracker.last, tracker.hasLast = v, true
+	}
+}
+
+// flushHistory writes the current sample of the control and starts
+// the next one with the last value. Must be called from the sync loop
+func (engine *RuleEngine) flushHistory(ctrlSpec ControlSpec, tracker *historyTracker) {
+	if tracker.current.Count > 0 {
+		now := engine.clock.Now()
+		tracker.current.Time = now
+		if err := engine.historyStorage.AppendHistory(ctrlSpec, tracker.current, now.Add(-tracker.spec.Keep)); err != nil {
+			wbgong.Warn.Printf("failed to write history of %s: %s", ctrlSpec.String(), err)
+		}
+	}
+	tracker.current = HistorySample{}
+	if tracker.hasLast {
+		tracker.current.add(tracker.last)
+	}
+}
+
+// ControlHistory aggregates the history of the control over the windows
+// within [from, to). Zero from and to mean the start of the kept history
+// and now, zero window means the sampling interval of the control
+func (engine *RuleEngine) ControlHistory(ctrlSpec ControlSpec, from, to time.Time, window time.Duration) ([]HistoryWindow, error) {
+	if engine.historyStorage == nil {
+		return nil, errHistoryDisabled
+	}
+	tracker := engine.historyTracker(ctrlSpec)
+	if tracker == nil {
+		return nil, errNoHistory
+	}
+	if to.IsZero() {
+		to = engine.clock.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-tracker.spec.Keep)
+	}
+	if window == 0 {
+		window = tracker.spec.Every
+	}
+	if window < 0 || !from.Before(to) {
+		return nil, errHistoryRange
+	}
+
+	samples, err := engine.historyStorage.ReadHistory(ctrlSpec, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return aggregateHistory(samples, from, to, window), nil
+}
+
+func historyBucketName(ctrlSpec ControlSpec) []byte {
+	return []byte(ctrlSpec.String())
+}
+
+// pruneHistory removes the samples written before keepFrom
+func pruneHistory(b *bolt.Bucket, keepFrom time.Time) error {
+	// samples are ordered by time, so the old ones are at the start
+	limit := make([]byte, 8)
+	binary.BigEndian.PutUint64(limit, uint64(keepFrom.UnixNano()))
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && string(k) < string(limit); k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendHistory implements ControlHistoryStorage using the persistent DB
+func (engine *ESEngine) AppendHistory(ctrlSpec ControlSpec, sample HistorySample, keepFrom time.Time) error {
+	return engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		root, err := tx.CreateBucketIfNotExists([]byte(CONTROL_HISTORY_BUCKET))
+		if err != nil {
+			return err
+		}
+		b, err := root.CreateBucketIfNotExists(historyBucketName(ctrlSpec))
+		if err != nil {
+			return err
+		}
+		key, value := sample.encode()
+		if err := b.Put(key, value); err != nil {
+			return err
+		}
+
+		keeps, err := tx.CreateBucketIfNotExists([]byte(CONTROL_HISTORY_KEEP_BUCKET))
+		if err != nil {
+			return err
+		}
+		keep := make([]byte, 8)
+		binary.BigEndian.PutUint64(keep, uint64(sample.Time.Sub(keepFrom)))
+		if err := keeps.Put(historyBucketName(ctrlSpec), keep); err != nil {
+			return err
+		}
+
+		return pruneHistory(b, keepFrom)
+	})
+}
+
+// sweepHistory removes the samples of the controls which history isn't
+// recorded anymore, e.g. after the control drops the history property
+// or its device or script is removed. Such samples are removed after
+// the keep time of the control, so the history survives temporary
+// failures of the script. Returns the number of removed histories
+func (engine *ESEngine) sweepHistory(now time.Time) (int, error) {
+	tracked := make(map[string]bool)
+	engine.historyMtx.Lock()
+	for ctrlSpec := range engine.historyTrackers {
+		tracked[string(historyBucketName(ctrlSpec))] = true
+	}
+	engine.historyMtx.Unlock()
+
+	removed := 0
+	err := engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(CONTROL_HISTORY_BUCKET))
+		if root == nil {
+			return nil
+		}
+		keeps := tx.Bucket([]byte(CONTROL_HISTORY_KEEP_BUCKET))
+		names := make([]string, 0)
+		root.ForEach(func(k, v []byte) error {
+			if v == nil && !tracked[string(k)] {
+				names = append(names, string(k))
+			}
+			return nil
+		})
+
+		for _, name := range names {
+			// the history without known keep time is removed at once
+			keepFrom := now
+			if keeps != nil {
+				if v := keeps.Get([]byte(name)); len(v) == 8 {
+					keepFrom = now.Add(-time.Duration(binary.BigEndian.Uint64(v)))
+				}
+			}
+			b := root.Bucket([]byte(name))
+			if err := pruneHistory(b, keepFrom); err != nil {
+				return err
+			}
+			if k, _ := b.Cursor().First(); k != nil {
+				continue
+			}
+			if err := root.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+			if keeps != nil {
+				if err := keeps.Delete([]byte(name)); err != nil {
+					return err
+				}
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// ReadHistory implements ControlHistoryStorage using the persistent DB
+func (engine *ESEngine) ReadHistory(ctrlSpec ControlSpec, from, to time.Time) ([]HistorySample, error) {
+	samples := make([]HistorySample, 0)
+	err := engine.persistentDB.View(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(CONTROL_HISTORY_BUCKET))
+		if root == nil {
+			return nil
+		}
+		b := root.Bucket(historyBucketName(ctrlSpec))
+		if b == nil {
+			return nil
+		}
+		start := make([]byte, 8)
+		binary.BigEndian.PutUint64(start, uint64(from.UnixNano()))
+		c := b.Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			sample, ok := decodeHistorySample(k, v)
+			if !ok {
+				continue
+			}
+			if !sample.Time.Before(to) {
+				break
+			}
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// Returns the history of the control aggregated over windows.
+// Used in 'getControl(name).getHistory({ period, window })'
+func (engine *ESEngine) esVdevCellGetHistory(ctx *ESContext) int {
+	// arguments: ([options = { period duration, window duration }])
+	var period, window time.Duration
+	if ctx.GetTop() > 0 && !ctx.IsNullOrUndefined(0) {
+		if !ctx.IsObject(0) {
+			return duktape.DUK_RET_TYPE_ERROR
+		}
+		var err error
+		for _, opt := range []struct {
+			name string
+			d    *time.Duration
+		}{
+			{"period", &period},
+			{"window", &window},
+		} {
+			if !ctx.HasPropString(0, opt.name) {
+				continue
+			}
+			if *opt.d, err = engine.getDurationProp(ctx, 0, opt.name); err != nil {
+				ctx.PushErrorObject(duktape.DUK_ERR_TYPE_ERROR,
+					fmt.Sprintf("bad history options: %s", err))
+				return duktape.DUK_RET_INSTACK_ERROR
+			}
+		}
+	}
+
+	ctrlProxy, duk_ret := engine.getControlFromCtx(ctx)
+	if duk_ret < 0 {
+		return duk_ret
+	}
+	ctrlSpec := ControlSpec{ctrlProxy.devProxy.name, ctrlProxy.name}
+
+	var from time.Time
+	to := engine.clock.Now()
+	if period > 0 {
+		from = to.Add(-period)
+	}
+	windows, err := engine.ControlHistory(ctrlSpec, from, to, window)
+	if err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't get history of %s: %s", ctrlSpec.String(), err))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+
+	result := make([]map[string]any, len(windows))
+	for i, w := range windows {
+		result[i] = map[string]any{
+			"from":  w.From.UnixMilli(),
+			"to":    w.To.UnixMilli(),
+			"min":   w.Min,
+			"max":   w.Max,
+			"avg":   w.Avg,
+			"count": w.Count,
+		}
+	}
+	ctx.PushJSObject(result)
+
+	return 1
+}
@@ -0,0 +1,217 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/objx"
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong/testutils"
+	bolt "go.etcd.io/bbolt"
+)
+
+type ControlHistorySuite struct {
+	RuleSuiteBase
+}
+
+func (s *ControlHistorySuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_history.js")
+}
+
+func (s *ControlHistorySuite) TestHistory() {
+	s.Ck("EvalScript()", s.engine.EvalScript("defineHistoryDevice()"))
+	s.SkipTill("new fake ticker: 1, 10000")
+
+	s.Ck("EvalScript()", s.engine.EvalScript(`dev["history/temp"] = 10; dev["history/temp"] = 30`))
+	s.SkipTill("[info] temp changed to 30")
+
+	s.FireTimer(1, s.AdvanceTime(10*time.Second))
+	s.Verify("timer.fire(): 1")
+	s.WaitFor(func() bool {
+		windows, err := s.engine.ControlHistory(ControlSpec{"history", "temp"}, time.Time{}, time.Time{}, 0)
+		return err == nil && len(windows) > 0
+	})
+
+	s.engine.EvalScript("logHistory()")
+	s.Verify("[info] windows: 1, min: 10, max: 30")
+}
+
+func (s *ControlHistorySuite) TestInvalidHistory() {
+	s.engine.EvalScript("testInvalidHistory()")
+	s.Verify(
+		"[info] caught: testrules_history.js:35: badhistory/ctrl: history is not supported for text controls",
+		"[info] caught: testrules_history.js:35: badhistory/ctrl: history keep is not specified",
+		"[info] caught: testrules_history.js:35: badhistory/ctrl: history keep must not be less than every",
+		`[info] caught: testrules_history.js:35: badhistory/ctrl: history keep: invalid duration: "forever"`,
+	)
+	s.EnsureGotErrors()
+}
+
+func TestControlHistorySuite(t *testing.T) {
+	testutils.RunSuites(t, new(ControlHistorySuite))
+}
+
+func TestParseHistorySpec(t *testing.T) {
+	spec, err := parseHistorySpec("dev", "ctrl", objx.Map{"type": "value", "value": 0})
+	require.NoError(t, err)
+	require.Nil(t, spec)
+
+	spec, err = parseHistorySpec("dev", "ctrl", objx.Map{
+		"type":    "switch",
+		"value":   false,
+		"history": map[string]any{"keep": "1d"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &HistorySpec{Keep: 24 * time.Hour, Every: time.Minute}, spec)
+
+	spec, err = parseHistorySpec("dev", "ctrl", objx.Map{
+		"type":    "range",
+		"value":   0,
+		"history": objx.Map{"keep": 3600000.0, "every": "30s"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &HistorySpec{Keep: time.Hour, Every: 30 * time.Second}, spec)
+
+	spec, err = parseHistorySpec("dev", "ctrl", objx.Map{
+		"type":    "temperature",
+		"value":   20,
+		"history": objx.Map{"keep": "1h"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &HistorySpec{Keep: time.Hour, Every: time.Minute}, spec)
+
+	_, err = parseHistorySpec("dev", "ctrl", objx.Map{
+		"type":    "pushbutton",
+		"history": objx.Map{"keep": "1h"},
+	})
+	require.EqualError(t, err, "dev/ctrl: history is not supported for pushbutton controls")
+
+	_, err = parseHistorySpec("dev", "ctrl", objx.Map{
+		"type":    "value",
+		"value":   0,
+		"history": objx.Map{"keep": "1h", "every": "5s"},
+	})
+	require.EqualError(t, err, "dev/ctrl: history every must be at least 10s")
+
+	_, err = parseHistorySpec("dev", "ctrl", objx.Map{"type": "value", "value": 0, "history": true})
+	require.EqualError(t, err, "dev/ctrl: non-object value of history property")
+}
+
+func TestAggregateHistory(t *testing.T) {
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	sample := func(offset time.Duration, values ...float64) HistorySample {
+		s := HistorySample{Time: t0.Add(offset)}
+		for _, v := range values {
+			s.add(v)
+		}
+		return s
+	}
+	samples := []HistorySample{
+		sample(-time.Minute, 100),
+		sample(time.Minute, 1, 3),
+		sample(2*time.Minute, 5),
+		sample(20*time.Minute, 10, 20),
+		sample(40*time.Minute, 7),
+	}
+
+	require.Equal(t, []HistoryWindow{
+		{From: t0, To: t0.Add(15 * time.Minute), Min: 1, Max: 5, Avg: 3, Count: 3},
+		{From: t0.Add(15 * time.Minute), To: t0.Add(30 * time.Minute), Min: 10, Max: 20, Avg: 15, Count: 2},
+	}, aggregateHistory(samples, t0, t0.Add(30*time.Minute), 15*time.Minute))
+
+	// the last window is cut by the end of the range
+	require.Equal(t, []HistoryWindow{
+		{From: t0, To: t0.Add(45 * time.Minute), Min: 1, Max: 20, Avg: 46.0 / 6, Count: 6},
+	}, aggregateHistory(samples, t0, t0.Add(45*time.Minute), time.Hour))
+
+	require.Empty(t, aggregateHistory(samples, t0.Add(3*time.Minute), t0.Add(10*time.Minute), time.Minute))
+}
+
+func TestHistoryStorage(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	engine := &ESEngine{persistentDB: db}
+	spec := ControlSpec{"dev", "ctrl"}
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		sample := HistorySample{Time: t0.Add(time.Duration(i) * time.Minute)}
+		sample.add(float64(i))
+		require.NoError(t, engine.AppendHistory(spec, sample, sample.Time.Add(-3*time.Minute)))
+	}
+
+	samples, err := engine.ReadHistory(spec, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 4)
+	require.True(t, samples[0].Time.Equal(t0.Add(time.Minute)))
+	require.Equal(t, 4.0, samples[3].Max)
+
+	samples, err = engine.ReadHistory(spec, t0.Add(2*time.Minute), t0.Add(4*time.Minute))
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+
+	samples, err = engine.ReadHistory(ControlSpec{"dev", "other"}, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, samples)
+
+	// history is not exposed to Storage RPC
+	buckets, err := engine.StorageBuckets()
+	require.NoError(t, err)
+	require.Empty(t, buckets)
+}
+
+func TestSweepHistory(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	tracked, dropped := ControlSpec{"dev", "tracked"}, ControlSpec{"dev", "dropped"}
+	engine := &ESEngine{
+		RuleEngine: &RuleEngine{
+			historyTrackers: map[ControlSpec]*historyTracker{tracked: {}},
+		},
+		persistentDB: db,
+	}
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	for _, spec := range []ControlSpec{tracked, dropped} {
+		for i := 0; i < 3; i++ {
+			sample := HistorySample{Time: t0.Add(time.Duration(i) * time.Minute)}
+			sample.add(float64(i))
+			require.NoError(t, engine.AppendHistory(spec, sample, sample.Time.Add(-time.Hour)))
+		}
+	}
+
+	// samples of the untracked control are kept for its keep time
+	n, err := engine.sweepHistory(t0.Add(time.Hour + 90*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	samples, err := engine.ReadHistory(dropped, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+
+	n, err = engine.sweepHistory(t0.Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket([]byte(CONTROL_HISTORY_BUCKET)).Bucket(historyBucketName(dropped)))
+		require.Nil(t, tx.Bucket([]byte(CONTROL_HISTORY_KEEP_BUCKET)).Get(historyBucketName(dropped)))
+		return nil
+	})
+
+	samples, err = engine.ReadHistory(tracked, t0, t0.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+}
+
+func TestAddControlHistoryDisabled(t *testing.T) {
+	// the history is checked before the control is created,
+	// so the driver isn't accessed
+	engine := &RuleEngine{}
+	err := engine.AddControl("dev", "ctrl", objx.Map{
+		"type":    "value",
+		"value":   0.0,
+		"history": objx.Map{"keep": "1h"},
+	})
+	require.ErrorIs(t, err, errHistoryDisabled)
+}
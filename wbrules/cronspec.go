@@ -0,0 +1,134 @@
+package wbrules
+
+import (
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cron.SpecSchedule field bit that marks '*' (see robfig/cron spec.go)
+const cronStarBit = 1 << 63
+
+// cronStdParser parses cron specs of rules.
+// There are two cron spec formats in common usage:
+// - Standard: "minute hour dom month dow"
+// - Quartz: "second minute hour dom month dow [year]"
+// cron.v1 default format was incompatible with both of these formats: "second minute hour dom month [dow]".
+// cron.v3 default format is Standard.
+// Use original format here for backward compatibility.
+var cronStdParser = cron.NewParser(
+	cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.DowOptional | cron.Descriptor)
+
+// cronSpecParser parses cron specs of rules making
+// the schedules aware of DST transitions
+var cronSpecParser cron.ScheduleParser = dstScheduleParser{}
+
+type dstScheduleParser struct{}
+
+func (dstScheduleParser) Parse(spec string) (cron.Schedule, error) {
+	schedule, err := cronStdParser.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	// schedules with '*' in hour field run each hour
+	// of the day, no matter how long the day is
+	if s, ok := schedule.(*cron.SpecSchedule); ok && s.Hour&cronStarBit == 0 {
+		return &dstSchedule{s}, nil
+	}
+	return schedule, nil
+}
+
+// cronSpecTimezone returns the time zone name from
+// "CRON_TZ=Zone spec" or "TZ=Zone spec" cron spec prefix
+func cronSpecTimezone(spec string) (tz string, ok bool) {
+	for _, prefix := range []string{"CRON_TZ=", "TZ="} {
+		if strings.HasPrefix(spec, prefix) {
+			tz = strings.TrimPrefix(spec, prefix)
+			if i := strings.IndexAny(tz, " \t"); i >= 0 {
+				tz = tz[:i]
+			}
+			return tz, true
+		}
+	}
+	return "", false
+}
+
+// dstSchedule handles DST transitions for the schedules
+// that run at the fixed hours like traditional cron does:
+//   - a run at the wall time that is skipped when the clock
+//     is moved forward happens right after the transition;
+//   - a run at the wall time that is repeated when the clock
+//     is moved backward happens only once.
+//
+// cron.SpecSchedule skips the former and runs the latter twice
+type dstSchedule struct {
+	*cron.SpecSchedule
+}
+
+func (s *dstSchedule) Next(t time.Time) time.Time {
+	loc := s.Location
+	if loc == time.Local {
+		loc = t.Location()
+	}
+	for {
+		next := s.SpecSchedule.Next(t)
+		if next.IsZero() {
+			return next
+		}
+		if skipped, ok := s.skippedRun(t.In(loc), next.In(loc)); ok {
+			return skipped.In(t.Location())
+		}
+		if !isRepeatedWallTime(next.In(loc)) {
+			return next
+		}
+		t = next
+	}
+}
+
+// skippedRun checks whether the clock is moved forward between t and next
+// and the schedule has a run at the wall time skipped by the transition.
+// If so, the time of the transition is returned
+func (s *dstSchedule) skippedRun(t, next time.Time) (time.Time, bool) {
+	_, offset := t.Zone()
+	_, nextOffset := next.Zone()
+	if nextOffset <= offset {
+		return time.Time{}, false
+	}
+
+	// find the transition with one second precision
+	from, to := t.Unix(), next.Unix()
+	for to-from > 1 {
+		mid := from + (to-from)/2
+		if _, o := time.Unix(mid, 0).In(t.Location()).Zone(); o == offset {
+			from = mid
+		} else {
+			to = mid
+		}
+	}
+	transition := time.Unix(to, 0)
+
+	// the skipped wall times are the times after
+	// the transition as if the offset wasn't changed
+	spec := *s.SpecSchedule
+	spec.Location = time.FixedZone("", offset)
+	run := spec.Next(transition.Add(-time.Second))
+	shift := time.Duration(nextOffset-offset) * time.Second
+	if run.IsZero() || !run.Before(transition.Add(shift)) {
+		return time.Time{}, false
+	}
+	return transition, true
+}
+
+// isRepeatedWallTime returns true if the wall time of t already
+// happened before the clock was moved backward
+func isRepeatedWallTime(t time.Time) bool {
+	_, offset := t.Zone()
+	_, prevOffset := t.Add(-24 * time.Hour).Zone()
+	if prevOffset <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(prevOffset-offset) * time.Second)
+	return earlier.YearDay() == t.YearDay() && earlier.Hour() == t.Hour() &&
+		earlier.Minute() == t.Minute() && earlier.Second() == t.Second()
+}
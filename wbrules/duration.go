@@ -0,0 +1,50 @@
+package wbrules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseDuration parses duration strings such as "500ms", "-1m30s" or "7d12h".
+// In addition to units accepted by time.ParseDuration, "d" (24 hours)
+// may be used as the leading unit. A plain number is treated as milliseconds.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if ms, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(ms * float64(time.Millisecond)), nil
+	}
+
+	sign := time.Duration(1)
+	orig := s
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration: %q", orig)
+	}
+
+	var d time.Duration
+	if i := strings.Index(s, "d"); i >= 0 {
+		days, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid duration: %q", orig)
+		}
+		d = time.Duration(days * float64(24*time.Hour))
+		s = s[i+1:]
+	}
+
+	if s != "" {
+		rest, err := time.ParseDuration(s)
+		if err != nil || rest < 0 {
+			return 0, fmt.Errorf("invalid duration: %q", orig)
+		}
+		d += rest
+	}
+	return sign * d, nil
+}
@@ -0,0 +1,30 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"1500":   1500 * time.Millisecond,
+		"500ms":  500 * time.Millisecond,
+		"1m30s":  90 * time.Second,
+		"+30m":   30 * time.Minute,
+		"-1h":    -time.Hour,
+		"7d":     7 * 24 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"-1d12h": -36 * time.Hour,
+	} {
+		d, err := ParseDuration(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+
+	for _, s := range []string{"", "abc", "1x", "d", "+", "1d-2h", "--1h"} {
+		_, err := ParseDuration(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -38,6 +38,8 @@ const (
 	EDITOR_ERROR_OVERWRITE      = 1007
 	EDITOR_ERROR_INVALID_EXT    = 1008
 	EDITOR_ERROR_INVALID_LEN    = 1009
+	EDITOR_ERROR_RELOAD         = 1010
+	EDITOR_ERROR_STORAGE        = 1011
 )
 
 var (
@@ -51,6 +53,8 @@ var (
 	rmError               = &EditorError{EDITOR_ERROR_REMOVE, "Error removing the file"}
 	renameError           = &EditorError{EDITOR_ERROR_RENAME, "Error renaming the file"}
 	overwriteError        = &EditorError{EDITOR_ERROR_OVERWRITE, "New-state file already exists"}
+	reloadError           = &EditorError{EDITOR_ERROR_RELOAD, "Error reloading the file"}
+	moveStorageError      = &EditorError{EDITOR_ERROR_STORAGE, "Error moving persistent storages of the file"}
 )
 
 func validateScriptPath(pth string) error {
@@ -248,11 +252,41 @@ func (editor *Editor) Rename(args *EditorRenameArgs, reply *bool) error {
 		return overwriteError
 	}
 
+	// local storages are named after the script path
+	oldScript := strings.TrimSuffix(entry.PhysicalPath, FILE_DISABLED_SUFFIX)
+	newScript := strings.TrimSuffix(newPath, FILE_DISABLED_SUFFIX)
+	if err = editor.locFileManager.MigrateScriptStorages(oldScript, newScript); err != nil {
+		wbgong.Error.Printf("error moving persistent storages of %s to %s: %s", entry.PhysicalPath, newPath, err)
+		return moveStorageError
+	}
+
 	if err = os.Rename(entry.PhysicalPath, newPath); err != nil {
 		wbgong.Error.Printf("error renaming %s to %s: %s", entry.PhysicalPath, newPath, err)
+		if err := editor.locFileManager.MigrateScriptStorages(newScript, oldScript); err != nil {
+			wbgong.Error.Printf("error moving persistent storages of %s back: %s", newPath, err)
+		}
 		return renameError
 	}
 
 	*reply = true
 	return nil
 }
+
+// Unquarantine reloads the script quarantined because of runtime
+// errors. The reply is false if the script is not quarantined
+func (editor *Editor) Unquarantine(args *EditorPathArgs, reply *bool) error {
+	entry, err := editor.locateFile(args.Path)
+	if err != nil {
+		return err
+	}
+
+	*reply, err = editor.locFileManager.UnquarantineScript(entry.VirtualPath)
+	switch err.(type) {
+	case nil, ScriptError:
+		// script errors are reported in the file entry
+		return nil
+	default:
+		wbgong.Error.Printf("error reloading %s: %s", entry.PhysicalPath, err)
+		return reloadError
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/objx"
 	"github.com/wirenboard/wbgong/testutils"
@@ -19,6 +20,10 @@ type EditorSuite struct {
 	liveWriteError  error
 	scriptErrorPath string
 	scriptError     *ScriptError
+	quarantinedPath string
+	unquarantined   []string
+	migrated        [][2]string
+	migrateError    error
 }
 
 func (s *EditorSuite) T() *testing.T {
@@ -31,12 +36,16 @@ func (s *EditorSuite) SetupTest() {
 	s.liveWriteError = nil
 	s.scriptErrorPath = ""
 	s.scriptError = nil
+	s.quarantinedPath = ""
+	s.unquarantined = nil
+	s.migrated = nil
+	s.migrateError = nil
 	s.DataFileFixture = testutils.NewDataFileFixture(s.T())
 	s.addSampleFiles()
 	s.RpcFixture = testutils.NewRpcFixture(
 		s.T(), "wbrules", "Editor", "wbrules",
 		NewEditor(s),
-		"ChangeState", "List", "Load", "Remove", "Rename", "Save")
+		"ChangeState", "List", "Load", "Remove", "Rename", "Save", "Unquarantine")
 }
 
 func (s *EditorSuite) TearDownTest() {
@@ -67,6 +76,23 @@ func (s *EditorSuite) LiveWriteScript(virtualPath, content string) error {
 	return s.liveWriteError
 }
 
+func (s *EditorSuite) UnquarantineScript(virtualPath string) (bool, error) {
+	s.unquarantined = append(s.unquarantined, virtualPath)
+	if virtualPath != s.quarantinedPath {
+		return false, nil
+	}
+	s.quarantinedPath = ""
+	return true, nil
+}
+
+func (s *EditorSuite) MigrateScriptStorages(oldPath, newPath string) error {
+	if s.migrateError != nil {
+		return s.migrateError
+	}
+	s.migrated = append(s.migrated, [2]string{oldPath, newPath})
+	return nil
+}
+
 func (s *EditorSuite) expectLiveWrite(path string, err error) {
 	s.liveWritePath = path
 	s.liveWriteError = err
@@ -120,6 +146,12 @@ func (s *EditorSuite) ListSourceFiles() (entries []LocFileEntry, err error) {
 		if s.scriptError != nil && virtualPath == s.scriptErrorPath {
 			entry.Error = s.scriptError
 		}
+		if virtualPath == s.quarantinedPath {
+			entry.Quarantine = &ScriptQuarantine{
+				Since:  time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+				Reason: "3 runtime errors within 1m0s, last error: foo",
+			}
+		}
 		entries = append(entries, entry)
 	})
 	return
@@ -420,6 +452,68 @@ func (s *EditorSuite) TestRenameFile() {
 		"sample2.js":          "// sample2",
 		"sample3.js.disabled": "// disabled sample3",
 	})
+
+	// local persistent storages follow the script
+	dir := s.DataFileTempDir()
+	s.Equal([][2]string{
+		{dir + "/sample1.js", dir + "/sample1_new.js"},
+		{dir + "/sample1_new.js", dir + "/sample1.js"},
+	}, s.migrated)
+
+	s.migrateError = errors.New("storage exists")
+	s.VerifyRpcError("Rename", objx.Map{"path": "sample2.js", "new_path": "sample2_new.js"},
+		EDITOR_ERROR_STORAGE, "EditorError", "Error moving persistent storages of the file")
+	s.EnsureGotErrors()
+	s.verifySources(map[string]string{
+		"sample1.js.disabled": "// sample1",
+		"sample2.js":          "// sample2",
+		"sample3.js.disabled": "// disabled sample3",
+	})
+}
+
+func (s *EditorSuite) TestUnquarantineFile() {
+	s.quarantinedPath = "sample2.js"
+	s.VerifyRpc("List", objx.Map{}, []objx.Map{
+		{
+			"virtualPath": "sample1.js",
+			"enabled":     true,
+			"devices": []objx.Map{
+				{"line": 1, "name": "abc"},
+				{"line": 2, "name": "def"},
+			},
+			"rules": []objx.Map{
+				{"line": 10, "name": "foobar"},
+			},
+			"timers": []objx.Map{},
+		},
+		{
+			"virtualPath": "sample2.js",
+			"enabled":     true,
+			"devices":     []objx.Map{},
+			"rules":       []objx.Map{},
+			"timers":      []objx.Map{},
+			"quarantine": objx.Map{
+				"since":  "2026-10-17T12:00:00Z",
+				"reason": "3 runtime errors within 1m0s, last error: foo",
+			},
+		},
+		{
+			"virtualPath": "sample3.js",
+			"enabled":     false,
+			"devices":     []objx.Map{},
+			"rules":       []objx.Map{},
+			"timers":      []objx.Map{},
+		},
+	})
+
+	s.VerifyRpc("Unquarantine", objx.Map{"path": "sample2.js"}, true)
+	s.VerifyRpc("Unquarantine", objx.Map{"path": "sample2.js"}, false)
+	s.VerifyRpc("Unquarantine", objx.Map{"path": "sample1.js"}, false)
+	s.Equal([]string{"sample2.js", "sample2.js", "sample1.js"}, s.unquarantined)
+
+	s.VerifyRpcError("Unquarantine", objx.Map{"path": "nosuchfile.js"},
+		EDITOR_ERROR_FILE_NOT_FOUND, "EditorError", "File not found")
+	s.EnsureGotErrors()
 }
 
 func TestEditorSuite(t *testing.T) {
@@ -7,6 +7,7 @@ import (
 	"log"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -29,6 +30,8 @@ const (
 	RULE_ENGINE_SETTINGS_DEV_TITLE_RU = "Настройки движка правил"
 	RULE_DEBUG_CELL_NAME              = "Rule debugging"
 	RULE_DEBUG_CELL_NAME_RU           = "Отладка правил"
+	RULE_TIMEZONE_CELL_NAME           = "Timezone"
+	RULE_TIMEZONE_CELL_NAME_RU        = "Часовой пояс"
 
 	SYNC_QUEUE_LEN = 32
 
@@ -53,6 +56,9 @@ const (
 	ATOMIC_FALSE = 0
 
 	ENGINE_CALLSYNC_TIMEOUT = 120 * time.Second
+
+	ENGINE_LOG_TOPIC_BASE = "/wbrules/log/"
+	ENGINE_LOG_JSON_TOPIC = ENGINE_LOG_TOPIC_BASE + "json"
 )
 
 // errors
@@ -69,16 +75,6 @@ func (c *ControlSpec) String() string {
 	return c.DeviceId + "/" + c.ControlId
 }
 
-type TimerFunc func(id TimerId, d time.Duration, periodic bool) wbgong.Timer
-
-func newTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer {
-	if periodic {
-		return wbgong.NewRealTicker(d)
-	}
-
-	return wbgong.NewRealTimer(d)
-}
-
 type TimerEntry struct {
 	sync.Mutex
 	timer          wbgong.Timer
@@ -589,25 +585,54 @@ func (cp cronProxy) AddFunc(spec string, cmd func()) (cron.EntryID, error) {
 	})
 }
 
+func (cp cronProxy) Schedule(schedule cron.Schedule, cmd cron.Job) cron.EntryID {
+	return cp.Cron.Schedule(schedule, cron.FuncJob(func() {
+		cp.exec(cmd.Run)
+	}))
+}
+
 // ControlChangeEvent
 type ControlChangeEvent struct {
 	Spec        ControlSpec
 	ControlType string
 	IsComplete  bool
 	IsRetained  bool
-	Value       any
-	PrevValue   any
+	// IsLocal is set for the controls of the devices defined by the engine
+	IsLocal   bool
+	Value     any
+	PrevValue any
 }
 
 type RuleEngineOptions struct {
 	debugQueues   bool
 	cleanupOnStop bool
+	traceCapacity int
+	clock         Clock
+	location      *GeoLocation
+	exportMetrics bool
+
+	eventBufferCapacity int
+	eventOverflowPolicy EventOverflowPolicy
+	eventCoalescing     bool
+
+	callbackBudget     time.Duration
+	callbackViolations int
+
+	jsonLog  bool
+	logRing  *LogRing
+	logSinks *LogSinks
 }
 
 func NewRuleEngineOptions() *RuleEngineOptions {
 	return &RuleEngineOptions{
 		debugQueues:   false,
 		cleanupOnStop: false,
+		traceCapacity: RULE_TRACE_CAPACITY,
+		clock:         RealClock,
+		exportMetrics: true,
+
+		eventBufferCapacity: EVENT_BUFFER_DEFAULT_CAPACITY,
+		eventOverflowPolicy: EVENT_OVERFLOW_DROP_OLDEST,
 	}
 }
 
@@ -621,6 +646,80 @@ func (o *RuleEngineOptions) SetCleanupOnStop(v bool) *RuleEngineOptions {
 	return o
 }
 
+// SetTraceCapacity sets the number of execution trace entries
+// kept for every rule. Zero disables tracing
+func (o *RuleEngineOptions) SetTraceCapacity(v int) *RuleEngineOptions {
+	o.traceCapacity = v
+	return o
+}
+
+// SetLocation sets the default location for sun() schedules
+func (o *RuleEngineOptions) SetLocation(location *GeoLocation) *RuleEngineOptions {
+	o.location = location
+	return o
+}
+
+// SetExportMetrics sets whether the engine metrics are exported
+// to the default metrics registry. It should be disabled for
+// auxiliary engines, e.g. the ones used for simulation
+func (o *RuleEngineOptions) SetExportMetrics(v bool) *RuleEngineOptions {
+	o.exportMetrics = v
+	return o
+}
+
+// SetEventBufferCapacity limits the number of control change
+// events waiting to be processed by the rules (0 means no limit).
+// When the limit is reached, events are dropped according to policy
+func (o *RuleEngineOptions) SetEventBufferCapacity(capacity int, policy EventOverflowPolicy) *RuleEngineOptions {
+	o.eventBufferCapacity = capacity
+	o.eventOverflowPolicy = policy
+	return o
+}
+
+// SetEventCoalescing enables replacing of a pending control change
+// event by a newer event of the same control, so that the rules see
+// only the latest value (but the PrevValue of the first pending event)
+func (o *RuleEngineOptions) SetEventCoalescing(v bool) *RuleEngineOptions {
+	o.eventCoalescing = v
+	return o
+}
+
+// SetCallbackWatchdog sets the execution time budget of JS callbacks
+// (0 disables the watchdog). If maxViolations is greater than zero,
+// a rule is disabled after its callbacks exceed the budget that many times
+func (o *RuleEngineOptions) SetCallbackWatchdog(budget time.Duration, maxViolations int) *RuleEngineOptions {
+	o.callbackBudget = budget
+	o.callbackViolations = maxViolations
+	return o
+}
+
+// SetJSONLog enables publishing of log messages as JSON records
+// to ENGINE_LOG_JSON_TOPIC in addition to the plain level topics
+func (o *RuleEngineOptions) SetJSONLog(v bool) *RuleEngineOptions {
+	o.jsonLog = v
+	return o
+}
+
+// SetLogRing sets the ring buffer that keeps
+// the log records for querying via the Log service
+func (o *RuleEngineOptions) SetLogRing(ring *LogRing) *RuleEngineOptions {
+	o.logRing = ring
+	return o
+}
+
+// SetLogSinks sets the sinks the log records are written to
+func (o *RuleEngineOptions) SetLogSinks(sinks *LogSinks) *RuleEngineOptions {
+	o.logSinks = sinks
+	return o
+}
+
+// SetClock sets the clock that drives timers and cron rules
+// of the engine (e.g. VirtualClock). RealClock is used by default
+func (o *RuleEngineOptions) SetClock(clock Clock) *RuleEngineOptions {
+	o.clock = clock
+	return o
+}
+
 type RuleEngine struct {
 	active          uint32 // atomic
 	cleanup         *ScopedCleanup
@@ -632,9 +731,11 @@ type RuleEngine struct {
 	driver          wbgong.Driver
 	driverReadyCh   chan struct{}
 
-	eventBuffer *EventBuffer
+	eventBuffer        *EventBuffer
+	eventBufferOptions EventBufferOptions
+	eventJournal       *EventJournal
 
-	timerFunc   TimerFunc
+	clock       Clock
 	nextTimerId TimerId
 
 	timersMutex sync.Mutex
@@ -654,7 +755,6 @@ type RuleEngine struct {
 	notedControls   []ControlSpec
 	notedTimers     map[string]bool
 	currentTimer    string
-	cronMaker       func() Cron
 	cron            Cron
 	statusMtx       sync.Mutex
 	getTimerMtx     sync.Mutex
@@ -669,6 +769,45 @@ type RuleEngine struct {
 
 	cleanupOnStop bool
 
+	traceCapacity int
+	activeTrace   *RuleTraceEntry
+
+	location *GeoLocation
+
+	// switchable rules by names, accessed from the sync loop only
+	ruleSwitches map[string]*Rule
+	ruleStates   RuleStateStorage
+
+	// controls with history by specs
+	historyTrackers map[ControlSpec]*historyTracker
+	historyMtx      sync.Mutex
+	historyStorage  ControlHistoryStorage
+
+	// default time zone of cron rules,
+	// accessed from the sync loop only
+	cronLocation *time.Location
+
+	exportMetrics bool
+	scriptMetrics *metrics.Set
+	syncQueueWait *metrics.Histogram
+
+	// sync queue wait of the handler being currently
+	// executed, accessed from the sync loop only
+	syncWait       time.Duration
+	syncWaitActive bool
+
+	callbackBudget     time.Duration
+	callbackViolations int
+	callbackTimeouts   *metrics.Counter
+
+	jsonLog  bool
+	logRing  *LogRing
+	logSinks *LogSinks
+
+	// log levels of scripts and modules, see SetLogLevel()
+	logLevelsMtx sync.RWMutex
+	logLevels    map[string]EngineLogLevel
+
 	deviceProxyCache sync.Map
 
 	// subscriptions to control change events
@@ -692,7 +831,7 @@ func NewRuleEngine(driver wbgong.Driver, mqtt wbgong.MQTTClient, options *RuleEn
 		mqttClient:            mqtt,
 		driver:                driver,
 		driverReadyCh:         nil,
-		timerFunc:             newTimer,
+		clock:                 options.clock,
 		nextTimerId:           1,
 		timers:                make(map[TimerId]*TimerEntry),
 		callbackIndex:         1,
@@ -705,22 +844,29 @@ func NewRuleEngine(driver wbgong.Driver, mqtt wbgong.MQTTClient, options *RuleEn
 		rulesWithoutControls:  make(map[*Rule]bool),
 		timerRules:            make(map[string][]*Rule),
 		currentTimer:          NO_TIMER_NAME,
-		cronMaker: func() Cron {
-			// There are two cron spec formats in common usage:
-			// - Standard: "minute hour dom month dow"
-			// - Quartz: "second minute hour dom month dow [year]"
-			// cron.v1 default format was incompatible with both of these formats: "second minute hour dom month [dow]".
-			// cron.v3 default format is Standard.
-			// Use original format here for backward compatibility.
-			return cron.New(cron.WithParser(cron.NewParser(
-				cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.DowOptional | cron.Descriptor)))
+		cron:                  nil,
+		debugEnabled:          ATOMIC_FALSE,
+		readyCh:               nil,
+		uninitializedRules:    make([]*Rule, 0, ENGINE_UNINITIALIZED_RULES_CAPACITY),
+		cleanupOnStop:         options.cleanupOnStop,
+		traceCapacity:         options.traceCapacity,
+		location:              options.location,
+		exportMetrics:         options.exportMetrics,
+		callbackBudget:        options.callbackBudget,
+		callbackViolations:    options.callbackViolations,
+		jsonLog:               options.jsonLog,
+		logRing:               options.logRing,
+		logSinks:              options.logSinks,
+		logLevels:             make(map[string]EngineLogLevel),
+		cronLocation:          time.Local,
+		ruleSwitches:          make(map[string]*Rule),
+		historyTrackers:       make(map[ControlSpec]*historyTracker),
+		tracks:                make(map[string]map[uint32]MqttTracker),
+		eventBufferOptions: EventBufferOptions{
+			Capacity: options.eventBufferCapacity,
+			Policy:   options.eventOverflowPolicy,
+			Coalesce: options.eventCoalescing,
 		},
-		cron:               nil,
-		debugEnabled:       ATOMIC_FALSE,
-		readyCh:            nil,
-		uninitializedRules: make([]*Rule, 0, ENGINE_UNINITIALIZED_RULES_CAPACITY),
-		cleanupOnStop:      options.cleanupOnStop,
-		tracks:             make(map[string]map[uint32]MqttTracker),
 
 		controlChangeSubs: make([]chan *ControlChangeEvent, 0, ENGINE_CONTROL_CHANGE_SUBS_CAPACITY),
 	}
@@ -756,7 +902,17 @@ func NewRuleEngine(driver wbgong.Driver, mqtt wbgong.MQTTClient, options *RuleEn
 	s.NewGauge("wbrules_engine_device_proxy_cache_total", func() float64 {
 		return float64(engine.GetDeviceProxyCacheSize())
 	})
-	metrics.RegisterSet(s)
+	s.NewGauge("wbrules_engine_events_capacity_total", func() float64 {
+		return float64(engine.eventBufferOptions.Capacity)
+	})
+	engine.eventBufferOptions.Dropped = s.NewCounter("wbrules_engine_events_dropped_total")
+	engine.eventBufferOptions.Coalesced = s.NewCounter("wbrules_engine_events_coalesced_total")
+	engine.syncQueueWait = s.NewHistogram("wbrules_engine_sync_queue_wait_seconds")
+	engine.callbackTimeouts = s.NewCounter("wbrules_engine_callback_timeouts_total")
+	engine.registerMetrics(s)
+
+	engine.scriptMetrics = metrics.NewSet()
+	engine.registerMetrics(engine.scriptMetrics)
 
 	return
 }
@@ -829,6 +985,23 @@ func (engine *RuleEngine) processEvent(event *ControlChangeEvent) {
 	if engine.isDebugControl(event.Spec) {
 		engine.updateDebugEnabled()
 	}
+	if engine.isTimezoneControl(event.Spec) {
+		engine.CallSync(func() {
+			if engine.updateCronLocation() {
+				engine.setupCron()
+			}
+		})
+	}
+	if engine.isRuleSwitchControl(event.Spec) {
+		engine.CallSync(func() {
+			engine.updateRuleFromSwitch(event.Spec.ControlId)
+		})
+	}
+	if engine.isHistoryControl(event.Spec) {
+		engine.CallSync(func() {
+			engine.recordHistory(event.Spec, event.Value)
+		})
+	}
 
 	engine.CallSync(func() {
 		engine.RunRules(event, NO_TIMER_NAME)
@@ -866,7 +1039,10 @@ ReadyWaitLoop:
 		}
 	}
 	wbgong.Debug.Printf("setting up cron")
-	engine.CallSync(engine.setupCron)
+	engine.CallSync(func() {
+		engine.updateCronLocation()
+		engine.setupCron()
+	})
 
 	// the first rule run is removed, now it's all done with the first real event
 
@@ -907,13 +1083,14 @@ func (engine *RuleEngine) driverEventHandler(event wbgong.DriverEvent) {
 	var value, prevValue any
 
 	var spec ControlSpec
-	var isComplete, isRetained bool
+	var isComplete, isRetained, isLocal bool
 	var controlType string
 
 	switch e := event.(type) {
 	case wbgong.ControlValueEvent:
 		ctrl := e.Control
 		spec = ControlSpec{ctrl.GetDevice().GetId(), ctrl.GetId()}
+		_, isLocal = ctrl.GetDevice().(wbgong.LocalDevice)
 
 		var err error
 
@@ -975,6 +1152,7 @@ func (engine *RuleEngine) driverEventHandler(event wbgong.DriverEvent) {
 		ControlType: controlType,
 		IsComplete:  isComplete,
 		IsRetained:  isRetained,
+		IsLocal:     isLocal,
 		Value:       value,
 		PrevValue:   prevValue,
 	}
@@ -982,7 +1160,23 @@ func (engine *RuleEngine) driverEventHandler(event wbgong.DriverEvent) {
 	engine.eventBuffer.PushEvent(cce)
 }
 
+// measureSyncWait wraps the thunk to measure
+// the time it spends in the sync queue
+func (engine *RuleEngine) measureSyncWait(thunk func()) func() {
+	queued := time.Now()
+	return func() {
+		engine.syncQueueWait.UpdateDuration(queued)
+		prevWait, prevActive := engine.syncWait, engine.syncWaitActive
+		engine.syncWait, engine.syncWaitActive = time.Since(queued), true
+		defer func() {
+			engine.syncWait, engine.syncWaitActive = prevWait, prevActive
+		}()
+		thunk()
+	}
+}
+
 func (engine *RuleEngine) CallSync(thunk func()) {
+	thunk = engine.measureSyncWait(thunk)
 	if atomic.LoadUint32(&engine.debugEnabled) == ATOMIC_TRUE {
 		delay := time.NewTimer(ENGINE_CALLSYNC_TIMEOUT)
 		select {
@@ -1029,6 +1223,15 @@ func (engine *RuleEngine) setupRuleEngineSettingsDevice() {
 				"type":  "switch",
 				"value": atomic.LoadUint32(&engine.debugEnabled),
 			},
+			RULE_TIMEZONE_CELL_NAME: objx.Map{
+				"title": objx.Map{
+					"en": RULE_TIMEZONE_CELL_NAME,
+					"ru": RULE_TIMEZONE_CELL_NAME_RU,
+				},
+				"type":     "text",
+				"value":    "",
+				"readonly": false,
+			},
 		},
 	})
 	if err != nil {
@@ -1036,12 +1239,28 @@ func (engine *RuleEngine) setupRuleEngineSettingsDevice() {
 	}
 }
 
-func (engine *RuleEngine) SetTimerFunc(timerFunc TimerFunc) {
-	engine.timerFunc = timerFunc
+// SetEventJournal enables recording of all the control
+// change events passing through the engine to the journal
+func (engine *RuleEngine) SetEventJournal(journal *EventJournal) {
+	engine.eventJournal = journal
+	if engine.eventBuffer != nil {
+		engine.eventBuffer.SetJournal(journal)
+	}
+}
+
+// SetRuleStateStorage sets the storage for the states of switchable rules
+func (engine *RuleEngine) SetRuleStateStorage(storage RuleStateStorage) {
+	engine.ruleStates = storage
 }
 
-func (engine *RuleEngine) SetCronMaker(cronMaker func() Cron) {
-	engine.cronMaker = cronMaker
+// SetControlHistoryStorage sets the storage for the history of controls
+func (engine *RuleEngine) SetControlHistoryStorage(storage ControlHistoryStorage) {
+	engine.historyStorage = storage
+}
+
+// Clock returns the clock that drives timers and cron rules of the engine
+func (engine *RuleEngine) Clock() Clock {
+	return engine.clock
 }
 
 func (engine *RuleEngine) SetUninitializedRule(rule *Rule) {
@@ -1258,7 +1477,7 @@ func (engine *RuleEngine) RunRules(ctrlEvent *ControlChangeEvent, timerName stri
 	engine.rulesMutex.Unlock()
 
 	for _, rule := range rulesToRun {
-		rule.Check(ctrlEvent)
+		rule.Check(ctrlEvent, timerName)
 	}
 	engine.currentTimer = NO_TIMER_NAME
 }
@@ -1268,7 +1487,7 @@ func (engine *RuleEngine) setupCron() {
 		engine.cron.Stop()
 	}
 
-	engine.cron = newCronProxy(engine.cronMaker(), engine.CallSync)
+	engine.cron = newCronProxy(engine.clock.NewCron(engine.cronLocation), engine.CallSync)
 	// note for rule reloading: will need to restart cron
 	// to reload rules properly
 	func() {
@@ -1312,6 +1531,48 @@ func (engine *RuleEngine) isDebugControl(ctrlSpec ControlSpec) bool {
 		ctrlSpec.ControlId == RULE_DEBUG_CELL_NAME
 }
 
+func (engine *RuleEngine) isTimezoneControl(ctrlSpec ControlSpec) bool {
+	return ctrlSpec.DeviceId == RULE_ENGINE_SETTINGS_DEV_NAME &&
+		ctrlSpec.ControlId == RULE_TIMEZONE_CELL_NAME
+}
+
+// updateCronLocation reads the default time zone of cron rules
+// from the settings device. Empty value means the system time zone.
+// Returns true if the time zone is changed.
+// Must be called from the sync loop
+func (engine *RuleEngine) updateCronLocation() bool {
+	var tz string
+	err := engine.driver.Access(func(tx wbgong.DriverTx) error {
+		dev := tx.GetDevice(RULE_ENGINE_SETTINGS_DEV_NAME)
+		if dev == nil {
+			return ControlNotFoundError
+		}
+		ctrl := dev.GetControl(RULE_TIMEZONE_CELL_NAME)
+		if ctrl == nil {
+			return ControlNotFoundError
+		}
+		tz = ctrl.GetRawValue()
+		return nil
+	})
+	if err != nil {
+		return false
+	}
+
+	loc := time.Local
+	if tz = strings.TrimSpace(tz); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			engine.Logf(ENGINE_LOG_ERROR, "invalid cron time zone %q: %s", tz, err)
+			return false
+		}
+	}
+	if loc.String() == engine.cronLocation.String() {
+		return false
+	}
+	engine.cronLocation = loc
+	engine.Logf(ENGINE_LOG_INFO, "cron time zone is set to %s", loc)
+	return true
+}
+
 func (engine *RuleEngine) updateDebugEnabled() {
 	engine.CallSync(func() {
 		var val bool
@@ -1347,7 +1608,8 @@ func (engine *RuleEngine) updateDebugEnabled() {
 func (engine *RuleEngine) Start() {
 	engine.readyCh = make(chan struct{})
 	engine.driverReadyCh = make(chan struct{}, 1)
-	engine.eventBuffer = NewEventBuffer()
+	engine.eventBuffer = NewEventBuffer(engine.eventBufferOptions)
+	engine.eventBuffer.SetJournal(engine.eventJournal)
 
 	engine.driver.OnDriverEvent(engine.driverEventHandler)
 	engine.driver.OnRetainReady(func(tx wbgong.DriverTx) {
@@ -1418,7 +1680,7 @@ func (engine *RuleEngine) StartTimer(name string, callback func(), interval time
 		entry.quitted = make(chan struct{})
 
 		engine.getTimerMtx.Lock()
-		entry.timer = engine.timerFunc(n, interval, periodic)
+		entry.timer = engine.clock.NewTimer(n, interval, periodic)
 		engine.getTimerMtx.Unlock()
 
 		tickCh := entry.timer.GetChannel()
@@ -1439,7 +1701,7 @@ func (engine *RuleEngine) StartTimer(name string, callback func(), interval time
 					// exit immediately on quit signal
 					// timer may block here if you try to use classic CallSync
 					select {
-					case engine.syncQueue <- entryFunc:
+					case engine.syncQueue <- engine.measureSyncWait(entryFunc):
 					case <-entry.quit:
 						entry.timer.Stop()
 						close(entry.quitted)
@@ -1474,90 +1736,59 @@ func (engine *RuleEngine) Publish(topic, payload string, qos byte, retain bool)
 	})
 }
 
+// fillControlArgs validates the control definition
+// and fills in the control args
 func fillControlArgs(devId, ctrlId string, ctrlDef objx.Map, args wbgong.ControlArgs) error {
-	// fill in control args
-	//
-	// try to get type
-	ctrlTypeRaw, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_TYPE]
-	if !ok {
-		return fmt.Errorf("%s/%s: no control type", devId, ctrlId)
+	v := &descriptorValidation{}
+	validateControlDescriptor(v, devId, ctrlId, ctrlDef)
+	if err := v.err(); err != nil {
+		return err
+	}
+	setControlArgs(ctrlDef, args)
+	return nil
+}
+
+// descriptorTitle converts the title of the validated descriptor
+func descriptorTitle(title any) wbgong.Title {
+	titleMap := make(wbgong.Title)
+	if str, ok := title.(string); ok {
+		titleMap["en"] = str
+		return titleMap
 	}
-	ctrlType, ok := ctrlTypeRaw.(string)
-	if !ok {
-		return fmt.Errorf("%s/%s: non-string control type", devId, ctrlId)
+	m, _ := descriptorMap(title)
+	for key, value := range m {
+		if str, ok := value.(string); ok {
+			titleMap[key] = str
+		}
 	}
+	return titleMap
+}
+
+// setControlArgs fills in the control args
+// from the validated control definition
+func setControlArgs(ctrlDef objx.Map, args wbgong.ControlArgs) {
+	ctrlType := ctrlDef[VDEV_CONTROL_DESCR_PROP_TYPE].(string)
 	args.SetType(ctrlType)
 
 	// get 'forceDefault' metaproperty
-	forceDefault := false
-	forceDefaultRaw, hasForceDefault := ctrlDef[VDEV_CONTROL_DESCR_PROP_FORCEDEFAULT]
-	if hasForceDefault {
-		ok := false
-		forceDefault, ok = forceDefaultRaw.(bool)
-		if !ok {
-			return fmt.Errorf("%s/%s: non-boolean value of forceDefault propery",
-				devId, ctrlId)
-		}
-	}
+	forceDefault, _ := ctrlDef[VDEV_CONTROL_DESCR_PROP_FORCEDEFAULT].(bool)
 	args.SetDoLoadPrevious(!forceDefault)
 
 	// get 'lazyInit' metaproperty
-	lazyInit := false
-	lazyInitRaw, hasLazyInit := ctrlDef[VDEV_CONTROL_DESCR_PROP_LAZYINIT]
-	if hasLazyInit {
-		ok := false
-		lazyInit, ok = lazyInitRaw.(bool)
-		if !ok {
-			return fmt.Errorf("%s/%s: non-boolean value of lazyInit propery",
-				devId, ctrlId)
-		}
-	}
+	lazyInit, _ := ctrlDef[VDEV_CONTROL_DESCR_PROP_LAZYINIT].(bool)
 	args.SetLazyInit(lazyInit)
 
-	ctrlValue, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_VALUE]
-	if !ok && ctrlType != "pushbutton" { // FIXME: awful, need some special checkers
-		return fmt.Errorf("%s/%s: control value required for control type %s",
-			devId, ctrlId, ctrlType)
-	}
-
 	// get 'order' property
-	orderValue, hasOrder := ctrlDef[VDEV_CONTROL_DESCR_PROP_ORDER]
-	if hasOrder {
-		order, ok := orderValue.(float64)
-		if !ok {
-			return fmt.Errorf("%s/%s: non-number value of order property, has %T",
-				devId, ctrlId, orderValue)
-		}
-		if order < 0 {
-			return fmt.Errorf("%s/%s: invalid order value, must be int >= 0",
-				devId, ctrlId)
-		}
-		args.SetOrder(int(order))
+	if order, hasOrder := ctrlDef[VDEV_CONTROL_DESCR_PROP_ORDER]; hasOrder {
+		args.SetOrder(int(order.(float64)))
 	}
 
 	// set control value itself
-	args.SetValue(ctrlValue)
-
-	_, hasWritable := ctrlDef[VDEV_CONTROL_DESCR_PROP_WRITEABLE]
-	if hasWritable {
-		return fmt.Errorf("writeable flag is deprecated, use readonly instead: https://github.com/wirenboard/wb-rules/blob/master/README-readonly.md")
-	}
-
-	// get readonly/writeable flag
-	ctrlReadonly := VDEV_CONTROL_READONLY_DEFAULT
-
-	ctrlReadonlyRaw, hasReadonly := ctrlDef[VDEV_CONTROL_DESCR_PROP_READONLY]
-	if hasReadonly {
-		ctrlReadonly, ok = ctrlReadonlyRaw.(bool)
-		if !ok {
-			return fmt.Errorf("%s/%s: non-boolean value of 'readonly' property",
-				devId, ctrlId)
-		}
-	}
+	args.SetValue(ctrlDef[VDEV_CONTROL_DESCR_PROP_VALUE])
 
 	// set readonly flag
-	if hasReadonly {
-		args.SetReadonly(ctrlReadonly)
+	if ctrlReadonly, hasReadonly := ctrlDef[VDEV_CONTROL_DESCR_PROP_READONLY]; hasReadonly {
+		args.SetReadonly(ctrlReadonly.(bool))
 		// switch, pushbutton,range, rgb are writable by default
 	} else if ctrlType == wbgong.CONV_TYPE_SWITCH {
 		args.SetReadonly(false)
@@ -1568,56 +1799,30 @@ func fillControlArgs(devId, ctrlId string, ctrlDef objx.Map, args wbgong.Control
 	} else if ctrlType == wbgong.CONV_TYPE_RGB {
 		args.SetReadonly(false)
 	} else { // all other types is readonly by default
-		args.SetReadonly(ctrlReadonly)
+		args.SetReadonly(VDEV_CONTROL_READONLY_DEFAULT)
 	}
 
 	if ctrlType == wbgong.CONV_TYPE_VALUE {
-		units, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_UNITS]
-		if ok {
-			funits, ok := units.(string)
-			if !ok {
-				return fmt.Errorf("%s/%s: non-string value of units property",
-					devId, ctrlId)
-			}
-			args.SetUnits(funits)
+		if units, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_UNITS]; ok {
+			args.SetUnits(units.(string))
 		}
 	}
 
 	if ctrlType == wbgong.CONV_TYPE_VALUE || ctrlType == wbgong.CONV_TYPE_RANGE {
-		prec, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_PRECISION]
-		if ok {
-			fprec, ok := prec.(float64)
-			if !ok {
-				return fmt.Errorf("%s/%s: non-numeric value of precision property",
-					devId, ctrlId)
-			}
-			args.SetPrecision(fprec)
+		if prec, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_PRECISION]; ok {
+			args.SetPrecision(prec.(float64))
 		}
 	}
 
 	if ctrlType == wbgong.CONV_TYPE_VALUE || ctrlType == wbgong.CONV_TYPE_TEXT {
-		enum, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_ENUM]
-		if ok {
-			var enumTitlesMap map[string]wbgong.Title
-
-			switch t := enum.(type) {
-			case map[string]any:
-				enumTitlesMap = make(map[string]wbgong.Title)
-				for key, value := range t {
-					if submap, ok := value.(map[string]any); ok {
-						titleMap := make(wbgong.Title)
-						for lang, title := range submap {
-							if str, ok := title.(string); ok {
-								titleMap[lang] = str
-							}
-						}
-						enumTitlesMap[key] = titleMap
-					}
+		if enum, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_ENUM]; ok {
+			enumMap, _ := descriptorMap(enum)
+			enumTitlesMap := make(map[string]wbgong.Title)
+			for key, value := range enumMap {
+				if _, ok := descriptorMap(value); ok {
+					enumTitlesMap[key] = descriptorTitle(value)
 				}
-			default:
-				return fmt.Errorf("%s/%s: non-map value type %T of enum property", devId, ctrlId, enum)
 			}
-
 			args.SetEnumTitles(enumTitlesMap)
 		}
 	}
@@ -1627,62 +1832,19 @@ func fillControlArgs(devId, ctrlId string, ctrlDef objx.Map, args wbgong.Control
 		args.SetMin(VDEV_CONTROL_RANGE_MIN_DEFAULT)
 	}
 	if ctrlType == wbgong.CONV_TYPE_RANGE || ctrlType == wbgong.CONV_TYPE_VALUE {
-		max, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_MAX]
-		if ok {
-			fmax, ok := max.(float64)
-			if !ok {
-				return fmt.Errorf("%s/%s: non-numeric value of max property",
-					devId, ctrlId)
-			}
-			args.SetMax(fmax)
+		if max, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_MAX]; ok {
+			args.SetMax(max.(float64))
 		}
-
-		min, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_MIN]
-		if ok {
-			fmin, ok := min.(float64)
-			if !ok {
-				return fmt.Errorf("%s/%s: non-numeric value of min property",
-					devId, ctrlId)
-			}
-			args.SetMin(fmin)
+		if min, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_MIN]; ok {
+			args.SetMin(min.(float64))
 		}
 	}
 	if descr, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_DESCRIPTION]; ok {
-		if fdescr, okString := descr.(string); okString {
-			args.SetDescription(fdescr)
-		} else {
-			return fmt.Errorf("%s/%s: non-string value of description property",
-				devId, ctrlId)
-		}
+		args.SetDescription(descr.(string))
 	}
 	if title, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_TITLE]; ok {
-		var titleMap wbgong.Title
-
-		switch t := title.(type) {
-		case map[string]any:
-			titleMap = make(wbgong.Title)
-			for key, value := range t {
-				if str, ok := value.(string); ok {
-					titleMap[key] = str
-				}
-			}
-		case objx.Map:
-			titleMap = make(wbgong.Title)
-			for key, value := range t {
-				if str, ok := value.(string); ok {
-					titleMap[key] = str
-				}
-			}
-		case string:
-			titleMap = make(wbgong.Title)
-			titleMap["en"] = t
-		default:
-			return fmt.Errorf("%s/%s: non-string/non-map value type %T of title property", devId, ctrlId, title)
-		}
-
-		args.SetTitle(titleMap)
+		args.SetTitle(descriptorTitle(title))
 	}
-	return nil
 }
 
 func (engine *RuleEngine) RemoveControl(devID, ctrlID string) error {
@@ -1704,6 +1866,7 @@ func (engine *RuleEngine) RemoveControl(devID, ctrlID string) error {
 	if errAccess != nil {
 		return errAccess
 	}
+	engine.untrackHistory(ControlSpec{devID, ctrlID})
 	return nil
 }
 
@@ -1715,6 +1878,14 @@ func (engine *RuleEngine) AddControl(devID, ctrlID string, ctrlDef objx.Map) err
 	if errFill != nil {
 		return errFill
 	}
+	history, err := parseHistorySpec(devID, ctrlID, ctrlDef)
+	if err != nil {
+		return err
+	}
+	// don't leave the control created if its history can't be recorded
+	if history != nil && engine.historyStorage == nil {
+		return fmt.Errorf("%s/%s: %w", devID, ctrlID, errHistoryDisabled)
+	}
 	// create virtual device using collected descriptions
 
 	errAccess := engine.driver.Access(func(tx wbgong.DriverTx) (err error) {
@@ -1735,6 +1906,9 @@ func (engine *RuleEngine) AddControl(devID, ctrlID string, ctrlDef objx.Map) err
 	if errAccess != nil {
 		return errAccess
 	}
+	if history != nil {
+		return engine.trackHistory(ControlSpec{devID, ctrlID}, history)
+	}
 	return nil
 }
 
@@ -1761,10 +1935,9 @@ func (engine *RuleEngine) DefineVirtualDevice(devId string, obj objx.Map) error
 		return nil
 	}
 
-	// determine cells/control property name
-	controlsProp := VDEV_DESCR_PROP_CONTROLS
-	if obj.Has(VDEV_DESCR_PROP_CELLS) {
-		controlsProp = VDEV_DESCR_PROP_CELLS
+	// check the whole description, all the problems are reported at once
+	if err := validateDeviceDescriptor(devId, obj).err(); err != nil {
+		return err
 	}
 
 	// prepare whole description for this device
@@ -1772,44 +1945,11 @@ func (engine *RuleEngine) DefineVirtualDevice(devId string, obj objx.Map) error
 
 	// try to get title
 	if title, ok := obj[VDEV_DESCR_PROP_TITLE]; ok {
-		var titleMap wbgong.Title
-
-		switch t := title.(type) {
-		case map[string]any:
-			titleMap = make(wbgong.Title)
-			for key, value := range t {
-				if str, ok := value.(string); ok {
-					titleMap[key] = str
-				}
-			}
-		case objx.Map:
-			titleMap = make(wbgong.Title)
-			for key, value := range t {
-				if str, ok := value.(string); ok {
-					titleMap[key] = str
-				}
-			}
-		case string:
-			titleMap = make(wbgong.Title)
-			titleMap["en"] = t
-		default:
-			return fmt.Errorf("%s: non-string/non-map value type %T of title property", devId, title)
-		}
-
-		devArgs.SetTitle(titleMap)
+		devArgs.SetTitle(descriptorTitle(title))
 	}
 
 	// get controls list
-	v := obj.Get(controlsProp)
-	var m objx.Map
-	switch {
-	case v.IsObjxMap():
-		m = v.ObjxMap()
-	case v.IsMSI():
-		m = objx.Map(v.MSI())
-	default:
-		return fmt.Errorf("device %s doesn't have proper 'controls' or 'cells' property", devId)
-	}
+	m, _, _ := deviceControls(obj)
 
 	// Sorting controls by their names is not important when defining device
 	// while the engine is not active because all the cells will be published
@@ -1824,18 +1964,10 @@ func (engine *RuleEngine) DefineVirtualDevice(devId string, obj objx.Map) error
 	sort.Strings(controlIds)
 
 	controlsArgs := make([]wbgong.ControlArgs, 0, len(m))
+	histories := make(map[string]*HistorySpec)
 
 	for _, ctrlId := range controlIds {
-		// check if this object is a correct control definition (is an object, at least)
-		maybeCtrlDef := m[ctrlId]
-		ctrlDef, ok := maybeCtrlDef.(objx.Map)
-		if !ok {
-			cd, ok := maybeCtrlDef.(map[string]any)
-			if !ok {
-				return fmt.Errorf("%s/%s: bad control definition", devId, ctrlId)
-			}
-			ctrlDef = objx.Map(cd)
-		}
+		ctrlDef, _ := descriptorMap(m[ctrlId])
 
 		// create control args
 		args := wbgong.NewControlArgs().SetId(ctrlId)
@@ -1844,9 +1976,17 @@ func (engine *RuleEngine) DefineVirtualDevice(devId string, obj objx.Map) error
 		controlsArgs = append(controlsArgs, args)
 
 		// fill in control args
-		errFill := fillControlArgs(devId, ctrlId, ctrlDef, args)
-		if errFill != nil {
-			return errFill
+		setControlArgs(ctrlDef, args)
+
+		history, err := parseHistorySpec(devId, ctrlId, ctrlDef)
+		if err != nil {
+			return err
+		}
+		if history != nil {
+			if engine.historyStorage == nil {
+				return fmt.Errorf("%s/%s: %w", devId, ctrlId, errHistoryDisabled)
+			}
+			histories[ctrlId] = history
 		}
 	}
 
@@ -1886,22 +2026,49 @@ func (engine *RuleEngine) DefineVirtualDevice(devId string, obj objx.Map) error
 		}
 	})
 
-	return err
+	for _, ctrlId := range controlIds {
+		if history, found := histories[ctrlId]; found {
+			if err := engine.trackHistory(ControlSpec{devId, ctrlId}, history); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 func (engine *RuleEngine) DefineRule(rule *Rule, ctx *ESContext) (id RuleId, err error) {
 	engine.rulesMutex.Lock()
 	defer engine.rulesMutex.Unlock()
 
+	if rule.switchable {
+		if err = engine.checkRuleSwitch(rule); err != nil {
+			return
+		}
+	}
+
 	// for named rule - check for redefinition
 	if err = ctx.AddRule(rule.name, rule); err != nil {
 		return
 	}
 
+	rule.SetTracer(engine)
+	if engine.traceCapacity > 0 {
+		rule.SetTrace(NewRuleTrace(engine.traceCapacity))
+	}
+	rule.SetMetrics(engine.newRuleMetrics(rule))
+
 	// needed for rules defined after initial file load, for instance in timers or other rules
 	rule.MaybeAddToCron(engine.cron)
 
-	engine.ruleList = append(engine.ruleList, rule.id)
+	// keep ruleList sorted, so rules are checked in the deterministic order
+	// regardless of the script loading order
+	pos := sort.Search(len(engine.ruleList), func(i int) bool {
+		return rule.RunsBefore(engine.ruleMap[engine.ruleList[i]])
+	})
+	engine.ruleList = append(engine.ruleList, 0)
+	copy(engine.ruleList[pos+1:], engine.ruleList[pos:])
+	engine.ruleList[pos] = rule.id
 
 	engine.ruleMap[rule.id] = rule
 
@@ -1910,6 +2077,8 @@ func (engine *RuleEngine) DefineRule(rule *Rule, ctx *ESContext) (id RuleId, err
 		defer engine.rulesMutex.Unlock()
 
 		delete(engine.ruleMap, rule.id)
+		ctx.RemoveRule(rule.name, rule)
+		rule.metrics.Unregister()
 		for i, id := range engine.ruleList {
 			if id == rule.id {
 				engine.ruleList = append(
@@ -1922,13 +2091,56 @@ func (engine *RuleEngine) DefineRule(rule *Rule, ctx *ESContext) (id RuleId, err
 		rule.Destroy()
 	})
 
+	if rule.switchable {
+		engine.addRuleSwitch(rule)
+	}
+
 	id = rule.id
 
-	wbgong.Debug.Printf("[ruleengine] defineRule(name='%s') ruleId=%d, cond %T(%v)", rule.name, id, rule.cond, rule.cond)
+	wbgong.Debug.Printf("[ruleengine] defineRule(name='%s') ruleId=%d, priority %d, cond %T(%v)", rule.name, id, rule.priority, rule.cond, rule.cond)
 
 	return
 }
 
+func (engine *RuleEngine) swapActiveTrace(entry *RuleTraceEntry) (prev *RuleTraceEntry) {
+	prev, engine.activeTrace = engine.activeTrace, entry
+	return
+}
+
+func (engine *RuleEngine) activeSyncWait() (time.Duration, bool) {
+	return engine.syncWait, engine.syncWaitActive
+}
+
+// TraceError attributes the error to the trace entry
+// of the rule being currently checked, if any
+func (engine *RuleEngine) TraceError(err ScriptError) {
+	if engine.activeTrace != nil && engine.activeTrace.Error == nil {
+		engine.activeTrace.Error = &err
+	}
+}
+
+// RuleTraces returns execution traces of all rules
+// or only of the rules with specified name
+func (engine *RuleEngine) RuleTraces(name string) []RuleTraceInfo {
+	engine.rulesMutex.Lock()
+	defer engine.rulesMutex.Unlock()
+
+	r := make([]RuleTraceInfo, 0, len(engine.ruleList))
+	for _, ruleId := range engine.ruleList {
+		rule := engine.ruleMap[ruleId]
+		if rule.trace == nil || (name != "" && rule.name != name) {
+			continue
+		}
+		r = append(r, RuleTraceInfo{
+			Id:      rule.id,
+			Name:    rule.name,
+			Script:  rule.script,
+			Entries: rule.trace.Entries(),
+		})
+	}
+	return r
+}
+
 // DefineMqttTracker creates new mqtt tracker and subscribe to specified topic if needed
 func (engine *RuleEngine) DefineMqttTracker(topic string, ctx *ESContext) (err error) {
 	engine.mqttTrackerMutex.Lock()
@@ -2033,25 +2245,7 @@ func (engine *RuleEngine) GetDeviceProxy(name string) *DeviceProxy {
 }
 
 func (engine *RuleEngine) Log(level EngineLogLevel, message string) {
-	var topicItem string
-	switch level {
-	case ENGINE_LOG_DEBUG:
-		wbgong.Debug.Printf("[rule debug] %s", message)
-		if atomic.LoadUint32(&engine.debugEnabled) != ATOMIC_TRUE {
-			return
-		}
-		topicItem = "debug"
-	case ENGINE_LOG_INFO:
-		wbgong.Info.Printf("[rule info] %s", message)
-		topicItem = "info"
-	case ENGINE_LOG_WARNING:
-		wbgong.Warn.Printf("[rule warning] %s", message)
-		topicItem = "warning"
-	case ENGINE_LOG_ERROR:
-		wbgong.Error.Printf("[rule error] %s", message)
-		topicItem = "error"
-	}
-	engine.Publish("/wbrules/log/"+topicItem, message, 1, false)
+	engine.WriteLog(LogRecord{Level: level, Message: message})
 }
 
 func (engine *RuleEngine) Logf(level EngineLogLevel, format string, v ...any) {
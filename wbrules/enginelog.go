@@ -0,0 +1,273 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	duktape "github.com/wirenboard/go-duktape"
+	"github.com/wirenboard/wbgong"
+)
+
+func (level EngineLogLevel) String() string {
+	switch level {
+	case ENGINE_LOG_DEBUG:
+		return "debug"
+	case ENGINE_LOG_INFO:
+		return "info"
+	case ENGINE_LOG_WARNING:
+		return "warning"
+	case ENGINE_LOG_ERROR:
+		return "error"
+	default:
+		return fmt.Sprintf("EngineLogLevel(%d)", int(level))
+	}
+}
+
+func (level EngineLogLevel) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+func (level *EngineLogLevel) UnmarshalText(text []byte) (err error) {
+	*level, err = ParseEngineLogLevel(string(text))
+	return
+}
+
+func ParseEngineLogLevel(s string) (EngineLogLevel, error) {
+	switch s {
+	case "debug":
+		return ENGINE_LOG_DEBUG, nil
+	case "info":
+		return ENGINE_LOG_INFO, nil
+	case "warning":
+		return ENGINE_LOG_WARNING, nil
+	case "error":
+		return ENGINE_LOG_ERROR, nil
+	default:
+		return 0, fmt.Errorf("invalid log level %q", s)
+	}
+}
+
+var errLogRingDisabled = errors.New("log ring is disabled")
+
+// LogRecord is a log message along with its origin.
+// Script and Line refer to the location in the script
+// under the source root, Module is the name of the module
+// the message comes from, Rule is the name of the rule
+// being executed, if any
+type LogRecord struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Level     EngineLogLevel `json:"level"`
+	Script    string         `json:"script,omitempty"`
+	Line      int            `json:"line,omitempty"`
+	Module    string         `json:"module,omitempty"`
+	Rule      string         `json:"rule,omitempty"`
+	Message   string         `json:"message"`
+}
+
+// WriteLog publishes the message to the plain topic of its level
+// and, if JSON log is enabled, the whole record to ENGINE_LOG_JSON_TOPIC.
+// The record is also stored in the log ring and written to the log sinks,
+// if any. If the log level
+// is set for the module or the script of the record, messages below
+// that level are dropped and debug messages are not affected by
+// the global debug switch
+func (engine *RuleEngine) WriteLog(record LogRecord) {
+	level, levelSet := engine.recordLogLevel(&record)
+	if levelSet && record.Level < level {
+		return
+	}
+
+	switch record.Level {
+	case ENGINE_LOG_DEBUG:
+		wbgong.Debug.Printf("[rule debug] %s", record.Message)
+		if !levelSet && atomic.LoadUint32(&engine.debugEnabled) != ATOMIC_TRUE {
+			return
+		}
+	case ENGINE_LOG_INFO:
+		wbgong.Info.Printf("[rule info] %s", record.Message)
+	case ENGINE_LOG_WARNING:
+		wbgong.Warn.Printf("[rule warning] %s", record.Message)
+	case ENGINE_LOG_ERROR:
+		wbgong.Error.Printf("[rule error] %s", record.Message)
+	}
+	engine.Publish(ENGINE_LOG_TOPIC_BASE+record.Level.String(), record.Message, 1, false)
+
+	if record.Timestamp.IsZero() {
+		record.Timestamp = engine.clock.Now()
+	}
+	if engine.logRing != nil {
+		engine.logRing.Push(record)
+	}
+	if engine.logSinks != nil {
+		engine.logSinks.Write(record)
+	}
+	if !engine.jsonLog {
+		return
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		wbgong.Error.Printf("failed to marshal log record: %s", err)
+		return
+	}
+	engine.Publish(ENGINE_LOG_JSON_TOPIC, string(data), 1, false)
+}
+
+// SetLogLevel sets the log level of the source, that is a script
+// (by its virtual path) or a module (by its name)
+func (engine *RuleEngine) SetLogLevel(source string, level EngineLogLevel) {
+	engine.logLevelsMtx.Lock()
+	engine.logLevels[source] = level
+	engine.logLevelsMtx.Unlock()
+	engine.Logf(ENGINE_LOG_INFO, "log level of %s is set to %s", source, level)
+}
+
+// ResetLogLevel makes the source use the default log level
+func (engine *RuleEngine) ResetLogLevel(source string) {
+	engine.logLevelsMtx.Lock()
+	_, found := engine.logLevels[source]
+	delete(engine.logLevels, source)
+	engine.logLevelsMtx.Unlock()
+	if found {
+		engine.Logf(ENGINE_LOG_INFO, "log level of %s is reset", source)
+	}
+}
+
+// LogLevels returns log levels of the sources they're set for
+func (engine *RuleEngine) LogLevels() map[string]EngineLogLevel {
+	engine.logLevelsMtx.RLock()
+	defer engine.logLevelsMtx.RUnlock()
+
+	r := make(map[string]EngineLogLevel, len(engine.logLevels))
+	for source, level := range engine.logLevels {
+		r[source] = level
+	}
+	return r
+}
+
+// recordLogLevel returns the log level set for the module
+// or, if it's not set, for the script of the record
+func (engine *RuleEngine) recordLogLevel(record *LogRecord) (level EngineLogLevel, found bool) {
+	if record.Module == "" && record.Script == "" {
+		return
+	}
+	engine.logLevelsMtx.RLock()
+	defer engine.logLevelsMtx.RUnlock()
+
+	if record.Module != "" {
+		if level, found = engine.logLevels[record.Module]; found {
+			return
+		}
+	}
+	if record.Script != "" {
+		level, found = engine.logLevels[record.Script]
+	}
+	return
+}
+
+// structuredLog returns true if log records need the script location
+func (engine *RuleEngine) structuredLog() bool {
+	if engine.jsonLog || engine.logRing != nil || engine.logSinks != nil {
+		return true
+	}
+	engine.logLevelsMtx.RLock()
+	defer engine.logLevelsMtx.RUnlock()
+	return len(engine.logLevels) > 0
+}
+
+// logLevelFiltered returns true if the records of the level are
+// dropped whatever their script or module is, so there's no need
+// to get their location. Only debug records may be dropped so
+func (engine *RuleEngine) logLevelFiltered(level EngineLogLevel) bool {
+	if level != ENGINE_LOG_DEBUG || atomic.LoadUint32(&engine.debugEnabled) == ATOMIC_TRUE {
+		return false
+	}
+	engine.logLevelsMtx.RLock()
+	defer engine.logLevelsMtx.RUnlock()
+	for _, l := range engine.logLevels {
+		if l <= level {
+			return false
+		}
+	}
+	return true
+}
+
+// QueryLog implements LogSource
+func (engine *RuleEngine) QueryLog(q *LogQuery) (*LogQueryResult, error) {
+	if engine.logRing == nil {
+		return nil, errLogRingDisabled
+	}
+	return engine.logRing.Query(q), nil
+}
+
+// scriptLogRecord makes a log record with the location of the innermost
+// frame of the traceback that belongs to a script under the source root
+// and the module of the innermost frame, if it's a module.
+// Must be called from the sync loop, as the rule is taken from the trace
+// entry of the rule being executed
+func (engine *ESEngine) scriptLogRecord(level EngineLogLevel, message string, traceback ESTraceback) LogRecord {
+	record := LogRecord{Level: level, Message: message}
+	if loc := engine.newScriptError(ESError{Traceback: traceback}).Traceback; len(loc) > 0 {
+		record.Script = loc[0].Name
+		record.Line = loc[0].Line
+	}
+	if len(traceback) > 0 {
+		record.Module, _ = engine.moduleName(traceback[0].filename)
+	}
+	if engine.activeTrace != nil && engine.activeTrace.rule != nil {
+		record.Rule = ruleMetricLabel(engine.activeTrace.rule)
+	}
+	return record
+}
+
+// moduleName returns the name of the module by its file path
+func (engine *ESEngine) moduleName(path string) (string, bool) {
+	for _, dir := range engine.modulesDirs {
+		if dir == "" {
+			continue
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || strings.HasPrefix(rel, "..") || !strings.HasSuffix(rel, ".js") {
+			continue
+		}
+		return strings.TrimSuffix(rel, ".js"), true
+	}
+	return "", false
+}
+
+// esLogSetLevel implements log.setLevel(level). It sets the log level
+// of the module or the script it's called from, null or undefined
+// level resets it to the default one
+func (engine *ESEngine) esLogSetLevel(ctx *ESContext) int {
+	if ctx.GetTop() > 1 {
+		return duktape.DUK_RET_ERROR
+	}
+	record := engine.scriptLogRecord(ENGINE_LOG_INFO, "", ctx.GetTraceback())
+	source := record.Module
+	if source == "" {
+		source = record.Script
+	}
+	if source == "" {
+		engine.Log(ENGINE_LOG_ERROR, "log.setLevel(): can't determine the script")
+		return duktape.DUK_RET_ERROR
+	}
+
+	if ctx.GetTop() == 0 || ctx.IsNullOrUndefined(-1) {
+		engine.ResetLogLevel(source)
+		return 0
+	}
+	if !ctx.IsString(-1) {
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+	level, err := ParseEngineLogLevel(ctx.GetString(-1))
+	if err != nil {
+		engine.Logf(ENGINE_LOG_ERROR, "log.setLevel(): %s", err)
+		return duktape.DUK_RET_RANGE_ERROR
+	}
+	engine.SetLogLevel(source, level)
+	return 0
+}
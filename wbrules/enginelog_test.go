@@ -0,0 +1,60 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRecordJSON(t *testing.T) {
+	data, err := json.Marshal(LogRecord{
+		Timestamp: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Level:     ENGINE_LOG_WARNING,
+		Script:    "heating.js",
+		Line:      14,
+		Rule:      "heater",
+		Message:   "too cold",
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"timestamp": "2026-10-17T12:00:00Z",
+		"level": "warning",
+		"script": "heating.js",
+		"line": 14,
+		"rule": "heater",
+		"message": "too cold"
+	}`, string(data))
+
+	// location and rule are omitted for engine messages
+	data, err = json.Marshal(LogRecord{
+		Timestamp: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Level:     ENGINE_LOG_INFO,
+		Message:   "engine started",
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"timestamp": "2026-10-17T12:00:00Z",
+		"level": "info",
+		"message": "engine started"
+	}`, string(data))
+}
+
+func TestLogLevelFiltered(t *testing.T) {
+	engine := &RuleEngine{logLevels: make(map[string]EngineLogLevel)}
+	assert.True(t, engine.logLevelFiltered(ENGINE_LOG_DEBUG))
+	assert.False(t, engine.logLevelFiltered(ENGINE_LOG_INFO))
+
+	engine.logLevels["heating.js"] = ENGINE_LOG_WARNING
+	assert.True(t, engine.logLevelFiltered(ENGINE_LOG_DEBUG))
+
+	// debug messages of the module are enabled
+	engine.logLevels["mymodule"] = ENGINE_LOG_DEBUG
+	assert.False(t, engine.logLevelFiltered(ENGINE_LOG_DEBUG))
+
+	delete(engine.logLevels, "mymodule")
+	engine.debugEnabled = ATOMIC_TRUE
+	assert.False(t, engine.logLevelFiltered(ENGINE_LOG_DEBUG))
+}
@@ -10,6 +10,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/stretchr/objx"
 	duktape "github.com/wirenboard/go-duktape"
@@ -31,6 +33,12 @@ type ESCallback uint64
 type ESCallbackFunc func(args objx.Map) any
 type ESCallbackErrorHandler func(err ESError)
 
+// ESWatchdogFunc is called after a callback has run longer than the
+// execution time budget. The traceback is the location where the
+// callback was interrupted, it's empty if the callback hasn't called
+// any native functions after the budget has been exceeded
+type ESWatchdogFunc func(ctx *ESContext, elapsed time.Duration, traceback ESTraceback)
+
 // ESSyncFunc denotes a function that executes the specified
 // thunk in the context of the goroutine which utilizes the context
 type ESSyncFunc func(thunk func())
@@ -57,21 +65,47 @@ type ESError struct {
 type ESContextFactory struct {
 	duktapeToESContextMap map[duktape.Context]*ESContext
 	callbackIndex         ESCallback
+
+	// callback execution watchdog, see watchCallback()
+	watchdogBudget   time.Duration
+	watchdogFunc     ESWatchdogFunc
+	callbackDepth    int
+	interrupt        *duktape.Interrupt
+	expiredTraceback ESTraceback
 }
 
 func newESContextFactory() *ESContextFactory {
 	return &ESContextFactory{
 		duktapeToESContextMap: make(map[duktape.Context]*ESContext),
 		callbackIndex:         1,
+		interrupt:             duktape.NewInterrupt(),
 	}
 }
 
+// destroy destroys the Duktape heap of the factory given its global
+// context and frees the interrupt. No contexts created by the
+// factory may be used after that
+func (f *ESContextFactory) destroy(globalCtx *ESContext) {
+	globalCtx.DestroyHeap()
+	f.interrupt.Free()
+	f.duktapeToESContextMap = make(map[duktape.Context]*ESContext)
+}
+
+// SetWatchdog sets the execution time budget of callbacks. After the
+// budget is exceeded the bytecode executor and any native function
+// called by the callback throw RangeError. Zero budget disables
+// the watchdog
+func (f *ESContextFactory) SetWatchdog(budget time.Duration, fn ESWatchdogFunc) {
+	f.watchdogBudget = budget
+	f.watchdogFunc = fn
+}
+
 func (err ESError) Error() string {
 	return err.Message
 }
 
 func (f *ESContextFactory) newESContext(syncFunc ESSyncFunc, filename string) *ESContext {
-	return f.newESContextFromDuktape(syncFunc, filename, duktape.NewContext())
+	return f.newESContextFromDuktape(syncFunc, filename, duktape.NewContextWithInterrupt(f.interrupt))
 }
 
 func (f *ESContextFactory) newESContextFromDuktape(syncFunc ESSyncFunc, filename string, dctx *duktape.Context) *ESContext {
@@ -306,6 +340,7 @@ func (ctx *ESContext) invokeCallback(key ESCallback, args objx.Map) any {
 	}
 	wbgong.Debug.Printf("trying to invoke callback %d in context %p\n", key, ctx)
 
+	defer ctx.watchCallback()()
 	ctx.PushHeapStash()
 
 	ctx.GetPropString(-1, ESCALLBACKS_OBJ_NAME)
@@ -317,7 +352,9 @@ func (ctx *ESContext) invokeCallback(key ESCallback, args objx.Map) any {
 	}
 	defer ctx.Pop3() // pop: result, callback list object, global stash
 	if s := ctx.PcallProp(-2-argCount, argCount); s != 0 {
-		ctx.callbackErrorHandler(ctx.GetESError())
+		err := ctx.GetESError()
+		ctx.noteExpiredError(err)
+		ctx.callbackErrorHandler(err)
 		return nil
 	} else if ctx.IsBoolean(-1) {
 		return ctx.ToBoolean(-1)
@@ -330,6 +367,69 @@ func (ctx *ESContext) invokeCallback(key ESCallback, args objx.Map) any {
 	}
 }
 
+// watchCallback arms the watchdog for the outermost callback
+// invocation and returns the function to be called after the
+// callback returns
+func (ctx *ESContext) watchCallback() func() {
+	f := ctx.factory
+	f.callbackDepth++
+	if f.callbackDepth > 1 || f.watchdogBudget <= 0 {
+		return func() {
+			f.callbackDepth--
+		}
+	}
+
+	// the timer function may still be running after Stop(),
+	// so make sure it doesn't set the interrupt after it's cleared
+	var mu sync.Mutex
+	armed := true
+	start := time.Now()
+	timer := time.AfterFunc(f.watchdogBudget, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if armed {
+			f.interrupt.Set()
+		}
+	})
+	return func() {
+		f.callbackDepth--
+		timer.Stop()
+		mu.Lock()
+		armed = false
+		f.interrupt.Clear()
+		mu.Unlock()
+		traceback := f.expiredTraceback
+		f.expiredTraceback = nil
+		if elapsed := time.Since(start); elapsed > f.watchdogBudget && f.watchdogFunc != nil {
+			f.watchdogFunc(ctx, elapsed, traceback)
+		}
+	}
+}
+
+// interruptExpired makes native functions throw when the callback
+// being executed has exceeded the time budget. The location of the
+// first interruption is remembered for the watchdog report
+func (ctx *ESContext) interruptExpired() bool {
+	f := ctx.factory
+	if !f.interrupt.IsSet() {
+		return false
+	}
+	if f.expiredTraceback == nil {
+		f.expiredTraceback = ctx.GetTraceback()
+	}
+	return true
+}
+
+// noteExpiredError remembers the location of the error thrown by
+// the bytecode executor when the callback has exceeded the time
+// budget without calling any native functions
+func (ctx *ESContext) noteExpiredError(err ESError) {
+	f := ctx.factory
+	if f.expiredTraceback == nil && f.interrupt.IsSet() {
+		f.expiredTraceback = err.Traceback
+	}
+}
+
 // storeCallback stores the callback from the specified stack index
 // (which should be >= 0) at 'key' in the callback list specified as propName.
 // If key is specified as nil, a new callback key is generated and returned
@@ -503,6 +603,9 @@ func (ctx *ESContext) DefineFunctions(fns map[string]func(*ESContext) int) {
 		factory := ctx.factory
 		ctx.PushGoFunc(func(dctx *duktape.Context) int {
 			if ctx, ok := factory.duktapeToESContextMap[*dctx]; ok {
+				if ctx.interruptExpired() {
+					return duktape.DUK_RET_RANGE_ERROR
+				}
 				return f(ctx)
 			}
 			wbgong.Error.Panicf("No known conversion for duktape context to ESContext from %v", dctx)
@@ -626,6 +729,14 @@ func (ctx *ESContext) AddRule(name string, rule *Rule) error {
 	}
 }
 
+// RemoveRule forgets the name of the removed rule,
+// so the rule can be defined again
+func (ctx *ESContext) RemoveRule(name string, rule *Rule) {
+	if ctx.ruleNames[name] == rule {
+		delete(ctx.ruleNames, name)
+	}
+}
+
 // TBD: handle loops in object graphs in PushJSObject
 // TBD: handle Go objects
 // TBD: handle buffers
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/objx"
 	"github.com/stretchr/testify/assert"
@@ -188,3 +189,78 @@ func TestInvokeCallbackOnInvalidContext(t *testing.T) {
 	})
 	assert.Nil(t, result)
 }
+
+func TestCallbackWatchdog(t *testing.T) {
+	f := newESContextFactory()
+	ctx := f.newESContext(nil, "")
+
+	var elapsed time.Duration
+	var traceback ESTraceback
+	reports := 0
+	f.SetWatchdog(50*time.Millisecond, func(ctx *ESContext, d time.Duration, tb ESTraceback) {
+		reports++
+		elapsed, traceback = d, tb
+	})
+	var cbErr *ESError
+	ctx.SetCallbackErrorHandler(func(err ESError) {
+		cbErr = &err
+	})
+	ctx.PushGlobalObject()
+	ctx.DefineFunctions(map[string]func(*ESContext) int{
+		"tick": func(ctx *ESContext) int {
+			return 0
+		},
+	})
+	ctx.Pop()
+
+	ctx.LoadScriptFromString("watchdog.js", "function loop() {\n  while (true) {\n    tick();\n  }\n}\n")
+	ctx.PevalString("(function () { loop(); })")
+	loop := ctx.storeCallback(-1)
+	ctx.Pop()
+	ctx.PevalString("(function () { tick(); return 'ok'; })")
+	quick := ctx.storeCallback(-1)
+	ctx.Pop()
+	ctx.LoadScriptFromString("pureloop.js",
+		"function pureLoop() {\n  while (true) {\n    try {\n      while (true) {}\n    } catch (e) {}\n  }\n}\n")
+	ctx.PevalString("(function () { pureLoop(); })")
+	pureLoop := ctx.storeCallback(-1)
+	ctx.Pop()
+
+	assert.Equal(t, "ok", ctx.invokeCallback(quick, nil))
+	assert.Equal(t, 0, reports)
+	assert.Nil(t, cbErr)
+
+	assert.Nil(t, ctx.invokeCallback(loop, nil))
+	assert.Equal(t, 1, reports)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	if assert.NotEmpty(t, traceback) {
+		assert.Equal(t, ESLocation{"watchdog.js", 3}, traceback[0])
+	}
+	if assert.NotNil(t, cbErr) {
+		assert.Contains(t, cbErr.Message, "RangeError")
+	}
+
+	// the watchdog is reset after the callback returns
+	cbErr = nil
+	assert.Equal(t, "ok", ctx.invokeCallback(quick, nil))
+	assert.Equal(t, 1, reports)
+	assert.Nil(t, cbErr)
+
+	// loops without native calls are interrupted by the executor,
+	// catch blocks can't prevent that
+	traceback = nil
+	assert.Nil(t, ctx.invokeCallback(pureLoop, nil))
+	assert.Equal(t, 2, reports)
+	assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+	if assert.NotEmpty(t, traceback) {
+		assert.Equal(t, "pureloop.js", traceback[0].filename)
+	}
+	if assert.NotNil(t, cbErr) {
+		assert.Contains(t, cbErr.Message, "RangeError")
+	}
+
+	cbErr = nil
+	assert.Equal(t, "ok", ctx.invokeCallback(quick, nil))
+	assert.Equal(t, 2, reports)
+	assert.Nil(t, cbErr)
+}
@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/DisposaBoy/JsonConfigReader"
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/stretchr/objx"
 	duktape "github.com/wirenboard/go-duktape"
 	"github.com/wirenboard/wbgong"
@@ -64,13 +65,26 @@ var (
 var searchDirs = []string{LIB_SYS_PATH}
 
 // cache for quicker filename hashing
-var filenameMd5s = make(map[string]string)
+var (
+	filenameMd5s    = make(map[string]string)
+	filenameMd5sMtx sync.Mutex
+)
 
 type ESEngineOptions struct {
 	*RuleEngineOptions
 	PersistentDBFile     string
 	PersistentDBFileMode os.FileMode
 	ModulesDirs          []string
+
+	QuarantineErrors int
+	QuarantineWindow time.Duration
+
+	// StorageSweepInterval is the period of removing expired
+	// persistent storage keys, zero disables the sweeper
+	StorageSweepInterval time.Duration
+
+	// Spawn runs external commands, Spawn() is used if it's not set
+	Spawn SpawnFunc
 }
 
 func NewESEngineOptions() *ESEngineOptions {
@@ -92,6 +106,24 @@ func (o *ESEngineOptions) SetModulesDirs(dirs []string) {
 	o.ModulesDirs = dirs
 }
 
+// SetScriptQuarantine makes a script be unloaded after maxErrors
+// runtime errors within the window. Zero maxErrors disables quarantine
+func (o *ESEngineOptions) SetScriptQuarantine(maxErrors int, window time.Duration) {
+	o.QuarantineErrors = maxErrors
+	o.QuarantineWindow = window
+}
+
+func (o *ESEngineOptions) SetStorageSweepInterval(interval time.Duration) {
+	o.StorageSweepInterval = interval
+}
+
+// SetSpawn replaces the function that runs external commands
+// for spawn() and runShellCommand() and thus for the modules using
+// them to send notifications and HTTP requests
+func (o *ESEngineOptions) SetSpawn(spawn SpawnFunc) {
+	o.Spawn = spawn
+}
+
 type TimerSet struct {
 	sync.Mutex
 	timers map[TimerId]bool
@@ -118,7 +150,37 @@ type ESEngine struct {
 	tracker           wbgong.ContentTracker
 	persistentDBCache map[string]string
 	persistentDB      *bolt.DB
-	modulesDirs       []string
+	// persistentTx is the storage transaction opened
+	// by PersistentStorage.transaction(), if any
+	persistentTx *bolt.Tx
+	// changes made within persistentTx
+	persistentTxChanges []storageChange
+	modulesDirs         []string
+	spawn               SpawnFunc
+
+	// PersistentStorage.onChange() callbacks by buckets
+	storageWatchers    map[string][]*storageWatcher
+	storageWatchersMtx sync.Mutex
+	// callbacks waiting to be called in the sync loop
+	storageNotifyQueue []func()
+	storageNotifying   bool
+	storageNotifyMtx   sync.Mutex
+	// quotas of the storages set by PersistentStorage() options
+	storageQuotas    map[string]StorageQuota
+	storageQuotasMtx sync.Mutex
+	storageEvicted   map[string]*metrics.Counter
+
+	// scripts are quarantined after quarantineErrors
+	// runtime errors within quarantineWindow
+	quarantineErrors int
+	quarantineWindow time.Duration
+
+	// virtual device templates by names and cleanup scopes of
+	// the devices created from them by device ids,
+	// accessed from the sync loop only
+	vdevTemplates     map[string]*VirtualDeviceTemplate
+	vdevInstances     map[string]string
+	nextInstanceScope int
 }
 
 func init() {
@@ -146,9 +208,21 @@ func NewESEngine(driver wbgong.Driver, logMqttClient wbgong.MQTTClient, options
 		tracker:           wbgong.NewContentTracker(),
 		persistentDBCache: make(map[string]string),
 		persistentDB:      nil,
+		storageWatchers:   make(map[string][]*storageWatcher),
+		storageQuotas:     make(map[string]StorageQuota),
+		vdevTemplates:     make(map[string]*VirtualDeviceTemplate),
+		vdevInstances:     make(map[string]string),
 		modulesDirs:       options.ModulesDirs,
+		spawn:             options.Spawn,
+		quarantineErrors:  options.QuarantineErrors,
+		quarantineWindow:  options.QuarantineWindow,
+	}
+	if engine.spawn == nil {
+		engine.spawn = Spawn
 	}
 	engine.globalCtx = engine.ctxFactory.newESContext(engine.MaybeCallSync, "")
+	engine.ctxFactory.SetWatchdog(engine.callbackBudget, engine.callbackWatchdog)
+	engine.initStorageMetrics()
 
 	if options.PersistentDBFile != "" {
 		if err = engine.SetPersistentDBMode(options.PersistentDBFile,
@@ -157,6 +231,11 @@ func NewESEngine(driver wbgong.Driver, logMqttClient wbgong.MQTTClient, options
 			// panic("error opening persistent DB file: " + err.Error())
 		}
 		engine.Log(ENGINE_LOG_INFO, fmt.Sprintf("using file %s for persistent DB", options.PersistentDBFile))
+		engine.SetRuleStateStorage(engine)
+		engine.SetControlHistoryStorage(engine)
+		if options.StorageSweepInterval > 0 {
+			engine.StartTimer(NO_TIMER_NAME, engine.SweepPersistentStorage, options.StorageSweepInterval, true)
+		}
 	}
 
 	engine.globalCtx.SetCallbackErrorHandler(engine.CallbackErrorHandler)
@@ -182,36 +261,45 @@ func NewESEngine(driver wbgong.Driver, logMqttClient wbgong.MQTTClient, options
 	engine.globalCtx.PushGlobalObject()
 
 	engine.globalCtx.DefineFunctions(map[string]func(*ESContext) int{
-		"format":               engine.esFormat,
-		"log":                  engine.makeLogFunc(ENGINE_LOG_INFO),
-		"debug":                engine.makeLogFunc(ENGINE_LOG_DEBUG),
-		"publish":              engine.esPublish,
-		"_wbDevObject":         engine.esWbDevObject,
-		"_wbCellObject":        engine.esWbCellObject,
-		"_wbStartTimer":        engine.esWbStartTimer,
-		"_wbStopTimer":         engine.esWbStopTimer,
-		"_wbCheckCurrentTimer": engine.esWbCheckCurrentTimer,
-		"_wbSpawn":             engine.esWbSpawn,
-		"_wbDefineRule":        engine.esWbDefineRule,
-		"runRules":             engine.esWbRunRules,
-		"readConfig":           engine.esReadConfig,
-		"_wbPersistentSet":     engine.esPersistentSet,
-		"_wbPersistentGet":     engine.esPersistentGet,
-		"disableRule":          engine.esWbDisableRule,
-		"enableRule":           engine.esWbEnableRule,
-		"runRule":              engine.esWbRunRule,
-		"defineVirtualDevice":  engine.esDefineVirtualDevice,
-		"getDevice":            engine.esGetDevice,
-		"getControl":           engine.esGetControl,
-		"_wbPersistentName":    engine.esPersistentName,
-		"trackMqtt":            engine.trackMqtt,
+		"format":                engine.esFormat,
+		"log":                   engine.makeLogFunc(ENGINE_LOG_INFO),
+		"debug":                 engine.makeLogFunc(ENGINE_LOG_DEBUG),
+		"publish":               engine.esPublish,
+		"_wbDevObject":          engine.esWbDevObject,
+		"_wbCellObject":         engine.esWbCellObject,
+		"_wbStartTimer":         engine.esWbStartTimer,
+		"_wbStopTimer":          engine.esWbStopTimer,
+		"_wbCheckCurrentTimer":  engine.esWbCheckCurrentTimer,
+		"_wbSpawn":              engine.esWbSpawn,
+		"_wbDefineRule":         engine.esWbDefineRule,
+		"runRules":              engine.esWbRunRules,
+		"readConfig":            engine.esReadConfig,
+		"_wbPersistentSet":      engine.esPersistentSet,
+		"_wbPersistentGet":      engine.esPersistentGet,
+		"disableRule":           engine.esWbDisableRule,
+		"enableRule":            engine.esWbEnableRule,
+		"runRule":               engine.esWbRunRule,
+		"defineVirtualDevice":   engine.esDefineVirtualDevice,
+		"getDevice":             engine.esGetDevice,
+		"getControl":            engine.esGetControl,
+		"_wbPersistentName":     engine.esPersistentName,
+		"_wbPersistentKeys":     engine.esPersistentKeys,
+		"_wbPersistentHas":      engine.esPersistentHas,
+		"_wbPersistentClear":    engine.esPersistentClear,
+		"_wbPersistentTx":       engine.esPersistentTransaction,
+		"_wbPersistentOnChange": engine.esPersistentOnChange,
+		"trackMqtt":             engine.trackMqtt,
+		"_wbDefineVdevTemplate": engine.esDefineVdevTemplate,
+		"_wbInstantiateVdev":    engine.esInstantiateVdev,
+		"_wbRemoveVdevInstance": engine.esRemoveVdevInstance,
 	})
 	engine.globalCtx.GetPropString(-1, "log")
 	engine.globalCtx.DefineFunctions(map[string]func(*ESContext) int{
-		"debug":   engine.makeLogFunc(ENGINE_LOG_DEBUG),
-		"info":    engine.makeLogFunc(ENGINE_LOG_INFO),
-		"warning": engine.makeLogFunc(ENGINE_LOG_WARNING),
-		"error":   engine.makeLogFunc(ENGINE_LOG_ERROR),
+		"debug":    engine.makeLogFunc(ENGINE_LOG_DEBUG),
+		"info":     engine.makeLogFunc(ENGINE_LOG_INFO),
+		"warning":  engine.makeLogFunc(ENGINE_LOG_WARNING),
+		"error":    engine.makeLogFunc(ENGINE_LOG_ERROR),
+		"setLevel": engine.esLogSetLevel,
 	})
 	engine.globalCtx.Pop()
 
@@ -359,6 +447,7 @@ func (engine *ESEngine) initVdevCellPrototype(ctx *ESContext) {
 		"getOrder":       engine.esVdevCellGetOrder,
 		"setValue":       engine.esVdevCellSetValue,
 		"getValue":       engine.esVdevCellGetValue,
+		"getHistory":     engine.esVdevCellGetHistory,
 	})
 
 	ctx.PutPropString(-2, "__wbVdevCellPrototype")
@@ -406,7 +495,8 @@ func (engine *ESEngine) makeControlObject(ctx *ESContext, devID, ctrlID string)
 
 // Engine callback error handler
 func (engine *ESEngine) CallbackErrorHandler(err ESError) {
-	engine.Log(ENGINE_LOG_ERROR, fmt.Sprintf("ECMAScript error: %v", err))
+	engine.TraceError(engine.newScriptError(err))
+	engine.WriteLog(engine.scriptLogRecord(ENGINE_LOG_ERROR, fmt.Sprintf("ECMAScript error: %v", err), err.Traceback))
 }
 
 func (engine *ESEngine) ScriptDir() string {
@@ -505,11 +595,124 @@ func (engine *ESEngine) buildWhenChangedRuleCondition(ctx *ESContext, defIndex i
 	return NewOrRuleCondition(conds), nil
 }
 
+// getDurationProp returns duration specified either as a number
+// of milliseconds or as a string like "1m30s"
+func (engine *ESEngine) getSignedDurationProp(ctx *ESContext, objIndex int, propName string) (d time.Duration, err error) {
+	ctx.GetPropString(objIndex, propName)
+	defer ctx.Pop()
+
+	switch {
+	case ctx.IsNumber(-1):
+		d = time.Duration(ctx.GetNumber(-1) * float64(time.Millisecond))
+	case ctx.IsString(-1):
+		if d, err = ParseDuration(ctx.GetString(-1)); err != nil {
+			return 0, fmt.Errorf("%s: %w", propName, err)
+		}
+	default:
+		return 0, fmt.Errorf("%s: number or string expected", propName)
+	}
+	return
+}
+
+func (engine *ESEngine) getDurationProp(ctx *ESContext, objIndex int, propName string) (d time.Duration, err error) {
+	if d, err = engine.getSignedDurationProp(ctx, objIndex, propName); err == nil && d < 0 {
+		return 0, fmt.Errorf("%s: negative duration", propName)
+	}
+	return
+}
+
+func (engine *ESEngine) buildCondFilterOptions(ctx *ESContext, defIndex int) (opts CondFilterOptions, err error) {
+	if ctx.HasPropString(defIndex, "hysteresis") {
+		opts.Hysteresis = engine.wrapRuleCondFunc(ctx, defIndex, "hysteresis")
+	}
+	if ctx.HasPropString(defIndex, "debounce") {
+		if opts.Debounce, err = engine.getDurationProp(ctx, defIndex, "debounce"); err != nil {
+			return
+		}
+	}
+	if ctx.HasPropString(defIndex, "holdFor") {
+		opts.HoldFor, err = engine.getDurationProp(ctx, defIndex, "holdFor")
+	}
+	return
+}
+
+// maybeFilterRuleCond wraps level or edge triggered condition
+// if 'debounce', 'holdFor' or 'hysteresis' are specified.
+// Filter timers are stopped on script cleanup
+func (engine *ESEngine) maybeFilterRuleCond(ctx *ESContext, defIndex int, defProp string, edge bool) (RuleCondition, error) {
+	condFunc := engine.wrapRuleCondFunc(ctx, defIndex, defProp)
+	opts, err := engine.buildCondFilterOptions(ctx, defIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.IsEmpty() {
+		if edge {
+			return NewEdgeTriggeredRuleCondition(condFunc), nil
+		}
+		return NewLevelTriggeredRuleCondition(condFunc), nil
+	}
+
+	filter := NewCondFilter(condFunc, opts, engine)
+	engine.cleanup.AddCleanup(filter.Stop)
+
+	if edge {
+		return NewFilteredRuleCondition(NewEdgeTriggeredRuleCondition(filter.Value), filter), nil
+	}
+	return NewFilteredRuleCondition(NewLevelTriggeredRuleCondition(filter.Value), filter), nil
+}
+
+// buildSunRuleCond builds the condition from _sun property
+// which is added by lib.js for when: sun(...)
+func (engine *ESEngine) buildSunRuleCond(ctx *ESContext, defIndex int) (RuleCondition, error) {
+	ctx.GetPropString(defIndex, "_sun")
+	defer ctx.Pop()
+
+	ctx.GetPropString(-1, "event")
+	event := ctx.SafeToString(-1)
+	ctx.Pop()
+
+	var offset time.Duration
+	if ctx.HasPropString(-1, "offset") {
+		var err error
+		if offset, err = engine.getSignedDurationProp(ctx, -1, "offset"); err != nil {
+			return nil, fmt.Errorf("invalid rule -- sun schedule %s", err)
+		}
+	}
+
+	var loc GeoLocation
+	switch hasLat, hasLon := ctx.HasPropString(-1, "lat"), ctx.HasPropString(-1, "lon"); {
+	case hasLat && hasLon:
+		ctx.GetPropString(-1, "lat")
+		loc.Latitude = ctx.GetNumber(-1)
+		ctx.Pop()
+		ctx.GetPropString(-1, "lon")
+		loc.Longitude = ctx.GetNumber(-1)
+		ctx.Pop()
+	case hasLat || hasLon:
+		return nil, errors.New("invalid rule -- sun schedule needs both 'lat' and 'lon'")
+	case engine.location == nil:
+		return nil, errors.New("invalid rule -- location is not configured for sun schedule")
+	default:
+		loc = *engine.location
+	}
+
+	schedule, err := NewSunSchedule(event, offset, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule -- %s", err)
+	}
+	return NewSunRuleCondition(schedule), nil
+}
+
 func (engine *ESEngine) buildRuleCond(ctx *ESContext, defIndex int) (RuleCondition, error) {
 	hasWhen := ctx.HasPropString(defIndex, "when")
 	hasAsSoonAs := ctx.HasPropString(defIndex, "asSoonAs")
 	hasWhenChanged := ctx.HasPropString(defIndex, "whenChanged")
-	hasCron := ctx.HasPropString(defIndex, "_cron")
+	hasSun := ctx.HasPropString(defIndex, "_sun")
+	hasCron := ctx.HasPropString(defIndex, "_cron") || hasSun
+	hasFilters := ctx.HasPropString(defIndex, "debounce") ||
+		ctx.HasPropString(defIndex, "holdFor") ||
+		ctx.HasPropString(defIndex, "hysteresis")
 
 	switch {
 	case hasWhen && (hasAsSoonAs || hasWhenChanged || hasCron):
@@ -519,15 +722,18 @@ func (engine *ESEngine) buildRuleCond(ctx *ESContext, defIndex int) (RuleConditi
 			"invalid rule -- cannot combine 'when' with 'asSoonAs', 'whenChanged' or 'cron'")
 
 	case hasWhen:
-		return NewLevelTriggeredRuleCondition(engine.wrapRuleCondFunc(ctx, defIndex, "when")), nil
+		return engine.maybeFilterRuleCond(ctx, defIndex, "when", false)
 
 	case hasAsSoonAs && (hasWhenChanged || hasCron):
 		return nil, errors.New(
 			"invalid rule -- cannot combine 'asSoonAs' with 'whenChanged' or 'cron'")
 
 	case hasAsSoonAs:
-		return NewEdgeTriggeredRuleCondition(
-			engine.wrapRuleCondFunc(ctx, defIndex, "asSoonAs")), nil
+		return engine.maybeFilterRuleCond(ctx, defIndex, "asSoonAs", true)
+
+	case hasFilters && (hasWhenChanged || hasCron):
+		return nil, errors.New(
+			"invalid rule -- 'debounce', 'holdFor' and 'hysteresis' may only be used with 'when' or 'asSoonAs'")
 
 	case hasWhenChanged && hasCron:
 		return nil, errors.New("invalid rule -- cannot combine 'whenChanged' with cron spec")
@@ -535,10 +741,19 @@ func (engine *ESEngine) buildRuleCond(ctx *ESContext, defIndex int) (RuleConditi
 	case hasWhenChanged:
 		return engine.buildWhenChangedRuleCondition(ctx, defIndex)
 
+	case hasSun:
+		return engine.buildSunRuleCond(ctx, defIndex)
+
 	case hasCron:
 		ctx.GetPropString(defIndex, "_cron")
 		defer ctx.Pop()
-		return NewCronRuleCondition(ctx.SafeToString(-1)), nil
+		spec := ctx.SafeToString(-1)
+		if tz, ok := cronSpecTimezone(spec); ok {
+			if _, err := time.LoadLocation(tz); err != nil {
+				return nil, fmt.Errorf("invalid rule -- unknown cron time zone %q", tz)
+			}
+		}
+		return NewCronRuleCondition(spec), nil
 
 	default:
 		return nil, errors.New(
@@ -557,10 +772,51 @@ func (engine *ESEngine) buildRule(ctx *ESContext, name string, defIndex int) (*R
 		return nil, fmt.Errorf("error building rule condition: %w", err)
 	}
 
+	priority := 0
+	if ctx.HasPropString(defIndex, "priority") {
+		ctx.GetPropString(defIndex, "priority")
+		isNumber := ctx.IsNumber(-1)
+		priority = ctx.GetInt(-1)
+		ctx.Pop()
+		if !isNumber {
+			return nil, errors.New("invalid rule -- priority must be a number")
+		}
+	}
+
+	switchable := false
+	if ctx.HasPropString(defIndex, "switchable") {
+		ctx.GetPropString(defIndex, "switchable")
+		isBoolean := ctx.IsBoolean(-1)
+		switchable = ctx.GetBoolean(-1)
+		ctx.Pop()
+		if !isBoolean {
+			return nil, errors.New("invalid rule -- switchable must be a boolean")
+		}
+		if switchable {
+			if err := validateRuleSwitchName(name); err != nil {
+				return nil, fmt.Errorf("invalid rule -- %w", err)
+			}
+		}
+	}
+
 	ruleId := engine.nextRuleId
 	engine.nextRuleId++
 
-	return NewRule(engine, ruleId, name, cond, then), nil
+	rule := NewRule(engine, ruleId, name, cond, then)
+	rule.script = engine.scriptName(ctx.GetCurrentFilename())
+	rule.SetPriority(priority)
+	rule.SetSwitchable(switchable)
+	return rule, nil
+}
+
+// scriptName returns virtual path of the script if it's
+// located under the source root and the original path otherwise
+func (engine *ESEngine) scriptName(path string) string {
+	_, virtualPath, underSourceRoot, _, err := engine.checkSourcePath(path)
+	if err == nil && underSourceRoot {
+		return virtualPath
+	}
+	return path
 }
 
 func (engine *ESEngine) loadLib() error {
@@ -573,6 +829,20 @@ func (engine *ESEngine) loadLib() error {
 	return noLibJs
 }
 
+func sourceItems(source *LocFileEntry, typ itemType) *[]LocItem {
+	switch typ {
+	case SOURCE_ITEM_DEVICE:
+		return &source.Devices
+	case SOURCE_ITEM_RULE:
+		return &source.Rules
+	case SOURCE_ITEM_TIMER:
+		return &source.Timers
+	default:
+		log.Panicf("bad source item type %d", typ)
+	}
+	return nil
+}
+
 func (engine *ESEngine) registerSourceItem(ctx *ESContext, typ itemType, name string) {
 	currentPath := ctx.GetCurrentFilename()
 	if currentPath == "" {
@@ -586,17 +856,7 @@ func (engine *ESEngine) registerSourceItem(ctx *ESContext, typ itemType, name st
 		wbgong.Error.Panicf("Registering source item %d of file %s without entry", typ, currentPath)
 	}
 
-	var items *[]LocItem
-	switch typ {
-	case SOURCE_ITEM_DEVICE:
-		items = &currentSource.Devices
-	case SOURCE_ITEM_RULE:
-		items = &currentSource.Rules
-	case SOURCE_ITEM_TIMER:
-		items = &currentSource.Timers
-	default:
-		log.Panicf("bad source item type %d", typ)
-	}
+	items := sourceItems(currentSource, typ)
 
 	line := -1
 	for _, loc := range ctx.GetTraceback() {
@@ -612,6 +872,23 @@ func (engine *ESEngine) registerSourceItem(ctx *ESContext, typ itemType, name st
 	*items = append(*items, LocItem{line, name})
 }
 
+// unregisterSourceItem removes the item from the file entry,
+// e.g. when a virtual device instance is removed
+func (engine *ESEngine) unregisterSourceItem(source *LocFileEntry, typ itemType, name string) {
+	engine.sourcesMtx.Lock()
+	defer engine.sourcesMtx.Unlock()
+
+	items := sourceItems(source, typ)
+	// the list may be copied by ListSourceFiles, so it's not modified in place
+	filtered := make([]LocItem, 0, len(*items))
+	for _, item := range *items {
+		if item.Name != name {
+			filtered = append(filtered, item)
+		}
+	}
+	*items = filtered
+}
+
 func (engine *ESEngine) ListSourceFiles() (entries []LocFileEntry, err error) {
 	engine.sourcesMtx.Lock()
 	defer engine.sourcesMtx.Unlock()
@@ -695,7 +972,10 @@ func (engine *ESEngine) prepareNewContext(path string) (newLocalCtx *ESContext)
 	// []
 
 	// set error handler
-	newLocalCtx.SetCallbackErrorHandler(engine.CallbackErrorHandler)
+	newLocalCtx.SetCallbackErrorHandler(func(err ESError) {
+		engine.CallbackErrorHandler(err)
+		engine.noteScriptError(path, err)
+	})
 
 	// setup prototype for global object
 	newLocalCtx.PushHeapStash()
@@ -763,6 +1043,26 @@ func (engine *ESEngine) loadScript(path string, loadIfUnchanged bool) (bool, err
 		Enabled:      enabled,
 	}
 
+	engine.addSourceEntry(currentSource, underSourceRoot)
+
+	// check if file is disabled, if so - stop here
+	if !enabled {
+		return false, nil
+	}
+
+	// create new context for this file
+	newLocalCtx := engine.prepareNewContext(path)
+	currentSource.Context = newLocalCtx
+
+	return true, engine.trackESError(path, newLocalCtx.LoadScenario(path))
+}
+
+// addSourceEntry adds the file entry to the sources list. The entry
+// is removed by the cleanups of the script, so this function must be
+// called within the cleanup scope of the script
+func (engine *ESEngine) addSourceEntry(entry *LocFileEntry, underSourceRoot bool) {
+	path, virtualPath := entry.PhysicalPath, entry.VirtualPath
+
 	// if this file is editable, don't forget to save it in editable files map
 	// which will be used to form file entries list in RPC
 	if underSourceRoot {
@@ -787,19 +1087,8 @@ func (engine *ESEngine) loadScript(path string, loadIfUnchanged bool) (bool, err
 
 	// add file to sources list
 	engine.sourcesMtx.Lock()
-	engine.sources[path] = currentSource
+	engine.sources[path] = entry
 	engine.sourcesMtx.Unlock()
-
-	// check if file is disabled, if so - stop here
-	if !enabled {
-		return false, nil
-	}
-
-	// create new context for this file
-	newLocalCtx := engine.prepareNewContext(path)
-	currentSource.Context = newLocalCtx
-
-	return true, engine.trackESError(path, newLocalCtx.LoadScenario(path))
 }
 
 func (engine *ESEngine) trackESError(path string, err error) error {
@@ -808,6 +1097,16 @@ func (engine *ESEngine) trackESError(path string, err error) error {
 		return err
 	}
 
+	scriptErr := engine.newScriptError(esError)
+
+	// set error in the file entry
+	engine.sources[path].Error = &scriptErr
+
+	engine.WriteLog(engine.scriptLogRecord(ENGINE_LOG_ERROR, scriptErr.Error(), esError.Traceback))
+	return scriptErr
+}
+
+func (engine *ESEngine) newScriptError(esError ESError) ScriptError {
 	// ESError contains physical file paths in its traceback.
 	// Here we need to translate them to virtual paths.
 	// We skip any frames that refer to files that don't
@@ -821,13 +1120,7 @@ func (engine *ESEngine) trackESError(path string, err error) error {
 		}
 	}
 
-	scriptErr := NewScriptError(esError.Message, traceback)
-
-	// set error in the file entry
-	engine.sources[path].Error = &scriptErr
-
-	engine.Log(ENGINE_LOG_ERROR, scriptErr.Error())
-	return scriptErr
+	return NewScriptError(esError.Message, traceback)
 }
 
 func (engine *ESEngine) maybePublishUpdate(subtopic, physicalPath string) {
@@ -862,6 +1155,31 @@ func (engine *ESEngine) runCleanups(path string) {
 	}
 }
 
+// unloadScript runs the cleanups of the script.
+// It returns false if the script isn't loaded
+func (engine *ESEngine) unloadScript(path string) bool {
+	if _, ok := engine.localCtxs[path]; !ok {
+		return false
+	}
+	engine.runCleanups(path)
+	engine.Refresh()
+	return true
+}
+
+// reloadScript loads the script if its file exists,
+// enabled or not. The path is a physical one without
+// the disabled suffix
+func (engine *ESEngine) reloadScript(path string) {
+	for _, p := range []string{path, path + FILE_DISABLED_SUFFIX} {
+		if _, err := os.Stat(p); err == nil {
+			if err := engine.loadScriptAndRefresh(p, true); err != nil {
+				wbgong.Error.Printf("error reloading %s: %s", p, err)
+			}
+			return
+		}
+	}
+}
+
 func (engine *ESEngine) loadScriptAndRefresh(path string, loadIfUnchanged bool) (err error) {
 	loaded, err := engine.loadScript(path, loadIfUnchanged)
 	if loaded {
@@ -953,6 +1271,9 @@ func (engine *ESEngine) wrapRuleCondFunc(ctx *ESContext, defIndex int, defProp s
 }
 
 func getFilenameHash(filename string) string {
+	filenameMd5sMtx.Lock()
+	defer filenameMd5sMtx.Unlock()
+
 	if result, ok := filenameMd5s[filename]; ok {
 		return result
 	} else {
@@ -1105,7 +1426,11 @@ func (engine *ESEngine) esDefineVirtualDevice(ctx *ESContext) int {
 	name := ctx.GetString(0)
 	obj := ctx.GetJSObject(1).(objx.Map)
 
-	if err := engine.DefineVirtualDevice(name, obj); err != nil {
+	err := engine.reportDescriptorProblems(ctx, validateDeviceDescriptor(name, obj))
+	if err == nil {
+		err = engine.DefineVirtualDevice(name, obj)
+	}
+	if err != nil {
 		wbgong.Error.Printf("device definition error: %v", err)
 		ctx.PushErrorObject(duktape.DUK_ERR_ERROR, err.Error())
 		return duktape.DUK_RET_INSTACK_ERROR
@@ -1476,6 +1801,14 @@ func (engine *ESEngine) esVdevAddControl(ctx *ESContext) int {
 
 	ctx.Pop()
 
+	v := &descriptorValidation{}
+	validateControlDescriptor(v, devId, ctrlId, ctrlDef)
+	if err := engine.reportDescriptorProblems(ctx, v); err != nil {
+		// addControl() doesn't throw, so the error is only logged
+		engine.WriteLog(engine.scriptLogRecord(ENGINE_LOG_ERROR, err.Error(), ctx.GetTraceback()))
+		return 0
+	}
+
 	errControl := engine.AddControl(devId, ctrlId, ctrlDef)
 	if errControl != nil {
 		wbgong.Error.Printf("Error in creating control %s on device %s: %v", ctrlId, devId, errControl)
@@ -1977,7 +2310,14 @@ func (engine *ESEngine) esFormat(ctx *ESContext) int {
 
 func (engine *ESEngine) makeLogFunc(level EngineLogLevel) func(ctx *ESContext) int {
 	return func(ctx *ESContext) int {
-		engine.Log(level, ctx.Format())
+		message := ctx.Format()
+		// getting the traceback is expensive, so it's skipped
+		// for the records that are dropped anyway
+		if !engine.structuredLog() || engine.logLevelFiltered(level) {
+			engine.Log(level, message)
+			return 0
+		}
+		engine.WriteLog(engine.scriptLogRecord(level, message, ctx.GetTraceback()))
 		return 0
 	}
 }
@@ -2237,7 +2577,7 @@ func (engine *ESEngine) esWbSpawn(ctx *ESContext) int {
 	captureOutput := ctx.GetBoolean(2)
 	captureErrorOutput := ctx.GetBoolean(3)
 	go func() {
-		r, err := Spawn(args[0], args[1:], captureOutput, captureErrorOutput, input)
+		r, err := engine.spawn(args[0], args[1:], captureOutput, captureErrorOutput, input)
 		if err != nil {
 			wbgong.Error.Printf("external command failed: %v", err)
 			return
@@ -2394,7 +2734,7 @@ func (engine *ESEngine) esWbCtrlRule(ctx *ESContext, state bool) int {
 	ruleId := RuleId(ctx.GetInt(0))
 
 	if rule, found := engine.ruleMap[ruleId]; found {
-		rule.SetState(state, engine.cron)
+		engine.SetRuleState(rule, state)
 	} else {
 		engine.Log(ENGINE_LOG_ERROR, fmt.Sprintf("trying to %s undefined rule: %d", act, ruleId))
 		return duktape.DUK_RET_ERROR
@@ -2417,7 +2757,7 @@ func (engine *ESEngine) esWbRunRule(ctx *ESContext) int {
 	ruleId := RuleId(ctx.GetInt(0))
 
 	if rule, found := engine.ruleMap[ruleId]; found {
-		rule.then(nil)
+		rule.Run()
 	} else {
 		engine.Log(ENGINE_LOG_ERROR, fmt.Sprintf("trying to call runRule for undefined rule: %d", ruleId))
 		return duktape.DUK_RET_ERROR
@@ -2514,6 +2854,16 @@ func (engine *ESEngine) SetPersistentDBMode(filename string, mode os.FileMode) (
 }
 
 // Force close DB
+// Destroy frees the Duktape heap and the C memory of the stopped
+// engine. It's used for the engines created for simulation and
+// replay, which come and go while wb-rules is running
+func (engine *ESEngine) Destroy() {
+	engine.ctxFactory.destroy(engine.globalCtx)
+	engine.globalCtx = nil
+	engine.localCtxs = make(map[string]*ESContext)
+	engine.ctxTimers = make(map[*ESContext]*TimerSet)
+}
+
 func (engine *ESEngine) ClosePersistentDB() (err error) {
 	if engine.persistentDB == nil {
 		engine.Log(ENGINE_LOG_ERROR, "DB is not opened, nothing to close")
@@ -2534,9 +2884,10 @@ func (engine *ESEngine) esPersistentName(ctx *ESContext) int {
 		return duktape.DUK_RET_ERROR
 	}
 
-	// arguments: (name [, options = { global bool }])
+	// arguments: (name [, options = { global bool, maxKeys int, maxSize int }])
 	var name string
 	var global bool
+	var quota StorageQuota
 
 	numArgs := ctx.GetTop()
 
@@ -2562,6 +2913,13 @@ func (engine *ESEngine) esPersistentName(ctx *ESContext) int {
 		ctx.GetPropString(1, "global")
 		global = ctx.GetBoolean(-1)
 		ctx.Pop()
+
+		var err error
+		if quota, err = parseStorageQuota(ctx, 1); err != nil {
+			ctx.PushErrorObject(duktape.DUK_ERR_TYPE_ERROR,
+				fmt.Sprintf("bad persistent storage options: %s", err))
+			return duktape.DUK_RET_INSTACK_ERROR
+		}
 	}
 
 	if global {
@@ -2570,8 +2928,17 @@ func (engine *ESEngine) esPersistentName(ctx *ESContext) int {
 		// get global ID for bucket if this is local storage
 		name = engine.expandLocalObjectId(ctx, name)
 		engine.Log(ENGINE_LOG_INFO, "create local storage name: "+name)
+
+		// remember the script to find storages of deleted scripts
+		if filename := ctx.GetCurrentFilename(); filename != "" {
+			if err := engine.setStorageOwner(name, filename); err != nil {
+				engine.Logf(ENGINE_LOG_WARNING, "can't record the script of persistent storage %s: %s", name, err)
+			}
+		}
 	}
 
+	engine.setStorageQuota(name, quota)
+
 	// push name as return value
 	ctx.PushString(name)
 
@@ -2585,11 +2952,15 @@ func (engine *ESEngine) esPersistentSet(ctx *ESContext) int {
 		return duktape.DUK_RET_ERROR
 	}
 
-	// arguments: (bucket string, key string, value)
+	// arguments: (bucket string, key string, value [, options = { ttl }])
 	var bucket, key, value string
 	var shouldDelete bool
+	// the key written without ttl option keeps its expiration time,
+	// e.g. when StorableObject rewrites the key after a field change
+	ttl := STORAGE_TTL_KEEP
 
-	if ctx.GetTop() != 3 {
+	numArgs := ctx.GetTop()
+	if numArgs < 3 || numArgs > 4 {
 		engine.Log(ENGINE_LOG_ERROR, "bad persistentSet request, arg number mismatch")
 		return duktape.DUK_RET_ERROR
 	}
@@ -2616,25 +2987,80 @@ func (engine *ESEngine) esPersistentSet(ctx *ESContext) int {
 		value = ctx.JsonEncode(2)
 	}
 
+	// parse options
+	if numArgs == 4 && !ctx.IsNullOrUndefined(3) {
+		if !ctx.IsObject(3) {
+			engine.Log(ENGINE_LOG_ERROR, "persistent storage set options must be object")
+			return duktape.DUK_RET_ERROR
+		}
+		if ctx.HasPropString(3, "ttl") {
+			var err error
+			if ttl, err = engine.getDurationProp(ctx, 3, "ttl"); err != nil {
+				ctx.PushErrorObject(duktape.DUK_ERR_TYPE_ERROR,
+					fmt.Sprintf("bad persistent storage set options: %s", err))
+				return duktape.DUK_RET_INSTACK_ERROR
+			}
+		}
+	}
+
+	quota := engine.storageQuota(bucket)
+	if !shouldDelete && quota.MaxSize > 0 && len(key)+len(value) > quota.MaxSize {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't write to persistent storage %s: '%s': value exceeds the storage size limit of %d bytes",
+				bucket, key, quota.MaxSize))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+
 	// perform a transaction
-	engine.persistentDB.Update(func(tx *bolt.Tx) error {
+	var changes []storageChange
+	evicted := 0
+	err := engine.persistentUpdate(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
 		if err != nil {
 			return err
 		}
 
 		if shouldDelete {
+			changes = engine.keyChange(b, bucket, key, nil)
 			if err := b.Delete([]byte(key)); err != nil {
 				return err
 			}
-			return nil
+			return deleteKeyMeta(tx, bucket, key)
 		}
 
+		changes = engine.keyChange(b, bucket, key, []byte(value))
 		if err := b.Put([]byte(key), []byte(value)); err != nil {
 			return err
 		}
+		if err := putKeyMeta(tx, bucket, key, engine.clock.Now(), ttl, quota); err != nil {
+			return err
+		}
+
+		// make room for the new value removing the oldest keys
+		victims := quotaVictims(tx, b, bucket, key, quota)
+		for _, victim := range victims {
+			changes = append(changes, engine.keyChange(b, bucket, victim, nil)...)
+			if err := b.Delete([]byte(victim)); err != nil {
+				return err
+			}
+			if err := deleteKeyMeta(tx, bucket, victim); err != nil {
+				return err
+			}
+		}
+		evicted = len(victims)
 		return nil
 	})
+	if err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't write to persistent storage %s: '%s': %s", bucket, key, err))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.commitStorageChanges(changes)
+	if evicted > 0 {
+		// keys evicted within a rolled back transaction are counted too
+		engine.countEvicted(STORAGE_EVICTED_QUOTA, evicted)
+		wbgong.Debug.Printf("evicted %d key(s) from persistent storage %s", evicted, bucket)
+	}
 
 	if shouldDelete {
 		wbgong.Debug.Printf("delete value from persistent storage %s: '%s'", bucket, key)
@@ -2679,13 +3105,13 @@ func (engine *ESEngine) esPersistentGet(ctx *ESContext) int {
 	// try to get these from cache
 	var ok bool
 	// read value
-	engine.persistentDB.View(func(tx *bolt.Tx) error {
+	engine.persistentView(func(tx *bolt.Tx) error {
 		ok = false
 		b := tx.Bucket([]byte(bucket))
 		if b == nil { // no such bucket -> undefined
 			return nil
 		}
-		if v := b.Get([]byte(key)); v != nil {
+		if v := b.Get([]byte(key)); v != nil && !keyExpired(tx, bucket, key, engine.clock.Now()) {
 			value = string(v)
 			ok = true
 		}
@@ -2704,6 +3130,177 @@ func (engine *ESEngine) esPersistentGet(ctx *ESContext) int {
 	return 1
 }
 
+// persistentView runs fn in the open storage transaction
+// if there is one, otherwise in a new read-only transaction
+func (engine *ESEngine) persistentView(fn func(tx *bolt.Tx) error) error {
+	if engine.persistentTx != nil {
+		return fn(engine.persistentTx)
+	}
+	return engine.persistentDB.View(fn)
+}
+
+// persistentUpdate runs fn in the open storage transaction
+// if there is one, otherwise in a new read-write transaction
+func (engine *ESEngine) persistentUpdate(fn func(tx *bolt.Tx) error) error {
+	if engine.persistentTx != nil {
+		return fn(engine.persistentTx)
+	}
+	return engine.persistentDB.Update(fn)
+}
+
+// Lists keys of persistent storage bucket.
+// Used in 'PersistentStorage.keys()'
+func (engine *ESEngine) esPersistentKeys(ctx *ESContext) int {
+	if engine.persistentDB == nil {
+		engine.Log(ENGINE_LOG_ERROR, "persistent DB is not initialized")
+		return duktape.DUK_RET_ERROR
+	}
+
+	// arguments: (bucket string)
+	if ctx.GetTop() != 1 || !ctx.IsString(0) {
+		engine.Log(ENGINE_LOG_ERROR, "persistent storage bucket name must be string")
+		return duktape.DUK_RET_ERROR
+	}
+	bucket := ctx.GetString(0)
+
+	arrIndex := ctx.PushArray()
+	n := uint(0)
+	engine.persistentView(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		meta, _ := storageMeta(tx, bucket, false)
+		now := engine.clock.Now()
+		return b.ForEach(func(k, v []byte) error {
+			if m, ok := getKeyMeta(meta, string(k)); ok && m.expired(now) {
+				return nil
+			}
+			ctx.PushString(string(k))
+			ctx.PutPropIndex(arrIndex, n)
+			n++
+			return nil
+		})
+	})
+
+	return 1
+}
+
+// Checks whether persistent storage bucket has the key.
+// Used in 'PersistentStorage.has(key)'
+func (engine *ESEngine) esPersistentHas(ctx *ESContext) int {
+	if engine.persistentDB == nil {
+		engine.Log(ENGINE_LOG_ERROR, "persistent DB is not initialized")
+		return duktape.DUK_RET_ERROR
+	}
+
+	// arguments: (bucket string, key string)
+	if ctx.GetTop() != 2 || !ctx.IsString(0) || !ctx.IsString(1) {
+		engine.Log(ENGINE_LOG_ERROR, "bad persistentHas request, bucket name and key must be strings")
+		return duktape.DUK_RET_ERROR
+	}
+	bucket, key := ctx.GetString(0), ctx.GetString(1)
+
+	found := false
+	engine.persistentView(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(bucket)); b != nil {
+			found = b.Get([]byte(key)) != nil && !keyExpired(tx, bucket, key, engine.clock.Now())
+		}
+		return nil
+	})
+	ctx.PushBoolean(found)
+
+	return 1
+}
+
+// Removes all keys from persistent storage bucket.
+// Used in 'PersistentStorage.clear()'
+func (engine *ESEngine) esPersistentClear(ctx *ESContext) int {
+	if engine.persistentDB == nil {
+		engine.Log(ENGINE_LOG_ERROR, "persistent DB is not initialized")
+		return duktape.DUK_RET_ERROR
+	}
+
+	// arguments: (bucket string)
+	if ctx.GetTop() != 1 || !ctx.IsString(0) {
+		engine.Log(ENGINE_LOG_ERROR, "persistent storage bucket name must be string")
+		return duktape.DUK_RET_ERROR
+	}
+	bucket := ctx.GetString(0)
+
+	var changes []storageChange
+	err := engine.persistentUpdate(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		changes = bucketChanges(bucket, engine.bucketSnapshot(b, bucket), map[string][]byte{})
+		if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+			return err
+		}
+		return deleteKeyMeta(tx, bucket, "")
+	})
+	if err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't clear persistent storage %s: %s", bucket, err))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.commitStorageChanges(changes)
+	wbgong.Debug.Printf("clear persistent storage %s", bucket)
+
+	return 0
+}
+
+// Calls the function with all persistent storage writes done in
+// a single DB transaction. The transaction is committed if the
+// function returns and rolled back if it throws. Nested calls
+// join the outer transaction.
+// Used in 'PersistentStorage.transaction(fn)'
+func (engine *ESEngine) esPersistentTransaction(ctx *ESContext) int {
+	if engine.persistentDB == nil {
+		engine.Log(ENGINE_LOG_ERROR, "persistent DB is not initialized")
+		return duktape.DUK_RET_ERROR
+	}
+
+	// arguments: (fn function)
+	if ctx.GetTop() != 1 || !ctx.IsFunction(0) {
+		engine.Log(ENGINE_LOG_ERROR, "persistent storage transaction must be a function")
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+
+	if engine.persistentTx != nil {
+		if ctx.Pcall(0) != 0 {
+			return duktape.DUK_RET_INSTACK_ERROR
+		}
+		return 1
+	}
+
+	tx, err := engine.persistentDB.Begin(true)
+	if err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't start persistent storage transaction: %s", err))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.persistentTx = tx
+
+	r := ctx.Pcall(0)
+	changes := engine.persistentTxChanges
+	engine.persistentTx, engine.persistentTxChanges = nil, nil
+	if r != 0 {
+		tx.Rollback()
+		// rethrow the error
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	if err := tx.Commit(); err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("can't commit persistent storage transaction: %s", err))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.notifyStorageChanges(changes)
+
+	return 1
+}
+
 // native modSearch implementation
 func (engine *ESEngine) ModSearch(ctx *duktape.Context) int {
 	// arguments:
@@ -1,25 +1,90 @@
 package wbrules
 
 import (
+	"fmt"
 	"sync"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/wirenboard/wbgong"
 )
 
 const (
 	EVENT_BUFFER_CAP    = 16
 	EVENT_OBSERVERS_CAP = 1
+
+	// default limit of control change events waiting for the rules.
+	// It's large enough not to drop events on bursts, but keeps the
+	// buffer from growing without limit when the rules are stuck
+	EVENT_BUFFER_DEFAULT_CAPACITY = 100000
+)
+
+// EventOverflowPolicy selects the event to be dropped
+// when the event buffer is full
+type EventOverflowPolicy int
+
+const (
+	EVENT_OVERFLOW_DROP_OLDEST EventOverflowPolicy = iota
+	EVENT_OVERFLOW_DROP_NEWEST
 )
 
+func (p EventOverflowPolicy) String() string {
+	switch p {
+	case EVENT_OVERFLOW_DROP_OLDEST:
+		return "drop-oldest"
+	case EVENT_OVERFLOW_DROP_NEWEST:
+		return "drop-newest"
+	default:
+		return fmt.Sprintf("EventOverflowPolicy(%d)", int(p))
+	}
+}
+
+func ParseEventOverflowPolicy(s string) (EventOverflowPolicy, error) {
+	switch s {
+	case "drop-oldest":
+		return EVENT_OVERFLOW_DROP_OLDEST, nil
+	case "drop-newest":
+		return EVENT_OVERFLOW_DROP_NEWEST, nil
+	default:
+		return 0, fmt.Errorf("invalid event overflow policy %q (must be drop-oldest or drop-newest)", s)
+	}
+}
+
+type EventBufferOptions struct {
+	// Capacity is the maximum number of pending events, 0 means no limit
+	Capacity int
+	Policy   EventOverflowPolicy
+	// Coalesce makes a pending event of a control be replaced by
+	// a newer one. The replacing event keeps PrevValue of the
+	// pending one. Pushbutton events are never coalesced
+	Coalesce bool
+
+	// optional counters of dropped and coalesced events
+	Dropped   *metrics.Counter
+	Coalesced *metrics.Counter
+}
+
 type EventBuffer struct {
 	sync.Mutex
 
+	options       EventBufferOptions
 	currentBuffer []*ControlChangeEvent
 	observer      chan struct{}
+	journal       *EventJournal
+
+	// pending maps controls to positions of their events in
+	// the buffer counted from the last Retrieve(). removed is
+	// the number of events dropped from the head of the buffer since then
+	pending    map[ControlSpec]int
+	removed    int
+	overflowed bool
 }
 
-func NewEventBuffer() *EventBuffer {
+func NewEventBuffer(options EventBufferOptions) *EventBuffer {
 	return &EventBuffer{
+		options:       options,
 		currentBuffer: make([]*ControlChangeEvent, 0, EVENT_BUFFER_CAP),
 		observer:      make(chan struct{}, 1),
+		pending:       make(map[ControlSpec]int),
 	}
 }
 
@@ -27,11 +92,36 @@ func (eb *EventBuffer) Observe() <-chan struct{} {
 	return eb.observer
 }
 
+// SetJournal sets the journal to record all the events to
+func (eb *EventBuffer) SetJournal(journal *EventJournal) {
+	eb.Lock()
+	defer eb.Unlock()
+
+	eb.journal = journal
+}
+
+// Journal returns the journal the events are recorded to or nil
+func (eb *EventBuffer) Journal() *EventJournal {
+	eb.Lock()
+	defer eb.Unlock()
+
+	return eb.journal
+}
+
 func (eb *EventBuffer) PushEvent(e *ControlChangeEvent) {
+	if journal := eb.Journal(); journal != nil {
+		journal.Record(e)
+	}
+
 	eb.Lock()
 	defer eb.Unlock()
 
-	eb.currentBuffer = append(eb.currentBuffer, e)
+	if !eb.coalesce(e) && eb.makeRoom() {
+		if eb.options.Coalesce {
+			eb.pending[e.Spec] = eb.removed + len(eb.currentBuffer)
+		}
+		eb.currentBuffer = append(eb.currentBuffer, e)
+	}
 
 	// try to notify user if he's not notified already
 	select {
@@ -40,12 +130,67 @@ func (eb *EventBuffer) PushEvent(e *ControlChangeEvent) {
 	}
 }
 
+// coalesce replaces the pending event of the same control with e.
+// Must be called with eb locked
+func (eb *EventBuffer) coalesce(e *ControlChangeEvent) bool {
+	if !eb.options.Coalesce || e.ControlType == wbgong.CONV_TYPE_PUSHBUTTON {
+		return false
+	}
+	pos, found := eb.pending[e.Spec]
+	if !found {
+		return false
+	}
+	i := pos - eb.removed
+	coalesced := *e
+	coalesced.PrevValue = eb.currentBuffer[i].PrevValue
+	eb.currentBuffer[i] = &coalesced
+	if eb.options.Coalesced != nil {
+		eb.options.Coalesced.Inc()
+	}
+	return true
+}
+
+// makeRoom drops an event according to the overflow policy if the
+// buffer is full. It returns false if the new event must be dropped.
+// Must be called with eb locked
+func (eb *EventBuffer) makeRoom() bool {
+	if eb.options.Capacity <= 0 || len(eb.currentBuffer) < eb.options.Capacity {
+		return true
+	}
+
+	if !eb.overflowed {
+		eb.overflowed = true
+		wbgong.Warn.Printf("event buffer is full (%d events), dropping events (%s)",
+			eb.options.Capacity, eb.options.Policy)
+	}
+	if eb.options.Dropped != nil {
+		eb.options.Dropped.Inc()
+	}
+
+	if eb.options.Policy == EVENT_OVERFLOW_DROP_NEWEST {
+		return false
+	}
+	oldest := eb.currentBuffer[0]
+	if pos, found := eb.pending[oldest.Spec]; found && pos == eb.removed {
+		delete(eb.pending, oldest.Spec)
+	}
+	eb.currentBuffer[0] = nil
+	eb.currentBuffer = eb.currentBuffer[1:]
+	eb.removed++
+	return true
+}
+
 func (eb *EventBuffer) Retrieve() (e []*ControlChangeEvent) {
 	eb.Lock()
 	defer eb.Unlock()
 
 	e = eb.currentBuffer
 	eb.currentBuffer = make([]*ControlChangeEvent, 0, EVENT_BUFFER_CAP)
+	if len(eb.pending) > 0 {
+		eb.pending = make(map[ControlSpec]int)
+	}
+	eb.removed = 0
+	eb.overflowed = false
 	return
 }
 
@@ -0,0 +1,122 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func valueEvent(control string, value, prevValue any) *ControlChangeEvent {
+	return &ControlChangeEvent{
+		Spec:        ControlSpec{"somedev", control},
+		ControlType: "value",
+		Value:       value,
+		PrevValue:   prevValue,
+	}
+}
+
+func eventValues(events []*ControlChangeEvent) (r [][3]any) {
+	for _, e := range events {
+		r = append(r, [3]any{e.Spec.ControlId, e.PrevValue, e.Value})
+	}
+	return
+}
+
+func TestEventBufferUnbounded(t *testing.T) {
+	eb := NewEventBuffer(EventBufferOptions{})
+	for i := 0; i < 100; i++ {
+		eb.PushEvent(valueEvent("a", i+1, i))
+	}
+	assert.Equal(t, 100, eb.length())
+	assert.Len(t, eb.Retrieve(), 100)
+	assert.Equal(t, 0, eb.length())
+}
+
+func TestEventBufferCoalescing(t *testing.T) {
+	s := metrics.NewSet()
+	coalesced := s.NewCounter("coalesced")
+	eb := NewEventBuffer(EventBufferOptions{Coalesce: true, Coalesced: coalesced})
+
+	eb.PushEvent(valueEvent("a", 1, 0))
+	eb.PushEvent(valueEvent("b", 10, nil))
+	eb.PushEvent(valueEvent("a", 2, 1))
+	eb.PushEvent(valueEvent("a", 3, 2))
+	button := &ControlChangeEvent{Spec: ControlSpec{"somedev", "btn"}, ControlType: "pushbutton", Value: true}
+	eb.PushEvent(button)
+	eb.PushEvent(button)
+
+	assert.Equal(t, [][3]any{
+		{"a", 0, 3},
+		{"b", nil, 10},
+		{"btn", nil, true},
+		{"btn", nil, true},
+	}, eventValues(eb.Retrieve()))
+	assert.Equal(t, uint64(2), coalesced.Get())
+
+	// events retrieved already are not coalesced
+	eb.PushEvent(valueEvent("a", 4, 3))
+	assert.Equal(t, [][3]any{{"a", 3, 4}}, eventValues(eb.Retrieve()))
+}
+
+func TestEventBufferDropOldest(t *testing.T) {
+	s := metrics.NewSet()
+	dropped := s.NewCounter("dropped")
+	eb := NewEventBuffer(EventBufferOptions{
+		Capacity: 3,
+		Policy:   EVENT_OVERFLOW_DROP_OLDEST,
+		Coalesce: true,
+		Dropped:  dropped,
+	})
+
+	eb.PushEvent(valueEvent("a", 1, 0))
+	eb.PushEvent(valueEvent("b", 1, 0))
+	eb.PushEvent(valueEvent("c", 1, 0))
+	eb.PushEvent(valueEvent("d", 1, 0))
+	// coalesced with the pending event, nothing is dropped
+	eb.PushEvent(valueEvent("c", 2, 1))
+	// "a" is dropped, so it's not coalesced
+	eb.PushEvent(valueEvent("a", 2, 1))
+
+	assert.Equal(t, [][3]any{
+		{"c", 0, 2},
+		{"d", 0, 1},
+		{"a", 1, 2},
+	}, eventValues(eb.Retrieve()))
+	assert.Equal(t, uint64(2), dropped.Get())
+}
+
+func TestEventBufferDropNewest(t *testing.T) {
+	s := metrics.NewSet()
+	dropped := s.NewCounter("dropped")
+	eb := NewEventBuffer(EventBufferOptions{
+		Capacity: 2,
+		Policy:   EVENT_OVERFLOW_DROP_NEWEST,
+		Dropped:  dropped,
+	})
+
+	eb.PushEvent(valueEvent("a", 1, 0))
+	eb.PushEvent(valueEvent("b", 1, 0))
+	eb.PushEvent(valueEvent("c", 1, 0))
+	eb.PushEvent(valueEvent("a", 2, 1))
+
+	assert.Equal(t, [][3]any{
+		{"a", 0, 1},
+		{"b", 0, 1},
+	}, eventValues(eb.Retrieve()))
+	assert.Equal(t, uint64(2), dropped.Get())
+
+	eb.PushEvent(valueEvent("c", 2, 1))
+	assert.Equal(t, [][3]any{{"c", 1, 2}}, eventValues(eb.Retrieve()))
+}
+
+func TestParseEventOverflowPolicy(t *testing.T) {
+	for _, policy := range []EventOverflowPolicy{EVENT_OVERFLOW_DROP_OLDEST, EVENT_OVERFLOW_DROP_NEWEST} {
+		parsed, err := ParseEventOverflowPolicy(policy.String())
+		require.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+	_, err := ParseEventOverflowPolicy("drop-all")
+	assert.Error(t, err)
+}
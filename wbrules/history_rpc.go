@@ -0,0 +1,99 @@
+package wbrules
+
+import (
+	"errors"
+	"time"
+)
+
+// HistorySource provides access to the history of controls
+type HistorySource interface {
+	ControlHistory(ctrlSpec ControlSpec, from, to time.Time, window time.Duration) ([]HistoryWindow, error)
+}
+
+type History struct {
+	source HistorySource
+}
+
+type HistoryError struct {
+	code    int32
+	message string
+}
+
+func (err *HistoryError) Error() string {
+	return err.message
+}
+
+func (err *HistoryError) ErrorCode() int32 {
+	return err.code
+}
+
+const (
+	// no iota here because these values may be used
+	// by external software
+	HISTORY_ERROR_DISABLED           = 1400
+	HISTORY_ERROR_NOT_FOUND          = 1401
+	HISTORY_ERROR_INVALID_CONTROL    = 1402
+	HISTORY_ERROR_INVALID_TIME_RANGE = 1403
+	HISTORY_ERROR_INVALID_WINDOW     = 1404
+)
+
+var (
+	historyDisabledError         = &HistoryError{HISTORY_ERROR_DISABLED, "Control history is disabled"}
+	historyNotFoundError         = &HistoryError{HISTORY_ERROR_NOT_FOUND, "Control has no history"}
+	invalidHistoryControlError   = &HistoryError{HISTORY_ERROR_INVALID_CONTROL, "Device or control is not specified"}
+	invalidHistoryTimeRangeError = &HistoryError{HISTORY_ERROR_INVALID_TIME_RANGE, "Invalid time range"}
+	invalidHistoryWindowError    = &HistoryError{HISTORY_ERROR_INVALID_WINDOW, "Invalid window"}
+)
+
+func NewHistory(source HistorySource) *History {
+	return &History{source}
+}
+
+type HistoryGetArgs struct {
+	Device  string `json:"device"`
+	Control string `json:"control"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Window  string `json:"window"`
+}
+
+// Get returns min/max/avg values of the control over the windows
+// (durations like "1h", the sampling interval by default) within the
+// time range (RFC 3339 timestamps, the whole kept history by default).
+// Windows without samples are skipped
+func (history *History) Get(args *HistoryGetArgs, reply *[]HistoryWindow) error {
+	if args.Device == "" || args.Control == "" {
+		return invalidHistoryControlError
+	}
+	from, err := parseOptionalTime(args.From)
+	if err != nil {
+		return invalidHistoryTimeRangeError
+	}
+	to, err := parseOptionalTime(args.To)
+	if err != nil {
+		return invalidHistoryTimeRangeError
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return invalidHistoryTimeRangeError
+	}
+	var window time.Duration
+	if args.Window != "" {
+		if window, err = ParseDuration(args.Window); err != nil || window <= 0 {
+			return invalidHistoryWindowError
+		}
+	}
+
+	windows, err := history.source.ControlHistory(ControlSpec{args.Device, args.Control}, from, to, window)
+	switch {
+	case errors.Is(err, errHistoryDisabled):
+		return historyDisabledError
+	case errors.Is(err, errNoHistory):
+		return historyNotFoundError
+	case errors.Is(err, errHistoryRange):
+		return invalidHistoryTimeRangeError
+	case err != nil:
+		return err
+	}
+	*reply = windows
+	return nil
+}
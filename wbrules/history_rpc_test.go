@@ -0,0 +1,109 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/objx"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type historyQuery struct {
+	spec     ControlSpec
+	from, to time.Time
+	window   time.Duration
+}
+
+type HistoryRpcSuite struct {
+	testutils.Suite
+	*testutils.RpcFixture
+	query   *historyQuery
+	windows []HistoryWindow
+	err     error
+}
+
+func (s *HistoryRpcSuite) T() *testing.T {
+	return s.Suite.T()
+}
+
+func (s *HistoryRpcSuite) SetupTest() {
+	s.Suite.SetupTest()
+	s.query, s.windows, s.err = nil, nil, nil
+	s.RpcFixture = testutils.NewRpcFixture(
+		s.T(), "wbrules", "History", "wbrules",
+		NewHistory(s),
+		"Get")
+}
+
+func (s *HistoryRpcSuite) TearDownTest() {
+	s.TearDownRPC()
+	s.Suite.TearDownTest()
+}
+
+func (s *HistoryRpcSuite) ControlHistory(ctrlSpec ControlSpec, from, to time.Time, window time.Duration) ([]HistoryWindow, error) {
+	s.query = &historyQuery{ctrlSpec, from, to, window}
+	return s.windows, s.err
+}
+
+func (s *HistoryRpcSuite) TestGet() {
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	s.windows = []HistoryWindow{
+		{From: t0, To: t0.Add(time.Hour), Min: 19.5, Max: 21, Avg: 20, Count: 60},
+	}
+	s.VerifyRpc("Get", objx.Map{
+		"device":  "heating",
+		"control": "temp",
+		"from":    "2026-10-17T12:00:00Z",
+		"to":      "2026-10-17T13:00:00Z",
+		"window":  "1h",
+	}, []objx.Map{
+		{
+			"from":  "2026-10-17T12:00:00Z",
+			"to":    "2026-10-17T13:00:00Z",
+			"min":   19.5,
+			"max":   21,
+			"avg":   20,
+			"count": 60,
+		},
+	})
+	s.Equal(&historyQuery{ControlSpec{"heating", "temp"}, t0, t0.Add(time.Hour), time.Hour}, s.query)
+
+	s.VerifyRpc("Get", objx.Map{"device": "heating", "control": "temp"}, []objx.Map{
+		{
+			"from":  "2026-10-17T12:00:00Z",
+			"to":    "2026-10-17T13:00:00Z",
+			"min":   19.5,
+			"max":   21,
+			"avg":   20,
+			"count": 60,
+		},
+	})
+	s.Equal(&historyQuery{spec: ControlSpec{"heating", "temp"}}, s.query)
+}
+
+func (s *HistoryRpcSuite) TestGetErrors() {
+	s.VerifyRpcError("Get", objx.Map{"device": "heating"},
+		HISTORY_ERROR_INVALID_CONTROL, "HistoryError", "Device or control is not specified")
+	s.VerifyRpcError("Get", objx.Map{"device": "heating", "control": "temp", "from": "yesterday"},
+		HISTORY_ERROR_INVALID_TIME_RANGE, "HistoryError", "Invalid time range")
+	s.VerifyRpcError("Get", objx.Map{
+		"device":  "heating",
+		"control": "temp",
+		"from":    "2026-10-17T13:00:00Z",
+		"to":      "2026-10-17T12:00:00Z",
+	}, HISTORY_ERROR_INVALID_TIME_RANGE, "HistoryError", "Invalid time range")
+	s.VerifyRpcError("Get", objx.Map{"device": "heating", "control": "temp", "window": "-1h"},
+		HISTORY_ERROR_INVALID_WINDOW, "HistoryError", "Invalid window")
+	s.Nil(s.query)
+
+	s.err = errNoHistory
+	s.VerifyRpcError("Get", objx.Map{"device": "heating", "control": "temp"},
+		HISTORY_ERROR_NOT_FOUND, "HistoryError", "Control has no history")
+	s.err = errHistoryDisabled
+	s.VerifyRpcError("Get", objx.Map{"device": "heating", "control": "temp"},
+		HISTORY_ERROR_DISABLED, "HistoryError", "Control history is disabled")
+}
+
+func TestHistoryRpcSuite(t *testing.T) {
+	testutils.RunSuites(t, new(HistoryRpcSuite))
+}
@@ -0,0 +1,207 @@
+package wbrules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wirenboard/wbgong"
+)
+
+const (
+	EVENT_JOURNAL_DEFAULT_SIZE  = 1 << 20
+	EVENT_JOURNAL_DEFAULT_FILES = 5
+
+	// number of events waiting to be written to the journal
+	EVENT_JOURNAL_QUEUE_SIZE = 1024
+)
+
+// JournalEntry is a control change event recorded in the event journal
+type JournalEntry struct {
+	Time      time.Time `json:"time"`
+	Device    string    `json:"device"`
+	Control   string    `json:"control"`
+	Type      string    `json:"type,omitempty"`
+	Value     any       `json:"value"`
+	PrevValue any       `json:"prevValue"`
+	Retained  bool      `json:"retained,omitempty"`
+	Complete  bool      `json:"complete,omitempty"`
+	// Local is set for the controls of the devices defined by the engine
+	Local bool `json:"local,omitempty"`
+}
+
+// EventJournal writes control change events to a JSON lines
+// rotating file keeping up to maxFiles files. The events are written by a separate goroutine, so recording
+// them doesn't wait for the disk
+type EventJournal struct {
+	sync.Mutex
+
+	file *rotatingFile
+	now  func() time.Time
+
+	queue    chan journalRecord
+	queueMtx sync.RWMutex
+	closed   bool
+	done     chan struct{}
+}
+
+// journalRecord is either a line to be written or a flush
+// request. flushed is closed when the lines queued before are written
+type journalRecord struct {
+	line    []byte
+	flushed chan struct{}
+}
+
+func NewEventJournal(path string, maxSize int64, maxFiles int) (*EventJournal, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid journal size limit: %d", maxSize)
+	}
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("invalid journal file count: %d", maxFiles)
+	}
+	file, err := openRotatingFile(path, maxSize, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	j := &EventJournal{
+		file:  file,
+		now:   time.Now,
+		queue: make(chan journalRecord, EVENT_JOURNAL_QUEUE_SIZE),
+		done:  make(chan struct{}),
+	}
+	go j.writeLoop()
+	return j, nil
+}
+
+func (j *EventJournal) writeLoop() {
+	for rec := range j.queue {
+		if rec.flushed != nil {
+			close(rec.flushed)
+		} else {
+			j.write(rec.line)
+		}
+	}
+	close(j.done)
+}
+
+// enqueue passes the record to the writer goroutine.
+// It returns false if the journal is closed
+func (j *EventJournal) enqueue(rec journalRecord) bool {
+	j.queueMtx.RLock()
+	defer j.queueMtx.RUnlock()
+	if j.closed {
+		return false
+	}
+	j.queue <- rec
+	return true
+}
+
+// Record queues the event to be written to the journal
+func (j *EventJournal) Record(e *ControlChangeEvent) {
+	line, err := json.Marshal(JournalEntry{
+		Time:      j.now(),
+		Device:    e.Spec.DeviceId,
+		Control:   e.Spec.ControlId,
+		Type:      e.ControlType,
+		Value:     e.Value,
+		PrevValue: e.PrevValue,
+		Retained:  e.IsRetained,
+		Complete:  e.IsComplete,
+		Local:     e.IsLocal,
+	})
+	if err != nil {
+		wbgong.Warn.Printf("can't record event %s to journal: %s", e.Spec, err)
+		return
+	}
+	j.enqueue(journalRecord{line: append(line, '\n')})
+}
+
+// Flush waits until the recorded events are written
+func (j *EventJournal) Flush() {
+	flushed := make(chan struct{})
+	if j.enqueue(journalRecord{flushed: flushed}) {
+		<-flushed
+	}
+}
+
+func (j *EventJournal) write(line []byte) {
+	j.Lock()
+	defer j.Unlock()
+	if _, err := j.file.Write(line); err != nil {
+		wbgong.Error.Printf("can't write event journal %s: %s", j.file.path, err)
+	}
+}
+
+// Window returns the recorded events that happened between from
+// and to, oldest first, preceded by the last events of the controls
+// recorded before from. Only these events are kept in memory
+// and the files aren't read past to
+func (j *EventJournal) Window(from, to time.Time) ([]JournalEntry, error) {
+	j.Flush()
+	j.Lock()
+	defer j.Unlock()
+
+	var initial, window []JournalEntry
+	last := make(map[string]int)
+	for n := j.file.maxFiles - 1; n >= 0; n-- {
+		f, err := os.Open(j.file.rotatedPath(n))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		done := false
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, int(j.file.maxSize)+bufio.MaxScanTokenSize)
+		for scanner.Scan() {
+			var entry JournalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				// skip partially written lines
+				continue
+			}
+			if !entry.Time.Before(to) {
+				done = true
+				break
+			}
+			if !entry.Time.Before(from) {
+				window = append(window, entry)
+				continue
+			}
+			control := entry.Device + "/" + entry.Control
+			if i, found := last[control]; found {
+				initial[i] = entry
+			} else {
+				last[control] = len(initial)
+				initial = append(initial, entry)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	return append(initial, window...), nil
+}
+
+// Close writes the queued events and closes the journal
+func (j *EventJournal) Close() error {
+	j.queueMtx.Lock()
+	if !j.closed {
+		j.closed = true
+		close(j.queue)
+	}
+	j.queueMtx.Unlock()
+	<-j.done
+
+	j.Lock()
+	defer j.Unlock()
+	return j.file.Close()
+}
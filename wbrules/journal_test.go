@@ -0,0 +1,169 @@
+package wbrules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func journalEvent(device, control string, value, prevValue any) *ControlChangeEvent {
+	return &ControlChangeEvent{
+		Spec:        ControlSpec{device, control},
+		ControlType: "value",
+		Value:       value,
+		PrevValue:   prevValue,
+		IsComplete:  true,
+	}
+}
+
+func TestEventJournalEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	journal, err := NewEventJournal(path, EVENT_JOURNAL_DEFAULT_SIZE, EVENT_JOURNAL_DEFAULT_FILES)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	journal.now = func() time.Time { return now }
+
+	journal.Record(journalEvent("somedev", "temp", 21.5, nil))
+	now = now.Add(time.Second)
+	local := journalEvent("vdev", "alarm", true, false)
+	local.IsLocal = true
+	journal.Record(local)
+	now = now.Add(time.Second)
+	journal.Record(journalEvent("somedev", "temp", 22.0, 21.5))
+
+	entries, err := journal.Window(start, start.Add(2*time.Second))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, start, entries[0].Time.UTC())
+	assert.Equal(t, "somedev", entries[0].Device)
+	assert.Equal(t, "temp", entries[0].Control)
+	assert.Equal(t, "value", entries[0].Type)
+	assert.Equal(t, 21.5, entries[0].Value)
+	assert.Nil(t, entries[0].PrevValue)
+	assert.True(t, entries[0].Complete)
+	assert.False(t, entries[0].Local)
+	assert.Equal(t, true, entries[1].Value)
+	assert.True(t, entries[1].Local)
+
+	// partially written lines are skipped
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("{\"time\":\"2026-03-01T10:0")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	entries, err = journal.Window(start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	// only the last events of the controls are kept before the window
+	entries, err = journal.Window(start.Add(3*time.Second), start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, 22.0, entries[0].Value)
+	assert.Equal(t, true, entries[1].Value)
+}
+
+func TestEventJournalRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	journal, err := NewEventJournal(path, 300, 3)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	now := start
+	journal.now = func() time.Time { return now }
+	for i := 0; i < 20; i++ {
+		journal.Record(journalEvent("somedev", "counter", float64(i), nil))
+		now = now.Add(time.Second)
+	}
+	journal.Flush()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		st, err := os.Stat(name)
+		require.NoError(t, err, name)
+		assert.LessOrEqual(t, st.Size(), int64(300), name)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	entries, err := journal.Window(start, now)
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+	assert.Less(t, len(entries), 20)
+	// the oldest entries are dropped, the rest are in order
+	for i, entry := range entries {
+		assert.Equal(t, float64(20-len(entries)+i), entry.Value)
+	}
+}
+
+func TestEventJournalRecordDoesntWaitForWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	journal, err := NewEventJournal(path, EVENT_JOURNAL_DEFAULT_SIZE, EVENT_JOURNAL_DEFAULT_FILES)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	journal.now = func() time.Time { return start }
+
+	// the writer is blocked as if the disk was slow
+	journal.Lock()
+	for i := 0; i < 10; i++ {
+		journal.Record(journalEvent("somedev", "counter", float64(i), nil))
+	}
+	journal.Unlock()
+
+	entries, err := journal.Window(start, start.Add(time.Second))
+	require.NoError(t, err)
+	assert.Len(t, entries, 10)
+}
+
+func TestNewEventJournalInvalidLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	_, err := NewEventJournal(path, 0, 1)
+	assert.Error(t, err)
+	_, err = NewEventJournal(path, 100, 0)
+	assert.Error(t, err)
+}
+
+func TestJournalSimScript(t *testing.T) {
+	from := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	to := from.Add(time.Minute)
+	entries := []JournalEntry{
+		{Time: from.Add(-time.Hour), Device: "somedev", Control: "temp", Type: "temperature", Value: "20"},
+		{Time: from.Add(-time.Minute), Device: "somedev", Control: "temp", Type: "temperature", Value: "21"},
+		{Time: from.Add(-time.Minute), Device: "other", Control: "sw", Type: "switch", Value: "0"},
+		{Time: from.Add(-time.Second), Device: "vdev", Control: "alarm", Type: "switch", Value: "1", Local: true},
+		{Time: from.Add(-time.Second), Device: "somedev", Control: "temp#error", Value: "r"},
+		{Time: from.Add(5 * time.Second), Device: "somedev", Control: "temp", Type: "temperature", Value: "22"},
+		{Time: from.Add(10 * time.Second), Device: "vdev", Control: "alarm", Type: "switch", Value: "0", Local: true},
+		{Time: from.Add(20 * time.Second), Device: "newdev", Control: "x", Type: "value", Value: "1"},
+		{Time: to, Device: "somedev", Control: "temp", Type: "temperature", Value: "23"},
+	}
+
+	script := journalSimScript(entries, from, to, false)
+	assert.Equal(t, "2026-03-01T10:00:00Z", script.Start)
+	assert.Equal(t, "1m0s", script.Duration)
+	assert.Equal(t, []SimEvent{
+		{At: "0s", Control: "other/sw", Type: "switch", Value: "0"},
+		{At: "0s", Control: "somedev/temp", Type: "temperature", Value: "21"},
+		{At: "5s", Control: "somedev/temp", Value: "22"},
+		{At: "20s", Control: "newdev/x", Type: "value", Value: "1"},
+	}, script.Events)
+
+	script = journalSimScript(entries, from, to, true)
+	assert.Equal(t, []SimEvent{
+		{At: "0s", Control: "other/sw", Type: "switch", Value: "0"},
+		{At: "0s", Control: "somedev/temp", Type: "temperature", Value: "21"},
+		{At: "5s", Control: "somedev/temp", Value: "22"},
+		{At: "10s", Control: "vdev/alarm", Value: "0", On: true},
+		{At: "20s", Control: "newdev/x", Type: "value", Value: "1"},
+	}, script.Events)
+}
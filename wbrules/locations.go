@@ -1,5 +1,7 @@
 package wbrules
 
+import "time"
+
 // LocItem represents a device or rule location in the source file
 type LocItem struct {
 	Line int    `json:"line"`
@@ -14,9 +16,21 @@ type LocFileEntry struct {
 	Rules       []LocItem    `json:"rules"`
 	Devices     []LocItem    `json:"devices"`
 	Timers      []LocItem    `json:"timers"`
+	// Quarantine is set when the script is unloaded
+	// because of too many runtime errors
+	Quarantine *ScriptQuarantine `json:"quarantine,omitempty"`
 
 	PhysicalPath string     `json:"-"`
 	Context      *ESContext `json:"-"`
+
+	// times of recent runtime errors, see ESEngine.noteScriptError()
+	errorTimes []time.Time
+}
+
+// ScriptQuarantine describes why and when the script was quarantined
+type ScriptQuarantine struct {
+	Since  time.Time `json:"since"`
+	Reason string    `json:"reason"`
 }
 
 // LocFileManager interface provides a way to access a list of source
@@ -25,6 +39,12 @@ type LocFileManager interface {
 	ScriptDir() string
 	ListSourceFiles() ([]LocFileEntry, error)
 	LiveWriteScript(virtualPath, content string) error
+	// UnquarantineScript reloads the quarantined script.
+	// It returns false if the script is not quarantined
+	UnquarantineScript(virtualPath string) (bool, error)
+	// MigrateScriptStorages moves local persistent storages
+	// of the script renamed from oldPath to newPath
+	MigrateScriptStorages(oldPath, newPath string) error
 }
 
 // ScriptError denotes an error that was caused by JavaScript code.
@@ -0,0 +1,154 @@
+package wbrules
+
+import (
+	"errors"
+	"time"
+)
+
+// LogSource provides access to the stored log records
+// and log levels of scripts and modules
+type LogSource interface {
+	QueryLog(q *LogQuery) (*LogQueryResult, error)
+	SetLogLevel(source string, level EngineLogLevel)
+	ResetLogLevel(source string)
+	LogLevels() map[string]EngineLogLevel
+}
+
+type Log struct {
+	source   LogSource
+	writable bool
+}
+
+type LogError struct {
+	code    int32
+	message string
+}
+
+func (err *LogError) Error() string {
+	return err.message
+}
+
+func (err *LogError) ErrorCode() int32 {
+	return err.code
+}
+
+const (
+	// no iota here because these values may be used
+	// by external software
+	LOG_ERROR_RING_DISABLED      = 1200
+	LOG_ERROR_INVALID_LEVEL      = 1201
+	LOG_ERROR_INVALID_TIME_RANGE = 1202
+	LOG_ERROR_INVALID_PAGE       = 1203
+	LOG_ERROR_INVALID_SOURCE     = 1204
+	LOG_ERROR_READ_ONLY          = 1205
+)
+
+var (
+	logRingDisabledError     = &LogError{LOG_ERROR_RING_DISABLED, "Log ring is disabled"}
+	invalidLogLevelError     = &LogError{LOG_ERROR_INVALID_LEVEL, "Invalid log level"}
+	invalidLogTimeRangeError = &LogError{LOG_ERROR_INVALID_TIME_RANGE, "Invalid time range"}
+	invalidLogPageError      = &LogError{LOG_ERROR_INVALID_PAGE, "Invalid offset or limit"}
+	invalidLogSourceError    = &LogError{LOG_ERROR_INVALID_SOURCE, "Script or module name is not specified"}
+	logReadOnlyError         = &LogError{LOG_ERROR_READ_ONLY, "Log level modification is disabled"}
+)
+
+// NewLog creates the log service. Unless writable is set,
+// SetLevel fails
+func NewLog(source LogSource, writable bool) *Log {
+	return &Log{source, writable}
+}
+
+type LogQueryArgs struct {
+	Level  string `json:"level"`
+	Script string `json:"script"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+func parseOptionalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// Query returns the stored log records, newest first. The records
+// may be filtered by the minimum level, the script and the time range
+// (RFC 3339 timestamps, both optional) and paginated using offset and limit
+func (log *Log) Query(args *LogQueryArgs, reply *LogQueryResult) error {
+	q := &LogQuery{
+		Level:  ENGINE_LOG_DEBUG,
+		Script: args.Script,
+		Offset: args.Offset,
+		Limit:  args.Limit,
+	}
+	if args.Level != "" {
+		level, err := ParseEngineLogLevel(args.Level)
+		if err != nil {
+			return invalidLogLevelError
+		}
+		q.Level = level
+	}
+
+	var err error
+	if q.From, err = parseOptionalTime(args.From); err != nil {
+		return invalidLogTimeRangeError
+	}
+	if q.To, err = parseOptionalTime(args.To); err != nil {
+		return invalidLogTimeRangeError
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return invalidLogTimeRangeError
+	}
+	if q.Offset < 0 || q.Limit < 0 {
+		return invalidLogPageError
+	}
+
+	result, err := log.source.QueryLog(q)
+	switch {
+	case errors.Is(err, errLogRingDisabled):
+		return logRingDisabledError
+	case err != nil:
+		return err
+	}
+
+	*reply = *result
+	return nil
+}
+
+type LogSetLevelArgs struct {
+	Source string `json:"source"`
+	Level  string `json:"level"`
+}
+
+// SetLevel sets the log level of the script (specified by its virtual
+// path, e.g. "heating.js") or the module (specified by its name).
+// Empty level resets it to the default one
+func (log *Log) SetLevel(args *LogSetLevelArgs, reply *bool) error {
+	if !log.writable {
+		return logReadOnlyError
+	}
+	if args.Source == "" {
+		return invalidLogSourceError
+	}
+	if args.Level == "" {
+		log.source.ResetLogLevel(args.Source)
+		*reply = true
+		return nil
+	}
+	level, err := ParseEngineLogLevel(args.Level)
+	if err != nil {
+		return invalidLogLevelError
+	}
+	log.source.SetLogLevel(args.Source, level)
+	*reply = true
+	return nil
+}
+
+// GetLevels returns log levels of the scripts and modules they're set for
+func (log *Log) GetLevels(args *struct{}, reply *map[string]EngineLogLevel) error {
+	*reply = log.source.LogLevels()
+	return nil
+}
@@ -0,0 +1,155 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/objx"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type LogRpcSuite struct {
+	testutils.Suite
+	*testutils.RpcFixture
+	ring   *LogRing
+	query  *LogQuery
+	levels map[string]EngineLogLevel
+}
+
+func (s *LogRpcSuite) T() *testing.T {
+	return s.Suite.T()
+}
+
+func (s *LogRpcSuite) SetupTest() {
+	s.Suite.SetupTest()
+	var err error
+	s.ring, err = NewLogRing(10, "")
+	s.Ck("NewLogRing()", err)
+	s.query = nil
+	s.levels = make(map[string]EngineLogLevel)
+	s.RpcFixture = testutils.NewRpcFixture(
+		s.T(), "wbrules", "Log", "wbrules",
+		NewLog(s, true),
+		"GetLevels", "Query", "SetLevel")
+}
+
+func (s *LogRpcSuite) TearDownTest() {
+	s.TearDownRPC()
+	s.Suite.TearDownTest()
+}
+
+func (s *LogRpcSuite) QueryLog(q *LogQuery) (*LogQueryResult, error) {
+	if s.ring == nil {
+		return nil, errLogRingDisabled
+	}
+	s.query = q
+	return s.ring.Query(q), nil
+}
+
+func (s *LogRpcSuite) SetLogLevel(source string, level EngineLogLevel) {
+	s.levels[source] = level
+}
+
+func (s *LogRpcSuite) ResetLogLevel(source string) {
+	delete(s.levels, source)
+}
+
+func (s *LogRpcSuite) LogLevels() map[string]EngineLogLevel {
+	return s.levels
+}
+
+func (s *LogRpcSuite) TestQuery() {
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	s.ring.Push(LogRecord{Timestamp: t0, Level: ENGINE_LOG_INFO, Message: "engine started"})
+	s.ring.Push(LogRecord{
+		Timestamp: t0.Add(time.Minute),
+		Level:     ENGINE_LOG_ERROR,
+		Script:    "heating.js",
+		Line:      14,
+		Rule:      "heater",
+		Message:   "too cold",
+	})
+	s.ring.Push(LogRecord{Timestamp: t0.Add(2 * time.Minute), Level: ENGINE_LOG_WARNING, Script: "heating.js", Message: "cold"})
+
+	s.VerifyRpc("Query", objx.Map{
+		"level":  "warning",
+		"script": "heating.js",
+		"from":   "2026-10-17T12:00:00Z",
+		"to":     "2026-10-17T13:00:00Z",
+		"offset": 1,
+		"limit":  1,
+	}, objx.Map{
+		"entries": []objx.Map{
+			{
+				"timestamp": "2026-10-17T12:01:00Z",
+				"level":     "error",
+				"script":    "heating.js",
+				"line":      14,
+				"rule":      "heater",
+				"message":   "too cold",
+			},
+		},
+		"total": 2,
+	})
+	s.Equal(&LogQuery{
+		Level:  ENGINE_LOG_WARNING,
+		Script: "heating.js",
+		From:   t0,
+		To:     t0.Add(time.Hour),
+		Offset: 1,
+		Limit:  1,
+	}, s.query)
+
+	s.VerifyRpc("Query", objx.Map{"limit": 1}, objx.Map{
+		"entries": []objx.Map{
+			{
+				"timestamp": "2026-10-17T12:02:00Z",
+				"level":     "warning",
+				"script":    "heating.js",
+				"message":   "cold",
+			},
+		},
+		"total": 3,
+	})
+}
+
+func (s *LogRpcSuite) TestQueryErrors() {
+	s.VerifyRpcError("Query", objx.Map{"level": "fatal"},
+		LOG_ERROR_INVALID_LEVEL, "LogError", "Invalid log level")
+	s.VerifyRpcError("Query", objx.Map{"from": "yesterday"},
+		LOG_ERROR_INVALID_TIME_RANGE, "LogError", "Invalid time range")
+	s.VerifyRpcError("Query", objx.Map{"from": "2026-10-17T13:00:00Z", "to": "2026-10-17T12:00:00Z"},
+		LOG_ERROR_INVALID_TIME_RANGE, "LogError", "Invalid time range")
+	s.VerifyRpcError("Query", objx.Map{"limit": -1},
+		LOG_ERROR_INVALID_PAGE, "LogError", "Invalid offset or limit")
+	s.Nil(s.query)
+
+	s.ring = nil
+	s.VerifyRpcError("Query", objx.Map{},
+		LOG_ERROR_RING_DISABLED, "LogError", "Log ring is disabled")
+}
+
+func (s *LogRpcSuite) TestLevels() {
+	s.VerifyRpc("GetLevels", objx.Map{}, objx.Map{})
+	s.VerifyRpc("SetLevel", objx.Map{"source": "heating.js", "level": "debug"}, true)
+	s.VerifyRpc("SetLevel", objx.Map{"source": "mymodule", "level": "error"}, true)
+	s.VerifyRpc("GetLevels", objx.Map{}, objx.Map{
+		"heating.js": "debug",
+		"mymodule":   "error",
+	})
+	s.VerifyRpc("SetLevel", objx.Map{"source": "heating.js"}, true)
+	s.VerifyRpc("GetLevels", objx.Map{}, objx.Map{"mymodule": "error"})
+
+	s.VerifyRpcError("SetLevel", objx.Map{"source": "heating.js", "level": "verbose"},
+		LOG_ERROR_INVALID_LEVEL, "LogError", "Invalid log level")
+	s.VerifyRpcError("SetLevel", objx.Map{"level": "debug"},
+		LOG_ERROR_INVALID_SOURCE, "LogError", "Script or module name is not specified")
+
+	var ok bool
+	s.Equal(logReadOnlyError, NewLog(s, false).SetLevel(&LogSetLevelArgs{Source: "heating.js", Level: "debug"}, &ok))
+	s.VerifyRpc("GetLevels", objx.Map{}, objx.Map{"mymodule": "error"})
+}
+
+func TestLogRpcSuite(t *testing.T) {
+	testutils.RunSuites(t, new(LogRpcSuite))
+}
@@ -0,0 +1,233 @@
+package wbrules
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wirenboard/wbgong"
+)
+
+const (
+	LOG_RING_DEFAULT_CAPACITY = 1000
+	// the backing file is compacted when it holds
+	// this many times more records than the ring
+	LOG_RING_FILE_SLACK = 2
+)
+
+// LogQuery selects log records. Records with level lower than Level
+// are skipped. Empty Script and zero From or To mean no restriction.
+// Offset and Limit paginate the matching records counted from
+// the newest one, zero Limit means no limit
+type LogQuery struct {
+	Level  EngineLogLevel
+	Script string
+	From   time.Time
+	To     time.Time
+	Offset int
+	Limit  int
+}
+
+func (q *LogQuery) match(record *LogRecord) bool {
+	switch {
+	case record.Level < q.Level:
+		return false
+	case q.Script != "" && record.Script != q.Script:
+		return false
+	case !q.From.IsZero() && record.Timestamp.Before(q.From):
+		return false
+	case !q.To.IsZero() && !record.Timestamp.Before(q.To):
+		return false
+	}
+	return true
+}
+
+type LogQueryResult struct {
+	// Entries are the matching records, newest first
+	Entries []LogRecord `json:"entries"`
+	// Total is the number of matching records in the ring
+	Total int `json:"total"`
+}
+
+// LogRing keeps the last log records in memory. If the path is
+// given, the records are also appended to a JSON lines file, so
+// they survive restarts. The file is rewritten with the contents
+// of the ring when it grows LOG_RING_FILE_SLACK times larger
+type LogRing struct {
+	sync.Mutex
+
+	entries []LogRecord
+	next    int
+	full    bool
+
+	path      string
+	file      *os.File
+	fileLines int
+}
+
+func NewLogRing(capacity int, path string) (*LogRing, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("invalid log ring capacity: %d", capacity)
+	}
+	r := &LogRing{
+		entries: make([]LogRecord, capacity),
+		path:    path,
+	}
+	if path == "" {
+		return r, nil
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if err := r.compact(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the records saved to the file before
+func (r *LogRing) load() error {
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record LogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// skip partially written lines
+			continue
+		}
+		r.push(record)
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the file with the records of the ring.
+// Must be called with r locked
+func (r *LogRing) compact() error {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+
+	tmpPath := r.path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	entries := r.ordered()
+	for _, record := range entries {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		return err
+	}
+
+	r.file, err = os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.fileLines = len(entries)
+	return nil
+}
+
+// push must be called with r locked
+func (r *LogRing) push(record LogRecord) {
+	r.entries[r.next] = record
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// ordered returns the records, oldest first.
+// Must be called with r locked
+func (r *LogRing) ordered() []LogRecord {
+	if !r.full {
+		return r.entries[:r.next]
+	}
+	entries := make([]LogRecord, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// Push adds the record to the ring dropping the oldest one if the ring is full
+func (r *LogRing) Push(record LogRecord) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.push(record)
+	if r.file == nil {
+		return
+	}
+
+	if r.fileLines >= LOG_RING_FILE_SLACK*len(r.entries) {
+		if err := r.compact(); err != nil {
+			wbgong.Error.Printf("can't compact log file %s: %s", r.path, err)
+			return
+		}
+		// the record is written by compact()
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		wbgong.Error.Printf("can't write log file %s: %s", r.path, err)
+		return
+	}
+	r.fileLines++
+}
+
+// Query returns the records matching the query
+func (r *LogRing) Query(q *LogQuery) *LogQueryResult {
+	r.Lock()
+	defer r.Unlock()
+
+	entries := r.ordered()
+	result := &LogQueryResult{Entries: make([]LogRecord, 0)}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !q.match(&entries[i]) {
+			continue
+		}
+		if result.Total >= q.Offset && (q.Limit <= 0 || len(result.Entries) < q.Limit) {
+			result.Entries = append(result.Entries, entries[i])
+		}
+		result.Total++
+	}
+	return result
+}
+
+func (r *LogRing) Close() error {
+	r.Lock()
+	defer r.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
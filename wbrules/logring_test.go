@@ -0,0 +1,136 @@
+package wbrules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logRingT0 = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func logRingRecord(n int, level EngineLogLevel, script string) LogRecord {
+	return LogRecord{
+		Timestamp: logRingT0.Add(time.Duration(n) * time.Second),
+		Level:     level,
+		Script:    script,
+		Message:   "msg" + strings.Repeat("!", n),
+	}
+}
+
+func logMessages(result *LogQueryResult) (r []string) {
+	for _, record := range result.Entries {
+		r = append(r, record.Message)
+	}
+	return
+}
+
+func TestLogRingEviction(t *testing.T) {
+	ring, err := NewLogRing(3, "")
+	require.NoError(t, err)
+	assert.Equal(t, &LogQueryResult{Entries: []LogRecord{}}, ring.Query(&LogQuery{}))
+
+	for n := 0; n < 5; n++ {
+		ring.Push(logRingRecord(n, ENGINE_LOG_INFO, ""))
+	}
+	result := ring.Query(&LogQuery{})
+	assert.Equal(t, []string{"msg!!!!", "msg!!!", "msg!!"}, logMessages(result))
+	assert.Equal(t, 3, result.Total)
+}
+
+func TestLogRingQuery(t *testing.T) {
+	ring, err := NewLogRing(10, "")
+	require.NoError(t, err)
+	ring.Push(logRingRecord(0, ENGINE_LOG_DEBUG, "a.js"))
+	ring.Push(logRingRecord(1, ENGINE_LOG_ERROR, "a.js"))
+	ring.Push(logRingRecord(2, ENGINE_LOG_INFO, "b.js"))
+	ring.Push(logRingRecord(3, ENGINE_LOG_WARNING, "a.js"))
+	ring.Push(logRingRecord(4, ENGINE_LOG_INFO, ""))
+	ring.Push(logRingRecord(5, ENGINE_LOG_ERROR, "a.js"))
+
+	for _, tc := range []struct {
+		name     string
+		query    LogQuery
+		messages []string
+		total    int
+	}{
+		{
+			name:     "level",
+			query:    LogQuery{Level: ENGINE_LOG_WARNING},
+			messages: []string{"msg!!!!!", "msg!!!", "msg!"},
+			total:    3,
+		},
+		{
+			name:     "script",
+			query:    LogQuery{Script: "a.js"},
+			messages: []string{"msg!!!!!", "msg!!!", "msg!", "msg"},
+			total:    4,
+		},
+		{
+			name:     "time range",
+			query:    LogQuery{From: logRingT0.Add(time.Second), To: logRingT0.Add(4 * time.Second)},
+			messages: []string{"msg!!!", "msg!!", "msg!"},
+			total:    3,
+		},
+		{
+			name:     "pagination",
+			query:    LogQuery{Script: "a.js", Offset: 1, Limit: 2},
+			messages: []string{"msg!!!", "msg!"},
+			total:    4,
+		},
+		{
+			name:  "offset out of range",
+			query: LogQuery{Offset: 10},
+			total: 6,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result := ring.Query(&tc.query)
+			assert.Equal(t, tc.messages, logMessages(result))
+			assert.Equal(t, tc.total, result.Total)
+		})
+	}
+}
+
+func TestLogRingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.jsonl")
+	ring, err := NewLogRing(2, path)
+	require.NoError(t, err)
+	for n := 0; n < 3; n++ {
+		ring.Push(logRingRecord(n, ENGINE_LOG_INFO, "a.js"))
+	}
+	require.NoError(t, ring.Close())
+
+	ring, err = NewLogRing(2, path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"msg!!", "msg!"}, logMessages(ring.Query(&LogQuery{})))
+	assert.Equal(t, logRingRecord(2, ENGINE_LOG_INFO, "a.js"), ring.Query(&LogQuery{}).Entries[0])
+
+	// the file is compacted on load and when it grows too large
+	countLines := func() int {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return strings.Count(string(data), "\n")
+	}
+	assert.Equal(t, 2, countLines())
+	ring.Push(logRingRecord(3, ENGINE_LOG_INFO, "a.js"))
+	ring.Push(logRingRecord(4, ENGINE_LOG_INFO, "a.js"))
+	assert.Equal(t, 4, countLines())
+	ring.Push(logRingRecord(5, ENGINE_LOG_INFO, "a.js"))
+	assert.Equal(t, 2, countLines())
+	require.NoError(t, ring.Close())
+
+	ring, err = NewLogRing(2, path)
+	require.NoError(t, err)
+	defer ring.Close()
+	assert.Equal(t, []string{"msg!!!!!", "msg!!!!"}, logMessages(ring.Query(&LogQuery{})))
+}
+
+func TestNewLogRingInvalidCapacity(t *testing.T) {
+	_, err := NewLogRing(0, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,430 @@
+package wbrules
+
+import (
+	"fmt"
+	"log/syslog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wirenboard/wbgong"
+)
+
+const (
+	LOG_SINK_QUEUE_LEN     = 1000
+	LOG_SINK_APP_NAME      = "wb-rules"
+	LOG_SINK_DIAL_TIMEOUT  = 5 * time.Second
+	LOG_SINK_WRITE_TIMEOUT = 5 * time.Second
+)
+
+// LogSink writes log records to some destination outside the engine
+type LogSink interface {
+	WriteRecord(record *LogRecord) error
+	Close() error
+}
+
+// origin returns the location of the record as
+// "script.js:14 (module mymodule, rule heater)"
+func (record *LogRecord) origin() string {
+	var b strings.Builder
+	if record.Script != "" {
+		b.WriteString(record.Script)
+		if record.Line > 0 {
+			fmt.Fprintf(&b, ":%d", record.Line)
+		}
+	}
+	var extra []string
+	if record.Module != "" {
+		extra = append(extra, "module "+record.Module)
+	}
+	if record.Rule != "" {
+		extra = append(extra, "rule "+record.Rule)
+	}
+	if len(extra) > 0 {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString("(" + strings.Join(extra, ", ") + ")")
+	}
+	return b.String()
+}
+
+// text returns the message prefixed with the origin of the record
+func (record *LogRecord) text() string {
+	if origin := record.origin(); origin != "" {
+		return origin + ": " + record.Message
+	}
+	return record.Message
+}
+
+// FileLogSink writes log records as text lines to a rotating
+// file keeping up to maxFiles files
+type FileLogSink struct {
+	file *rotatingFile
+}
+
+func NewFileLogSink(path string, maxSize int64, maxFiles int) (*FileLogSink, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid log file size limit: %d", maxSize)
+	}
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("invalid log file count: %d", maxFiles)
+	}
+	file, err := openRotatingFile(path, maxSize, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogSink{file}, nil
+}
+
+func (sink *FileLogSink) WriteRecord(record *LogRecord) error {
+	line := fmt.Sprintf("%s %s %s\n",
+		record.Timestamp.Format("2006-01-02T15:04:05.000Z07:00"), record.Level, record.text())
+	_, err := sink.file.Write([]byte(line))
+	return err
+}
+
+func (sink *FileLogSink) Close() error {
+	return sink.file.Close()
+}
+
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+func ParseSyslogFacility(s string) (syslog.Priority, error) {
+	if facility, found := syslogFacilities[s]; found {
+		return facility, nil
+	}
+	return 0, fmt.Errorf("invalid syslog facility %q", s)
+}
+
+func syslogSeverity(level EngineLogLevel) syslog.Priority {
+	switch level {
+	case ENGINE_LOG_DEBUG:
+		return syslog.LOG_DEBUG
+	case ENGINE_LOG_WARNING:
+		return syslog.LOG_WARNING
+	case ENGINE_LOG_ERROR:
+		return syslog.LOG_ERR
+	default:
+		return syslog.LOG_INFO
+	}
+}
+
+// LocalSyslogSink writes log records to the local syslog daemon
+// using the specified facility
+type LocalSyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewLocalSyslogSink(facility syslog.Priority) (*LocalSyslogSink, error) {
+	writer, err := syslog.New(facility|syslog.LOG_INFO, LOG_SINK_APP_NAME)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalSyslogSink{writer}, nil
+}
+
+func (sink *LocalSyslogSink) WriteRecord(record *LogRecord) error {
+	switch record.Level {
+	case ENGINE_LOG_DEBUG:
+		return sink.writer.Debug(record.text())
+	case ENGINE_LOG_WARNING:
+		return sink.writer.Warning(record.text())
+	case ENGINE_LOG_ERROR:
+		return sink.writer.Err(record.text())
+	default:
+		return sink.writer.Info(record.text())
+	}
+}
+
+func (sink *LocalSyslogSink) Close() error {
+	return sink.writer.Close()
+}
+
+// RemoteSyslogSink sends log records to a remote syslog server
+// in RFC 5424 format. Over TCP the messages are framed using
+// octet counting (RFC 6587), the connection is reestablished
+// after write errors
+type RemoteSyslogSink struct {
+	network  string
+	address  string
+	facility syslog.Priority
+	hostname string
+	procId   string
+
+	conn net.Conn
+}
+
+func NewRemoteSyslogSink(network, address string, facility syslog.Priority) (*RemoteSyslogSink, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("invalid syslog network %q (must be udp or tcp)", network)
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %s", address, err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &RemoteSyslogSink{
+		network:  network,
+		address:  address,
+		facility: facility,
+		hostname: hostname,
+		procId:   fmt.Sprint(os.Getpid()),
+	}, nil
+}
+
+// formatRFC5424 formats the record as a syslog message
+// without structured data and message id
+func (sink *RemoteSyslogSink) formatRFC5424(record *LogRecord) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+		sink.facility|syslogSeverity(record.Level),
+		record.Timestamp.Format("2006-01-02T15:04:05.000000Z07:00"),
+		sink.hostname, LOG_SINK_APP_NAME, sink.procId, record.text())
+}
+
+func (sink *RemoteSyslogSink) WriteRecord(record *LogRecord) error {
+	msg := sink.formatRFC5424(record)
+	if sink.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	if sink.conn == nil {
+		conn, err := net.DialTimeout(sink.network, sink.address, LOG_SINK_DIAL_TIMEOUT)
+		if err != nil {
+			return err
+		}
+		sink.conn = conn
+	}
+	sink.conn.SetWriteDeadline(time.Now().Add(LOG_SINK_WRITE_TIMEOUT))
+	if _, err := sink.conn.Write([]byte(msg)); err != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (sink *RemoteSyslogSink) Close() error {
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+// LogRateLimit allows up to Messages records of every script
+// within Interval, zero Messages means no limit
+type LogRateLimit struct {
+	Messages int
+	Interval time.Duration
+}
+
+type logRateWindow struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+type levelLogSink struct {
+	LogSink
+	level EngineLogLevel
+}
+
+// LogSinks passes the log records to the sinks. The records are written
+// by a separate goroutine, so slow sinks don't block the engine. If the
+// rate limit is set, the records exceeding it are dropped, and for every
+// script a warning with the number of suppressed records is written
+// when its rate limit interval ends
+type LogSinks struct {
+	sync.Mutex
+
+	sinks     []levelLogSink
+	rateLimit LogRateLimit
+	windows   map[string]*logRateWindow
+	now       func() time.Time
+
+	queue    chan *LogRecord
+	overflow bool
+	done     chan struct{}
+	quit     chan struct{}
+}
+
+func NewLogSinks(rateLimit LogRateLimit) *LogSinks {
+	return &LogSinks{
+		rateLimit: rateLimit,
+		windows:   make(map[string]*logRateWindow),
+		now:       time.Now,
+	}
+}
+
+// AddSink adds the sink that receives the records of the level and above.
+// Must be called before Start()
+func (s *LogSinks) AddSink(sink LogSink, level EngineLogLevel) {
+	s.sinks = append(s.sinks, levelLogSink{sink, level})
+}
+
+// Start starts the goroutine writing the records to the sinks
+func (s *LogSinks) Start() {
+	s.queue = make(chan *LogRecord, LOG_SINK_QUEUE_LEN)
+	s.done = make(chan struct{})
+	s.quit = make(chan struct{})
+	go s.run(s.queue)
+	if s.rateLimit.Messages > 0 {
+		go s.flushLoop()
+	}
+}
+
+func (s *LogSinks) run(queue chan *LogRecord) {
+	defer close(s.done)
+	for record := range queue {
+		for _, sink := range s.sinks {
+			if record.Level < sink.level {
+				continue
+			}
+			if err := sink.WriteRecord(record); err != nil {
+				wbgong.Warn.Printf("can't write log record to %T: %s", sink.LogSink, err)
+			}
+		}
+	}
+}
+
+func (s *LogSinks) flushLoop() {
+	ticker := time.NewTicker(s.rateLimit.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// enqueue must be called with s locked
+func (s *LogSinks) enqueue(record *LogRecord) {
+	select {
+	case s.queue <- record:
+		s.overflow = false
+	default:
+		if !s.overflow {
+			s.overflow = true
+			wbgong.Warn.Printf("log sink queue is full, dropping log records")
+		}
+	}
+}
+
+// suppressedRecord must be called with s locked
+func (s *LogSinks) suppressedRecord(script string, w *logRateWindow) *LogRecord {
+	return &LogRecord{
+		Timestamp: s.now(),
+		Level:     ENGINE_LOG_WARNING,
+		Script:    script,
+		Message:   fmt.Sprintf("%d messages suppressed", w.suppressed),
+	}
+}
+
+// Write passes the record to the sinks unless it exceeds the rate limit
+func (s *LogSinks) Write(record LogRecord) {
+	s.Lock()
+	defer s.Unlock()
+	if s.queue == nil {
+		return
+	}
+
+	if s.rateLimit.Messages > 0 {
+		now := s.now()
+		w := s.windows[record.Script]
+		if w == nil || now.Sub(w.start) >= s.rateLimit.Interval {
+			if w != nil && w.suppressed > 0 {
+				s.enqueue(s.suppressedRecord(record.Script, w))
+			}
+			w = &logRateWindow{start: now}
+			s.windows[record.Script] = w
+		}
+		w.count++
+		if w.count > s.rateLimit.Messages {
+			w.suppressed++
+			return
+		}
+	}
+	s.enqueue(&record)
+}
+
+// Flush writes the warnings about suppressed records
+// of the scripts whose rate limit intervals are over
+func (s *LogSinks) Flush() {
+	s.Lock()
+	defer s.Unlock()
+	s.flush(false)
+}
+
+// flush must be called with s locked
+func (s *LogSinks) flush(all bool) {
+	if s.queue == nil {
+		return
+	}
+
+	now := s.now()
+	for script, w := range s.windows {
+		if !all && now.Sub(w.start) < s.rateLimit.Interval {
+			continue
+		}
+		if w.suppressed > 0 {
+			s.enqueue(s.suppressedRecord(script, w))
+		}
+		delete(s.windows, script)
+	}
+}
+
+// Close writes the pending records and closes the sinks
+func (s *LogSinks) Close() error {
+	s.Lock()
+	s.flush(true)
+	queue := s.queue
+	s.queue = nil
+	s.Unlock()
+
+	if queue != nil {
+		close(s.quit)
+		close(queue)
+		<-s.done
+	}
+
+	var errs []string
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error closing log sinks: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package wbrules
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var logSinkT0 = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+var sampleLogRecord = LogRecord{
+	Timestamp: logSinkT0,
+	Level:     ENGINE_LOG_WARNING,
+	Script:    "heating.js",
+	Line:      14,
+	Rule:      "heater",
+	Message:   "too cold",
+}
+
+func TestLogRecordText(t *testing.T) {
+	assert.Equal(t, "heating.js:14 (rule heater): too cold", sampleLogRecord.text())
+	assert.Equal(t, "heating.js:3 (module mymodule): hi",
+		(&LogRecord{Script: "heating.js", Line: 3, Module: "mymodule", Message: "hi"}).text())
+	assert.Equal(t, "engine started", (&LogRecord{Message: "engine started"}).text())
+}
+
+func TestFileLogSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.log")
+	sink, err := NewFileLogSink(path, 100, 2)
+	require.NoError(t, err)
+
+	line := "2026-10-17T12:00:00.000Z warning heating.js:14 (rule heater): too cold\n"
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sink.WriteRecord(&sampleLogRecord))
+	}
+	require.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, line, string(data))
+	data, err = os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, line, string(data))
+	_, err = os.Stat(path + ".2")
+	assert.True(t, os.IsNotExist(err))
+}
+
+var rfc5424Rx = regexp.MustCompile(
+	`^<28>1 2026-10-17T12:00:00\.000000Z \S+ wb-rules \d+ - - heating\.js:14 \(rule heater\): too cold$`)
+
+func TestRemoteSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := NewRemoteSyslogSink("udp", conn.LocalAddr().String(), syslog.LOG_DAEMON)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.WriteRecord(&sampleLogRecord))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Regexp(t, rfc5424Rx, string(buf[:n]))
+}
+
+func TestRemoteSyslogSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	sink, err := NewRemoteSyslogSink("tcp", listener.Addr().String(), syslog.LOG_DAEMON)
+	require.NoError(t, err)
+	defer sink.Close()
+	require.NoError(t, sink.WriteRecord(&sampleLogRecord))
+	require.NoError(t, sink.WriteRecord(&sampleLogRecord))
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		var size int
+		_, err = fmt.Fscanf(r, "%d ", &size)
+		require.NoError(t, err)
+		msg := make([]byte, size)
+		_, err = io.ReadFull(r, msg)
+		require.NoError(t, err)
+		assert.Regexp(t, rfc5424Rx, string(msg))
+	}
+}
+
+func TestNewRemoteSyslogSinkInvalid(t *testing.T) {
+	_, err := NewRemoteSyslogSink("sctp", "127.0.0.1:514", syslog.LOG_DAEMON)
+	assert.Error(t, err)
+	_, err = NewRemoteSyslogSink("udp", "localhost", syslog.LOG_DAEMON)
+	assert.Error(t, err)
+}
+
+type fakeLogSink struct {
+	sync.Mutex
+	records []string
+	closed  bool
+}
+
+func (sink *fakeLogSink) WriteRecord(record *LogRecord) error {
+	sink.Lock()
+	defer sink.Unlock()
+	sink.records = append(sink.records, fmt.Sprintf("%s %s %s", record.Timestamp.Format("15:04:05"), record.Level, record.text()))
+	return nil
+}
+
+func (sink *fakeLogSink) Close() error {
+	sink.closed = true
+	return nil
+}
+
+func TestLogSinksLevels(t *testing.T) {
+	all, errors := &fakeLogSink{}, &fakeLogSink{}
+	sinks := NewLogSinks(LogRateLimit{})
+	sinks.AddSink(all, ENGINE_LOG_DEBUG)
+	sinks.AddSink(errors, ENGINE_LOG_ERROR)
+	sinks.Start()
+
+	sinks.Write(LogRecord{Timestamp: logSinkT0, Level: ENGINE_LOG_INFO, Message: "info"})
+	sinks.Write(LogRecord{Timestamp: logSinkT0, Level: ENGINE_LOG_ERROR, Message: "error"})
+	require.NoError(t, sinks.Close())
+
+	assert.Equal(t, []string{"12:00:00 info info", "12:00:00 error error"}, all.records)
+	assert.Equal(t, []string{"12:00:00 error error"}, errors.records)
+	assert.True(t, all.closed)
+	assert.True(t, errors.closed)
+}
+
+func TestLogSinksRateLimit(t *testing.T) {
+	sink := &fakeLogSink{}
+	sinks := NewLogSinks(LogRateLimit{Messages: 2, Interval: 10 * time.Second})
+	now := logSinkT0
+	sinks.now = func() time.Time { return now }
+	sinks.AddSink(sink, ENGINE_LOG_DEBUG)
+	sinks.Start()
+
+	write := func(script string, n int) {
+		sinks.Write(LogRecord{Timestamp: now, Level: ENGINE_LOG_INFO, Script: script, Message: fmt.Sprint(n)})
+	}
+	for n := 1; n <= 5; n++ {
+		write("a.js", n)
+	}
+	write("b.js", 1)
+
+	// the window of a.js is not over yet
+	now = now.Add(5 * time.Second)
+	sinks.Flush()
+	write("a.js", 6)
+
+	// a new window starts with the next message
+	now = now.Add(5 * time.Second)
+	write("a.js", 7)
+	for n := 8; n <= 10; n++ {
+		write("a.js", n)
+	}
+
+	// the summary is written when the window is over
+	now = now.Add(10 * time.Second)
+	sinks.Flush()
+	write("b.js", 2)
+	require.NoError(t, sinks.Close())
+
+	assert.Equal(t, []string{
+		"12:00:00 info a.js: 1",
+		"12:00:00 info a.js: 2",
+		"12:00:00 info b.js: 1",
+		"12:00:10 warning a.js: 4 messages suppressed",
+		"12:00:10 info a.js: 7",
+		"12:00:10 info a.js: 8",
+		"12:00:20 warning a.js: 2 messages suppressed",
+		"12:00:20 info b.js: 2",
+	}, sink.records)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wb-rules.conf")
+	logPath := filepath.Join(dir, "rules.log")
+	require.NoError(t, os.WriteFile(path, []byte(fmt.Sprintf(`{
+		"log": {
+			"sinks": [
+				{"type": "file", "path": %q, "level": "warning"},
+				{"type": "syslog", "network": "udp", "address": "127.0.0.1:514", "facility": "local3"}
+			],
+			"rateLimit": {"messages": 20, "interval": "10s"}
+		}
+	}`, logPath)), 0644))
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, &LogConfig{
+		Sinks: []LogSinkConfig{
+			{Type: "file", Path: logPath, Level: "warning"},
+			{Type: "syslog", Network: "udp", Address: "127.0.0.1:514", Facility: "local3"},
+		},
+		RateLimit: &LogRateLimitConfig{Messages: 20, Interval: "10s"},
+	}, config.Log)
+
+	sinks, err := config.Log.NewLogSinks()
+	require.NoError(t, err)
+	require.Len(t, sinks.sinks, 2)
+	assert.Equal(t, ENGINE_LOG_WARNING, sinks.sinks[0].level)
+	assert.Equal(t, ENGINE_LOG_DEBUG, sinks.sinks[1].level)
+	assert.Equal(t, syslog.LOG_LOCAL3, sinks.sinks[1].LogSink.(*RemoteSyslogSink).facility)
+	assert.Equal(t, LogRateLimit{Messages: 20, Interval: 10 * time.Second}, sinks.rateLimit)
+	sinks.Start()
+	sinks.Write(sampleLogRecord)
+	require.NoError(t, sinks.Close())
+	data, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "too cold\n"))
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, tc := range []struct{ name, config string }{
+		{"unknown field", `{"log": {"sink": []}}`},
+		{"invalid type", `{"log": {"sinks": [{"type": "journald"}]}}`},
+		{"no path", `{"log": {"sinks": [{"type": "file"}]}}`},
+		{"invalid level", `{"log": {"sinks": [{"type": "file", "path": "/tmp/x.log", "level": "fatal"}]}}`},
+		{"invalid facility", `{"log": {"sinks": [{"type": "syslog", "address": "127.0.0.1:514", "facility": "local9"}]}}`},
+		{"invalid rate limit", `{"log": {"sinks": [{"type": "syslog", "address": "127.0.0.1:514"}], "rateLimit": {"messages": 1}}}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "wb-rules.conf")
+			require.NoError(t, os.WriteFile(path, []byte(tc.config), 0644))
+			config, err := LoadConfig(path)
+			if err == nil {
+				_, err = config.Log.NewLogSinks()
+			}
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package wbrules
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wirenboard/wbgong"
+)
+
+// mqttTopicMatch checks whether the topic matches
+// the subscription pattern which may contain '+' and '#' wildcards
+func mqttTopicMatch(pattern, topic string) bool {
+	patternParts := strings.Split(pattern, "/")
+	topicParts := strings.Split(topic, "/")
+	for i, p := range patternParts {
+		if p == "#" {
+			return true
+		}
+		if i >= len(topicParts) {
+			return false
+		}
+		if p != "+" && p != topicParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(topicParts)
+}
+
+// MemMQTTBroker is an in-memory MQTT broker. It's used to run
+// the engine without a real broker (see Simulator). Like a real
+// broker, it keeps retained messages and delivers them on subscription
+type MemMQTTBroker struct {
+	sync.Mutex
+
+	clients  []*MemMQTTClient
+	retained map[string]wbgong.MQTTMessage
+	order    []string // retained topics in order of publication
+
+	delivered uint64 // atomic
+
+	onPublish func(clientId string, msg wbgong.MQTTMessage)
+}
+
+func NewMemMQTTBroker() *MemMQTTBroker {
+	return &MemMQTTBroker{
+		retained: make(map[string]wbgong.MQTTMessage),
+	}
+}
+
+// OnPublish sets a function that is called for every message
+// published via the broker
+func (b *MemMQTTBroker) OnPublish(f func(clientId string, msg wbgong.MQTTMessage)) {
+	b.Lock()
+	defer b.Unlock()
+	b.onPublish = f
+}
+
+func (b *MemMQTTBroker) MakeClient(id string) *MemMQTTClient {
+	b.Lock()
+	defer b.Unlock()
+	client := &MemMQTTClient{
+		broker: b,
+		id:     id,
+		subs:   make(map[string][]wbgong.MQTTMessageHandler),
+		ready:  make(chan struct{}),
+	}
+	client.cond = sync.NewCond(&client.Mutex)
+	close(client.ready)
+	b.clients = append(b.clients, client)
+	return client
+}
+
+// Idle returns true if all published messages
+// are handled by subscribers of started clients
+func (b *MemMQTTBroker) Idle() bool {
+	b.Lock()
+	defer b.Unlock()
+	for _, client := range b.clients {
+		if !client.idle() {
+			return false
+		}
+	}
+	return true
+}
+
+// Delivered returns the number of messages handled by subscribers so far
+func (b *MemMQTTBroker) Delivered() uint64 {
+	return atomic.LoadUint64(&b.delivered)
+}
+
+func (b *MemMQTTBroker) publish(from *MemMQTTClient, msg wbgong.MQTTMessage) {
+	b.Lock()
+	onPublish := b.onPublish
+	if msg.Retained {
+		if _, found := b.retained[msg.Topic]; found {
+			for i, topic := range b.order {
+				if topic == msg.Topic {
+					b.order = append(b.order[:i], b.order[i+1:]...)
+					break
+				}
+			}
+		}
+		if msg.Payload == "" {
+			delete(b.retained, msg.Topic)
+		} else {
+			b.retained[msg.Topic] = msg
+			b.order = append(b.order, msg.Topic)
+		}
+	}
+	// retain flag is cleared for messages delivered
+	// to existing subscriptions
+	live := msg
+	live.Retained = false
+	for _, client := range b.clients {
+		client.enqueueMatching(live)
+	}
+	b.Unlock()
+
+	if onPublish != nil {
+		onPublish(from.id, msg)
+	}
+}
+
+// retainedMatching must be called with b locked
+func (b *MemMQTTBroker) retainedMatching(pattern string) []wbgong.MQTTMessage {
+	var r []wbgong.MQTTMessage
+	for _, topic := range b.order {
+		if mqttTopicMatch(pattern, topic) {
+			r = append(r, b.retained[topic])
+		}
+	}
+	return r
+}
+
+type memMQTTDelivery struct {
+	handler wbgong.MQTTMessageHandler
+	msg     wbgong.MQTTMessage
+}
+
+// MemMQTTClient is a client of MemMQTTBroker implementing
+// wbgong.MQTTClient. Messages are delivered to the client's
+// handlers in order from a separate goroutine
+type MemMQTTClient struct {
+	sync.Mutex
+
+	broker  *MemMQTTBroker
+	id      string
+	subs    map[string][]wbgong.MQTTMessageHandler
+	queue   []memMQTTDelivery
+	busy    bool
+	cond    *sync.Cond
+	started bool
+	ready   chan struct{}
+}
+
+func (c *MemMQTTClient) WaitForReady() <-chan struct{} {
+	return c.ready
+}
+
+func (c *MemMQTTClient) Start() {
+	c.Lock()
+	defer c.Unlock()
+	if c.started {
+		return
+	}
+	c.started = true
+	go c.deliveryLoop()
+}
+
+func (c *MemMQTTClient) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	c.started = false
+	c.cond.Broadcast()
+}
+
+func (c *MemMQTTClient) deliveryLoop() {
+	c.Lock()
+	defer c.Unlock()
+	for {
+		for c.started && len(c.queue) == 0 {
+			c.cond.Wait()
+		}
+		if !c.started {
+			return
+		}
+		d := c.queue[0]
+		c.queue = c.queue[1:]
+		c.busy = true
+		c.Unlock()
+		d.handler(d.msg)
+		atomic.AddUint64(&c.broker.delivered, 1)
+		c.Lock()
+		c.busy = false
+	}
+}
+
+func (c *MemMQTTClient) idle() bool {
+	c.Lock()
+	defer c.Unlock()
+	return !c.started || (len(c.queue) == 0 && !c.busy)
+}
+
+// enqueue must be called with c locked
+func (c *MemMQTTClient) enqueue(handler wbgong.MQTTMessageHandler, msg wbgong.MQTTMessage) {
+	c.queue = append(c.queue, memMQTTDelivery{handler, msg})
+	c.cond.Signal()
+}
+
+// enqueueMatching must be called with the broker locked
+func (c *MemMQTTClient) enqueueMatching(msg wbgong.MQTTMessage) {
+	c.Lock()
+	defer c.Unlock()
+	for pattern, handlers := range c.subs {
+		if !mqttTopicMatch(pattern, msg.Topic) {
+			continue
+		}
+		for _, handler := range handlers {
+			c.enqueue(handler, msg)
+		}
+	}
+}
+
+func (c *MemMQTTClient) Publish(message wbgong.MQTTMessage) {
+	c.broker.publish(c, message)
+}
+
+func (c *MemMQTTClient) Subscribe(callback wbgong.MQTTMessageHandler, topics ...string) {
+	c.broker.Lock()
+	defer c.broker.Unlock()
+	c.Lock()
+	defer c.Unlock()
+	for _, topic := range topics {
+		c.subs[topic] = append(c.subs[topic], callback)
+		for _, msg := range c.broker.retainedMatching(topic) {
+			c.enqueue(callback, msg)
+		}
+	}
+}
+
+func (c *MemMQTTClient) Unsubscribe(topics ...string) {
+	c.Lock()
+	defer c.Unlock()
+	for _, topic := range topics {
+		delete(c.subs, topic)
+	}
+}
@@ -0,0 +1,127 @@
+package wbrules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+const (
+	METRICS_QUANTILES_WINDOW = 5 * time.Minute
+)
+
+var metricsQuantiles = []float64{0.99}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricName formats metric name with labels given as name, value pairs
+func metricName(name string, labels ...string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, labels[i], metricLabelEscaper.Replace(labels[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// execMetrics is a set of rule execution metrics
+// for a single rule or for all rules of a script
+type execMetrics struct {
+	invocations     *metrics.Counter
+	fires           *metrics.Counter
+	errors          *metrics.Counter
+	thenDuration    *metrics.Histogram
+	thenDurationP99 *metrics.Summary
+	syncQueueWait   *metrics.Histogram
+}
+
+func (m *execMetrics) observe(entry *RuleTraceEntry) {
+	m.invocations.Inc()
+	if entry.Fired {
+		m.fires.Inc()
+		m.thenDuration.Update(entry.thenDuration.Seconds())
+		m.thenDurationP99.Update(entry.thenDuration.Seconds())
+	}
+	if entry.Error != nil {
+		m.errors.Inc()
+	}
+	if entry.syncQueued {
+		m.syncQueueWait.Update(entry.syncWait.Seconds())
+	}
+}
+
+// RuleMetrics holds metrics of a single rule. Rule metrics are
+// removed together with the rule, script metrics are kept
+// across script reloads
+type RuleMetrics struct {
+	set    *metrics.Set
+	rule   execMetrics
+	script *execMetrics
+}
+
+func (m *RuleMetrics) Observe(entry *RuleTraceEntry) {
+	m.rule.observe(entry)
+	if m.script != nil {
+		m.script.observe(entry)
+	}
+}
+
+func (m *RuleMetrics) Unregister() {
+	metrics.UnregisterSet(m.set, true)
+}
+
+func ruleMetricLabel(rule *Rule) string {
+	if rule.name == "" {
+		// anonymous rule
+		return "#" + strconv.FormatUint(uint64(rule.id), 10)
+	}
+	return rule.name
+}
+
+// newRuleMetrics creates and registers metrics for the rule
+func (engine *RuleEngine) newRuleMetrics(rule *Rule) *RuleMetrics {
+	labels := []string{"rule", ruleMetricLabel(rule), "script", rule.script}
+	s := metrics.NewSet()
+	m := &RuleMetrics{
+		set: s,
+		rule: execMetrics{
+			invocations:  s.NewCounter(metricName("wbrules_rule_invocations_total", labels...)),
+			fires:        s.NewCounter(metricName("wbrules_rule_fires_total", labels...)),
+			errors:       s.NewCounter(metricName("wbrules_rule_errors_total", labels...)),
+			thenDuration: s.NewHistogram(metricName("wbrules_rule_then_duration_seconds", labels...)),
+			thenDurationP99: s.NewSummaryExt(metricName("wbrules_rule_then_duration_quantile_seconds", labels...),
+				METRICS_QUANTILES_WINDOW, metricsQuantiles),
+			syncQueueWait: s.NewHistogram(metricName("wbrules_rule_sync_queue_wait_seconds", labels...)),
+		},
+		script: engine.getScriptMetrics(rule.script),
+	}
+	engine.registerMetrics(s)
+	return m
+}
+
+func (engine *RuleEngine) registerMetrics(s *metrics.Set) {
+	if engine.exportMetrics {
+		metrics.RegisterSet(s)
+	}
+}
+
+func (engine *RuleEngine) getScriptMetrics(script string) *execMetrics {
+	s := engine.scriptMetrics
+	return &execMetrics{
+		invocations:  s.GetOrCreateCounter(metricName("wbrules_script_invocations_total", "script", script)),
+		fires:        s.GetOrCreateCounter(metricName("wbrules_script_fires_total", "script", script)),
+		errors:       s.GetOrCreateCounter(metricName("wbrules_script_errors_total", "script", script)),
+		thenDuration: s.GetOrCreateHistogram(metricName("wbrules_script_then_duration_seconds", "script", script)),
+		thenDurationP99: s.GetOrCreateSummaryExt(metricName("wbrules_script_then_duration_quantile_seconds", "script", script),
+			METRICS_QUANTILES_WINDOW, metricsQuantiles),
+		syncQueueWait: s.GetOrCreateHistogram(metricName("wbrules_script_sync_queue_wait_seconds", "script", script)),
+	}
+}
@@ -0,0 +1,80 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricName(t *testing.T) {
+	assert.Equal(t, `m{}`, metricName("m"))
+	assert.Equal(t, `m{rule="r",script="s.js"}`, metricName("m", "rule", "r", "script", "s.js"))
+	assert.Equal(t, `m{rule="a\"b\\c\nd"}`, metricName("m", "rule", "a\"b\\c\nd"))
+}
+
+func TestRuleMetricLabel(t *testing.T) {
+	assert.Equal(t, "foo", ruleMetricLabel(&Rule{id: 5, name: "foo"}))
+	assert.Equal(t, "#5", ruleMetricLabel(&Rule{id: 5}))
+}
+
+func newTestExecMetrics(s *metrics.Set, prefix string) execMetrics {
+	return execMetrics{
+		invocations:     s.NewCounter(prefix + "_invocations_total"),
+		fires:           s.NewCounter(prefix + "_fires_total"),
+		errors:          s.NewCounter(prefix + "_errors_total"),
+		thenDuration:    s.NewHistogram(prefix + "_then_duration_seconds"),
+		thenDurationP99: s.NewSummary(prefix + "_then_duration_quantile_seconds"),
+		syncQueueWait:   s.NewHistogram(prefix + "_sync_queue_wait_seconds"),
+	}
+}
+
+func histogramCount(h *metrics.Histogram) (n uint64) {
+	h.VisitNonZeroBuckets(func(vmrange string, count uint64) {
+		n += count
+	})
+	return
+}
+
+func TestRuleMetricsObserve(t *testing.T) {
+	s := metrics.NewSet()
+	script := newTestExecMetrics(s, "script")
+	m := &RuleMetrics{
+		set:    s,
+		rule:   newTestExecMetrics(s, "rule"),
+		script: &script,
+	}
+
+	m.Observe(&RuleTraceEntry{})
+	m.Observe(&RuleTraceEntry{Fired: true, thenDuration: 2 * time.Millisecond})
+	m.Observe(&RuleTraceEntry{Fired: true, thenDuration: time.Millisecond, Error: &ScriptError{}})
+	m.Observe(&RuleTraceEntry{syncWait: 3 * time.Second, syncQueued: true})
+
+	for _, em := range []*execMetrics{&m.rule, m.script} {
+		assert.Equal(t, uint64(4), em.invocations.Get())
+		assert.Equal(t, uint64(2), em.fires.Get())
+		assert.Equal(t, uint64(1), em.errors.Get())
+		// only the queued handler is counted
+		assert.Equal(t, uint64(1), histogramCount(em.syncQueueWait))
+	}
+}
+
+func TestMeasureSyncWait(t *testing.T) {
+	engine := &RuleEngine{syncQueueWait: metrics.NewSet().NewHistogram("wait")}
+
+	_, active := engine.activeSyncWait()
+	assert.False(t, active)
+
+	var wait time.Duration
+	thunk := engine.measureSyncWait(func() {
+		wait, active = engine.activeSyncWait()
+	})
+	time.Sleep(10 * time.Millisecond)
+	thunk()
+	assert.True(t, active)
+	assert.GreaterOrEqual(t, wait, 10*time.Millisecond)
+
+	_, active = engine.activeSyncWait()
+	assert.False(t, active)
+}
@@ -0,0 +1,343 @@
+package wbrules
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/wirenboard/wbgong"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// keeps write times and expiration times of persistent storage keys,
+	// a nested bucket per storage
+	STORAGE_META_BUCKET = INTERNAL_BUCKET_PREFIX + "storage_meta"
+
+	STORAGE_EVICTED_TTL   = "ttl"
+	STORAGE_EVICTED_QUOTA = "quota"
+
+	STORAGE_KEY_META_SIZE = 16
+
+	// STORAGE_TTL_KEEP keeps the expiration time of the key
+	// when it's rewritten, see putKeyMeta()
+	STORAGE_TTL_KEEP time.Duration = -1
+)
+
+// StorageQuota limits the size of a persistent storage,
+// zero values mean no limit. Size is counted as the total
+// length of the keys and JSON encoded values in bytes
+type StorageQuota struct {
+	MaxKeys int
+	MaxSize int
+}
+
+func (quota StorageQuota) limited() bool {
+	return quota.MaxKeys > 0 || quota.MaxSize > 0
+}
+
+// keyMeta is the metadata of a persistent storage key.
+// Times are unix nanoseconds, zero expires means no expiration
+type keyMeta struct {
+	written int64
+	expires int64
+}
+
+func (meta keyMeta) encode() []byte {
+	buf := make([]byte, STORAGE_KEY_META_SIZE)
+	binary.BigEndian.PutUint64(buf, uint64(meta.written))
+	binary.BigEndian.PutUint64(buf[8:], uint64(meta.expires))
+	return buf
+}
+
+func decodeKeyMeta(v []byte) (meta keyMeta, ok bool) {
+	if len(v) != STORAGE_KEY_META_SIZE {
+		return meta, false
+	}
+	meta.written = int64(binary.BigEndian.Uint64(v))
+	meta.expires = int64(binary.BigEndian.Uint64(v[8:]))
+	return meta, true
+}
+
+func (meta keyMeta) expired(now time.Time) bool {
+	return meta.expires != 0 && meta.expires <= now.UnixNano()
+}
+
+// storageMeta returns the metadata bucket of the storage, it's nil
+// if the storage has no metadata and create is not set
+func storageMeta(tx *bolt.Tx, bucket string, create bool) (*bolt.Bucket, error) {
+	if !create {
+		if root := tx.Bucket([]byte(STORAGE_META_BUCKET)); root != nil {
+			return root.Bucket([]byte(bucket)), nil
+		}
+		return nil, nil
+	}
+	root, err := tx.CreateBucketIfNotExists([]byte(STORAGE_META_BUCKET))
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateBucketIfNotExists([]byte(bucket))
+}
+
+func getKeyMeta(meta *bolt.Bucket, key string) (keyMeta, bool) {
+	if meta == nil {
+		return keyMeta{}, false
+	}
+	return decodeKeyMeta(meta.Get([]byte(key)))
+}
+
+// keyExpired checks whether the key of the storage has expired
+// but isn't removed by the sweeper yet
+func keyExpired(tx *bolt.Tx, bucket, key string, now time.Time) bool {
+	meta, _ := storageMeta(tx, bucket, false)
+	m, ok := getKeyMeta(meta, key)
+	return ok && m.expired(now)
+}
+
+// putKeyMeta records the write of the key. The metadata is kept only
+// for the keys with TTL and the keys of the storages with quotas,
+// the metadata of other keys is removed. STORAGE_TTL_KEEP ttl keeps
+// the expiration time of the key unless it has already expired,
+// zero ttl removes it
+func putKeyMeta(tx *bolt.Tx, bucket, key string, now time.Time, ttl time.Duration, quota StorageQuota) error {
+	m := keyMeta{written: now.UnixNano()}
+	if ttl == STORAGE_TTL_KEEP {
+		meta, _ := storageMeta(tx, bucket, false)
+		if old, ok := getKeyMeta(meta, key); ok && !old.expired(now) {
+			m.expires = old.expires
+		}
+	} else if ttl > 0 {
+		m.expires = now.Add(ttl).UnixNano()
+	}
+	if m.expires == 0 && !quota.limited() {
+		return deleteKeyMeta(tx, bucket, key)
+	}
+	meta, err := storageMeta(tx, bucket, true)
+	if err != nil {
+		return err
+	}
+	return meta.Put([]byte(key), m.encode())
+}
+
+// deleteKeyMeta removes the metadata of the key
+// or of the whole storage if the key is empty
+func deleteKeyMeta(tx *bolt.Tx, bucket, key string) error {
+	root := tx.Bucket([]byte(STORAGE_META_BUCKET))
+	if root == nil {
+		return nil
+	}
+	if key == "" {
+		if err := root.DeleteBucket([]byte(bucket)); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	}
+	if meta := root.Bucket([]byte(bucket)); meta != nil {
+		return meta.Delete([]byte(key))
+	}
+	return nil
+}
+
+// quotaVictims returns the keys to remove from the storage to fit the
+// quota. Least recently written keys are removed first, the keys written
+// without the metadata are considered the oldest ones. The key keep
+// is never removed
+func quotaVictims(tx *bolt.Tx, b *bolt.Bucket, bucket, keep string, quota StorageQuota) []string {
+	if !quota.limited() {
+		return nil
+	}
+
+	type candidate struct {
+		key     string
+		size    int
+		written int64
+	}
+	meta, _ := storageMeta(tx, bucket, false)
+	candidates := make([]candidate, 0)
+	count, size := 0, 0
+	b.ForEach(func(k, v []byte) error {
+		count++
+		size += len(k) + len(v)
+		if string(k) != keep {
+			m, _ := getKeyMeta(meta, string(k))
+			candidates = append(candidates, candidate{string(k), len(k) + len(v), m.written})
+		}
+		return nil
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].written < candidates[j].written
+	})
+
+	victims := make([]string, 0)
+	for _, c := range candidates {
+		if (quota.MaxKeys == 0 || count <= quota.MaxKeys) && (quota.MaxSize == 0 || size <= quota.MaxSize) {
+			break
+		}
+		victims = append(victims, c.key)
+		count--
+		size -= c.size
+	}
+	return victims
+}
+
+// migrateStorageMeta moves the metadata of the storage to the new bucket
+func migrateStorageMeta(tx *bolt.Tx, bucket, newBucket string) error {
+	meta, _ := storageMeta(tx, bucket, false)
+	if meta == nil {
+		return nil
+	}
+	dst, err := storageMeta(tx, newBucket, true)
+	if err != nil {
+		return err
+	}
+	if err := meta.ForEach(func(k, v []byte) error {
+		return dst.Put(k, v)
+	}); err != nil {
+		return err
+	}
+	return deleteKeyMeta(tx, bucket, "")
+}
+
+func (engine *ESEngine) initStorageMetrics() {
+	s := metrics.NewSet()
+	engine.storageEvicted = map[string]*metrics.Counter{
+		STORAGE_EVICTED_TTL:   s.NewCounter(metricName("wbrules_storage_evicted_keys_total", "reason", STORAGE_EVICTED_TTL)),
+		STORAGE_EVICTED_QUOTA: s.NewCounter(metricName("wbrules_storage_evicted_keys_total", "reason", STORAGE_EVICTED_QUOTA)),
+	}
+	engine.registerMetrics(s)
+}
+
+func (engine *ESEngine) countEvicted(reason string, n int) {
+	if c := engine.storageEvicted[reason]; c != nil && n > 0 {
+		c.Add(n)
+	}
+}
+
+// setStorageQuota sets the quota of the storage defined by a script,
+// a zero quota removes the limits
+func (engine *ESEngine) setStorageQuota(bucket string, quota StorageQuota) {
+	engine.storageQuotasMtx.Lock()
+	defer engine.storageQuotasMtx.Unlock()
+	if quota.limited() {
+		engine.storageQuotas[bucket] = quota
+	} else {
+		delete(engine.storageQuotas, bucket)
+	}
+}
+
+func (engine *ESEngine) storageQuota(bucket string) StorageQuota {
+	engine.storageQuotasMtx.Lock()
+	defer engine.storageQuotasMtx.Unlock()
+	return engine.storageQuotas[bucket]
+}
+
+// sweepStorage removes the keys expired by now
+// and returns the number of removed keys
+func (engine *ESEngine) sweepStorage(now time.Time) (int, error) {
+	var changes []storageChange
+	removed := 0
+	err := engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		root := tx.Bucket([]byte(STORAGE_META_BUCKET))
+		if root == nil {
+			return nil
+		}
+		buckets := make([]string, 0)
+		root.ForEach(func(k, v []byte) error {
+			if v == nil {
+				buckets = append(buckets, string(k))
+			}
+			return nil
+		})
+
+		for _, bucket := range buckets {
+			meta := root.Bucket([]byte(bucket))
+			b := tx.Bucket([]byte(bucket))
+			expired := make([]string, 0)
+			meta.ForEach(func(k, v []byte) error {
+				m, ok := decodeKeyMeta(v)
+				// also drop the metadata of the keys removed without it
+				if !ok || m.expired(now) || b == nil || b.Get(k) == nil {
+					expired = append(expired, string(k))
+				}
+				return nil
+			})
+			for _, key := range expired {
+				if b != nil && b.Get([]byte(key)) != nil {
+					changes = append(changes, engine.keyChange(b, bucket, key, nil)...)
+					if err := b.Delete([]byte(key)); err != nil {
+						return err
+					}
+					removed++
+				}
+				if err := meta.Delete([]byte(key)); err != nil {
+					return err
+				}
+			}
+			// Stats() doesn't count the changes of the current transaction
+			if k, _ := meta.Cursor().First(); k == nil {
+				if err := root.DeleteBucket([]byte(bucket)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	engine.notifyStorageChanges(changes)
+	engine.countEvicted(STORAGE_EVICTED_TTL, removed)
+	return removed, nil
+}
+
+// SweepPersistentStorage removes expired persistent storage keys
+// and the histories of the controls which aren't recorded anymore.
+// It's called periodically if the sweep interval is set in the
+// engine options
+func (engine *ESEngine) SweepPersistentStorage() {
+	if engine.persistentDB == nil {
+		return
+	}
+	n, err := engine.sweepStorage(engine.clock.Now())
+	if err != nil {
+		engine.Logf(ENGINE_LOG_ERROR, "can't remove expired persistent storage keys: %s", err)
+		return
+	}
+	if n > 0 {
+		wbgong.Debug.Printf("removed %d expired persistent storage key(s)", n)
+	}
+
+	if n, err = engine.sweepHistory(engine.clock.Now()); err != nil {
+		engine.Logf(ENGINE_LOG_ERROR, "can't remove stale control histories: %s", err)
+		return
+	}
+	if n > 0 {
+		wbgong.Debug.Printf("removed %d stale control histories", n)
+	}
+}
+
+// parseStorageQuota parses maxKeys and maxSize
+// options of PersistentStorage()
+func parseStorageQuota(ctx *ESContext, objIndex int) (quota StorageQuota, err error) {
+	for _, opt := range []struct {
+		name string
+		v    *int
+	}{
+		{"maxKeys", &quota.MaxKeys},
+		{"maxSize", &quota.MaxSize},
+	} {
+		if !ctx.HasPropString(objIndex, opt.name) {
+			continue
+		}
+		ctx.GetPropString(objIndex, opt.name)
+		isNumber, n := ctx.IsNumber(-1), ctx.GetNumber(-1)
+		ctx.Pop()
+		if !isNumber || n < 0 || n != float64(int(n)) {
+			return quota, fmt.Errorf("%s: non-negative integer expected", opt.name)
+		}
+		*opt.v = int(n)
+	}
+	return
+}
@@ -0,0 +1,201 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong/testutils"
+	bolt "go.etcd.io/bbolt"
+)
+
+type PersistentLimitsSuite struct {
+	RuleSuiteBase
+}
+
+func (s *PersistentLimitsSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_persistent_limits.js")
+}
+
+func (s *PersistentLimitsSuite) TestTTL() {
+	s.engine.EvalScript("testTTL()")
+	s.Verify(
+		"[info] short = 1, has short: true",
+		"[info] short changed from undefined to 1",
+	)
+
+	time.Sleep(10 * time.Millisecond)
+	s.engine.EvalScript("testExpired()")
+	s.Verify(
+		"[info] short = undefined, has short: false",
+		`[info] keys: ["long","plain"]`,
+	)
+
+	s.engine.SweepPersistentStorage()
+	s.Verify("[info] short changed from 1 to undefined")
+}
+
+func (s *PersistentLimitsSuite) TestKeepTTL() {
+	s.engine.EvalScript("testKeepTTL()")
+	s.Verify("[info] obj.count = 2")
+
+	time.Sleep(300 * time.Millisecond)
+	s.engine.EvalScript("testKeepTTLExpired()")
+	s.Verify("[info] has obj: false, untimed = 2")
+}
+
+func (s *PersistentLimitsSuite) TestQuota() {
+	s.engine.EvalScript("testQuota()")
+	s.Verify(
+		`[info] keys: ["b","c"]`,
+		`[info] keys: ["b","d"]`,
+	)
+}
+
+func (s *PersistentLimitsSuite) TestErrors() {
+	s.engine.EvalScript("testErrors()")
+	s.Verify(
+		"[info] caught: can't write to persistent storage limited: 'big': value exceeds the storage size limit of 40 bytes",
+		`[info] caught: bad persistent storage set options: ttl: invalid duration: "soon"`,
+		"[info] caught: bad persistent storage options: maxKeys: non-negative integer expected",
+		`[info] keys: []`,
+	)
+}
+
+func TestPersistentLimitsSuite(t *testing.T) {
+	testutils.RunSuites(t, new(PersistentLimitsSuite))
+}
+
+func TestQuotaVictims(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	quota := StorageQuota{MaxKeys: 3, MaxSize: 12}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("test"))
+		require.NoError(t, err)
+		// "legacy" is written before the quota is set and has no metadata
+		require.NoError(t, b.Put([]byte("legacy"), []byte("1")))
+		for i, key := range []string{"c", "a", "b"} {
+			require.NoError(t, b.Put([]byte(key), []byte("1")))
+			require.NoError(t, putKeyMeta(tx, "test", key, now.Add(time.Duration(i)*time.Second), 0, quota))
+		}
+
+		require.Equal(t, []string{"legacy"}, quotaVictims(tx, b, "test", "b", quota))
+		require.Equal(t, []string{"legacy", "c"}, quotaVictims(tx, b, "test", "b", StorageQuota{MaxKeys: 2}))
+		// 2 bytes per key, the kept key is never evicted
+		require.Equal(t, []string{"legacy", "c", "a"}, quotaVictims(tx, b, "test", "b", StorageQuota{MaxSize: 2}))
+		require.Empty(t, quotaVictims(tx, b, "test", "b", StorageQuota{}))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestSweepStorage(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	engine := &ESEngine{persistentDB: db}
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("test"))
+		require.NoError(t, err)
+		for key, ttl := range map[string]time.Duration{"short": time.Minute, "long": time.Hour, "plain": 0} {
+			require.NoError(t, b.Put([]byte(key), []byte("1")))
+			require.NoError(t, putKeyMeta(tx, "test", key, now, ttl, StorageQuota{}))
+		}
+		require.False(t, keyExpired(tx, "test", "short", now))
+		require.True(t, keyExpired(tx, "test", "short", now.Add(time.Minute)))
+		require.False(t, keyExpired(tx, "test", "plain", now.Add(time.Minute)))
+		return nil
+	})
+	require.NoError(t, err)
+
+	n, err := engine.sweepStorage(now.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	// a plain write removes TTL
+	require.NoError(t, engine.StorageSet("test", "long", json.RawMessage(`2`)))
+	n, err = engine.sweepStorage(now.Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	buckets, err := engine.StorageBuckets()
+	require.NoError(t, err)
+	require.Equal(t, []StorageBucketInfo{{Bucket: "test", Name: "test", Keys: []string{"long", "plain"}}}, buckets)
+
+	// the metadata of the storage is removed with the last expiring key
+	db.View(func(tx *bolt.Tx) error {
+		meta, _ := storageMeta(tx, "test", false)
+		require.Nil(t, meta)
+		return nil
+	})
+
+	// ...even if the key is removed by the same sweep
+	db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("test"))
+		require.NoError(t, b.Put([]byte("short"), []byte("1")))
+		require.NoError(t, putKeyMeta(tx, "test", "short", now, time.Minute, StorageQuota{}))
+		return nil
+	})
+	n, err = engine.sweepStorage(now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	db.View(func(tx *bolt.Tx) error {
+		meta, _ := storageMeta(tx, "test", false)
+		require.Nil(t, meta)
+		return nil
+	})
+}
+
+func TestPutKeyMetaKeepTTL(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		require.NoError(t, putKeyMeta(tx, "test", "key", now, time.Minute, StorageQuota{}))
+		require.NoError(t, putKeyMeta(tx, "test", "key", now.Add(time.Second), STORAGE_TTL_KEEP, StorageQuota{}))
+		require.False(t, keyExpired(tx, "test", "key", now.Add(time.Minute-time.Millisecond)))
+		require.True(t, keyExpired(tx, "test", "key", now.Add(time.Minute)))
+
+		// the expired key is written anew
+		require.NoError(t, putKeyMeta(tx, "test", "key", now.Add(time.Minute), STORAGE_TTL_KEEP, StorageQuota{}))
+		require.False(t, keyExpired(tx, "test", "key", now.Add(time.Hour)))
+
+		require.NoError(t, putKeyMeta(tx, "test", "key", now, time.Minute, StorageQuota{}))
+		require.NoError(t, putKeyMeta(tx, "test", "key", now, 0, StorageQuota{}))
+		require.False(t, keyExpired(tx, "test", "key", now.Add(time.Hour)))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestMigrateStorageMeta(t *testing.T) {
+	db, err := bolt.Open(t.TempDir()+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	oldBucket := localObjectId("/etc/wb-rules/old.js", "cache")
+	newBucket := localObjectId("/etc/wb-rules/new.js", "cache")
+	now := time.Now()
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(oldBucket))
+		require.NoError(t, err)
+		require.NoError(t, b.Put([]byte("key"), []byte("1")))
+		require.NoError(t, putKeyMeta(tx, oldBucket, "key", now, time.Minute, StorageQuota{}))
+
+		_, err = migrateScriptStorages(tx, "/etc/wb-rules/old.js", "/etc/wb-rules/new.js")
+		require.NoError(t, err)
+		require.False(t, keyExpired(tx, oldBucket, "key", now.Add(time.Minute)))
+		require.True(t, keyExpired(tx, newBucket, "key", now.Add(time.Minute)))
+		return nil
+	})
+	require.NoError(t, err)
+}
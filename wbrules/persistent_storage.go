@@ -0,0 +1,581 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/wirenboard/wbgong"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// buckets of the persistent DB used by wb-rules itself
+	// are not exposed to Storage RPC
+	INTERNAL_BUCKET_PREFIX = "_wbrules_"
+	// maps local storage buckets to the paths of their scripts
+	STORAGE_OWNERS_BUCKET = INTERNAL_BUCKET_PREFIX + "storage_owners"
+)
+
+var (
+	errStorageDisabled = errors.New("persistent storage is disabled")
+	errBucketNotFound  = errors.New("persistent storage not found")
+	errKeyNotFound     = errors.New("persistent storage key not found")
+)
+
+// StorageBucketInfo describes a persistent storage bucket.
+// Local storages are created by PersistentStorage() without
+// { global: true }, their bucket names are prefixed by the hash
+// of the script path. Script is the path of such script (virtual
+// one for the scripts in the edit directory) if it's known
+type StorageBucketInfo struct {
+	Bucket string   `json:"bucket"`
+	Name   string   `json:"name"`
+	Script string   `json:"script,omitempty"`
+	Keys   []string `json:"keys"`
+	// OwnerUnknown is set by StorageGC for the local-looking
+	// storages without recorded owner and loaded script
+	OwnerUnknown bool `json:"ownerUnknown,omitempty"`
+}
+
+// StorageDump is the JSON dump of persistent storages.
+// Values are stored as they're written by the scripts
+type StorageDump struct {
+	Buckets map[string]*StorageDumpBucket `json:"buckets"`
+}
+
+type StorageDumpBucket struct {
+	// Script is informational and ignored by import
+	Script string                     `json:"script,omitempty"`
+	Values map[string]json.RawMessage `json:"values"`
+}
+
+func isInternalBucket(bucket string) bool {
+	return strings.HasPrefix(bucket, INTERNAL_BUCKET_PREFIX)
+}
+
+// storageOwners resolves the scripts of local storages
+type storageOwners struct {
+	// recorded maps buckets to the physical paths of their scripts
+	recorded map[string]string
+	// loaded maps local bucket name prefixes to the loaded scripts
+	loaded map[string]string
+
+	sourceRoot string
+}
+
+func (engine *ESEngine) storageOwners(tx *bolt.Tx) *storageOwners {
+	owners := &storageOwners{
+		recorded:   make(map[string]string),
+		loaded:     make(map[string]string),
+		sourceRoot: engine.sourceRoot,
+	}
+	if b := tx.Bucket([]byte(STORAGE_OWNERS_BUCKET)); b != nil {
+		b.ForEach(func(k, v []byte) error {
+			owners.recorded[string(k)] = string(v)
+			return nil
+		})
+	}
+
+	engine.sourcesMtx.Lock()
+	defer engine.sourcesMtx.Unlock()
+	for path := range engine.sources {
+		owners.loaded[localObjectId(path, "")] = path
+	}
+	return owners
+}
+
+// scriptPath returns the virtual path for the scripts
+// in the edit directory and the physical one otherwise
+func (owners *storageOwners) scriptPath(path string) string {
+	path = strings.TrimSuffix(path, FILE_DISABLED_SUFFIX)
+	if owners.sourceRoot != "" && wbgong.IsSubpath(owners.sourceRoot, path) {
+		if virtualPath, err := filepath.Rel(owners.sourceRoot, path); err == nil {
+			return virtualPath
+		}
+	}
+	return path
+}
+
+// owner returns the script path and the storage name of the bucket
+// if it's a local storage with the recorded owner or a local storage
+// of a loaded script
+func (owners *storageOwners) owner(bucket string) (script, name string) {
+	path, found := owners.recorded[bucket]
+	if !found {
+		for prefix, p := range owners.loaded {
+			if strings.HasPrefix(bucket, prefix) {
+				path, found = p, true
+				break
+			}
+		}
+	}
+	if !found {
+		return "", bucket
+	}
+	return owners.scriptPath(path), bucket[len(localObjectId(path, "")):]
+}
+
+func bucketValues(b *bolt.Bucket) map[string]json.RawMessage {
+	values := make(map[string]json.RawMessage)
+	b.ForEach(func(k, v []byte) error {
+		values[string(k)] = json.RawMessage(append([]byte(nil), v...))
+		return nil
+	})
+	return values
+}
+
+// StorageBuckets lists persistent storage buckets with their keys
+func (engine *ESEngine) StorageBuckets() ([]StorageBucketInfo, error) {
+	if engine.persistentDB == nil {
+		return nil, errStorageDisabled
+	}
+
+	buckets := make([]StorageBucketInfo, 0)
+	err := engine.persistentDB.View(func(tx *bolt.Tx) error {
+		owners := engine.storageOwners(tx)
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if isInternalBucket(string(name)) {
+				return nil
+			}
+			info := StorageBucketInfo{
+				Bucket: string(name),
+				Keys:   make([]string, 0),
+			}
+			info.Script, info.Name = owners.owner(info.Bucket)
+			b.ForEach(func(k, v []byte) error {
+				info.Keys = append(info.Keys, string(k))
+				return nil
+			})
+			buckets = append(buckets, info)
+			return nil
+		})
+	})
+	return buckets, err
+}
+
+// StorageGet returns the JSON encoded value of the key
+func (engine *ESEngine) StorageGet(bucket, key string) (value json.RawMessage, err error) {
+	if engine.persistentDB == nil {
+		return nil, errStorageDisabled
+	}
+	if isInternalBucket(bucket) {
+		return nil, errBucketNotFound
+	}
+
+	err = engine.persistentDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return errBucketNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return errKeyNotFound
+		}
+		value = json.RawMessage(append([]byte(nil), v...))
+		return nil
+	})
+	return
+}
+
+// StorageSet writes the JSON encoded value of the key
+func (engine *ESEngine) StorageSet(bucket, key string, value json.RawMessage) error {
+	if engine.persistentDB == nil {
+		return errStorageDisabled
+	}
+	if isInternalBucket(bucket) {
+		return errBucketNotFound
+	}
+
+	var changes []storageChange
+	err := engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		changes = engine.keyChange(b, bucket, key, value)
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+		// the value is written without TTL
+		return deleteKeyMeta(tx, bucket, key)
+	})
+	if err == nil {
+		engine.notifyStorageChanges(changes)
+	}
+	return err
+}
+
+// StorageDelete removes the key from the bucket
+// or the whole bucket if the key is empty
+func (engine *ESEngine) StorageDelete(bucket, key string) error {
+	if engine.persistentDB == nil {
+		return errStorageDisabled
+	}
+	if isInternalBucket(bucket) {
+		return errBucketNotFound
+	}
+
+	var changes []storageChange
+	err := engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return errBucketNotFound
+		}
+		if key == "" {
+			changes = bucketChanges(bucket, engine.bucketSnapshot(b, bucket), map[string][]byte{})
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+				return err
+			}
+			return deleteKeyMeta(tx, bucket, "")
+		}
+		if b.Get([]byte(key)) == nil {
+			return errKeyNotFound
+		}
+		changes = engine.keyChange(b, bucket, key, nil)
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return deleteKeyMeta(tx, bucket, key)
+	})
+	if err == nil {
+		engine.notifyStorageChanges(changes)
+	}
+	return err
+}
+
+// StorageExport dumps the specified buckets or all of them if none is specified
+func (engine *ESEngine) StorageExport(buckets []string) (*StorageDump, error) {
+	if engine.persistentDB == nil {
+		return nil, errStorageDisabled
+	}
+
+	dump := &StorageDump{Buckets: make(map[string]*StorageDumpBucket)}
+	err := engine.persistentDB.View(func(tx *bolt.Tx) error {
+		owners := engine.storageOwners(tx)
+		if len(buckets) == 0 {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				if !isInternalBucket(string(name)) {
+					script, _ := owners.owner(string(name))
+					dump.Buckets[string(name)] = &StorageDumpBucket{script, bucketValues(b)}
+				}
+				return nil
+			})
+		}
+		for _, name := range buckets {
+			b := tx.Bucket([]byte(name))
+			if b == nil || isInternalBucket(name) {
+				return errBucketNotFound
+			}
+			script, _ := owners.owner(name)
+			dump.Buckets[name] = &StorageDumpBucket{script, bucketValues(b)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dump, nil
+}
+
+// StorageImport writes the values from the dump in a single transaction,
+// null values are removed. If replace is set, the buckets are cleared
+// before writing
+func (engine *ESEngine) StorageImport(dump *StorageDump, replace bool) error {
+	if engine.persistentDB == nil {
+		return errStorageDisabled
+	}
+
+	names := make([]string, 0, len(dump.Buckets))
+	for name := range dump.Buckets {
+		if isInternalBucket(name) {
+			return errBucketNotFound
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []storageChange
+	err := engine.persistentDB.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			before := engine.bucketSnapshot(tx.Bucket([]byte(name)), name)
+			if replace {
+				if err := tx.DeleteBucket([]byte(name)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+				if err := deleteKeyMeta(tx, name, ""); err != nil {
+					return err
+				}
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(name))
+			if err != nil {
+				return err
+			}
+			var values map[string]json.RawMessage
+			if dump.Buckets[name] != nil {
+				values = dump.Buckets[name].Values
+			}
+			for key, value := range values {
+				// null values are removed like in scripts
+				if string(value) == "null" {
+					err = b.Delete([]byte(key))
+				} else {
+					err = b.Put([]byte(key), value)
+				}
+				if err != nil {
+					return err
+				}
+				// imported values don't expire
+				if err := deleteKeyMeta(tx, name, key); err != nil {
+					return err
+				}
+			}
+			changes = append(changes, bucketChanges(name, before, engine.bucketSnapshot(b, name))...)
+		}
+		return nil
+	})
+	if err == nil {
+		engine.notifyStorageChanges(changes)
+	}
+	return err
+}
+
+// setStorageOwner records the script of the local storage
+func (engine *ESEngine) setStorageOwner(bucket, path string) error {
+	var recorded string
+	engine.persistentView(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(STORAGE_OWNERS_BUCKET)); b != nil {
+			recorded = string(b.Get([]byte(bucket)))
+		}
+		return nil
+	})
+	if recorded == path {
+		return nil
+	}
+	return engine.persistentUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(STORAGE_OWNERS_BUCKET))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(bucket), []byte(path))
+	})
+}
+
+// looksLikeLocalBucket checks whether the bucket name starts
+// with the prefix of local storages, i.e. '_' and the filename hash
+func looksLikeLocalBucket(bucket string) bool {
+	prefixLen := len(localObjectId("", ""))
+	if len(bucket) < prefixLen || bucket[0] != '_' || isInternalBucket(bucket) {
+		return false
+	}
+	for _, c := range bucket[1:prefixLen] {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func scriptExists(path string) bool {
+	for _, p := range []string{path, path + FILE_DISABLED_SUFFIX} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// StorageGC finds local storages whose scripts don't exist anymore,
+// disabled scripts are considered existing. If remove is set,
+// such storages are removed. Local-looking storages that have
+// no recorded owner and don't belong to any loaded script, e.g.
+// created by older versions, are reported with OwnerUnknown set
+// and are never removed, as they may be global ones as well
+func (engine *ESEngine) StorageGC(remove bool) ([]StorageBucketInfo, error) {
+	if engine.persistentDB == nil {
+		return nil, errStorageDisabled
+	}
+
+	orphans := make([]StorageBucketInfo, 0)
+	// owner records of removed buckets
+	stale := make([]string, 0)
+	update := engine.persistentDB.View
+	if remove {
+		update = engine.persistentDB.Update
+	}
+	err := update(func(tx *bolt.Tx) error {
+		owners := engine.storageOwners(tx)
+		buckets := make([]string, 0, len(owners.recorded))
+		for bucket := range owners.recorded {
+			buckets = append(buckets, bucket)
+		}
+		sort.Strings(buckets)
+
+		for _, bucket := range buckets {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				stale = append(stale, bucket)
+				continue
+			}
+			if scriptExists(owners.recorded[bucket]) {
+				continue
+			}
+			info := StorageBucketInfo{
+				Bucket: bucket,
+				Keys:   make([]string, 0),
+			}
+			info.Script, info.Name = owners.owner(bucket)
+			b.ForEach(func(k, v []byte) error {
+				info.Keys = append(info.Keys, string(k))
+				return nil
+			})
+			orphans = append(orphans, info)
+			stale = append(stale, bucket)
+		}
+
+		tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			bucket := string(name)
+			if _, found := owners.recorded[bucket]; found || !looksLikeLocalBucket(bucket) {
+				return nil
+			}
+			if script, _ := owners.owner(bucket); script != "" {
+				return nil
+			}
+			info := StorageBucketInfo{
+				Bucket:       bucket,
+				Name:         bucket,
+				Keys:         make([]string, 0),
+				OwnerUnknown: true,
+			}
+			b.ForEach(func(k, v []byte) error {
+				info.Keys = append(info.Keys, string(k))
+				return nil
+			})
+			orphans = append(orphans, info)
+			return nil
+		})
+		if !remove {
+			return nil
+		}
+
+		for _, info := range orphans {
+			if info.OwnerUnknown {
+				continue
+			}
+			if err := tx.DeleteBucket([]byte(info.Bucket)); err != nil {
+				return err
+			}
+			if err := deleteKeyMeta(tx, info.Bucket, ""); err != nil {
+				return err
+			}
+		}
+		if b := tx.Bucket([]byte(STORAGE_OWNERS_BUCKET)); b != nil {
+			for _, bucket := range stale {
+				if err := b.Delete([]byte(bucket)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if remove {
+		for _, info := range orphans {
+			if !info.OwnerUnknown {
+				wbgong.Info.Printf("removed persistent storage %s of deleted script %s", info.Bucket, info.Script)
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// migrateScriptStorages moves local storages of the script
+// to the buckets named after its new path
+func migrateScriptStorages(tx *bolt.Tx, oldPath, newPath string) (moved []string, err error) {
+	oldPrefix := localObjectId(oldPath, "")
+	buckets := make([]string, 0)
+	tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if strings.HasPrefix(string(name), oldPrefix) {
+			buckets = append(buckets, string(name))
+		}
+		return nil
+	})
+
+	owners, err := tx.CreateBucketIfNotExists([]byte(STORAGE_OWNERS_BUCKET))
+	if err != nil {
+		return nil, err
+	}
+	for _, bucket := range buckets {
+		newBucket := localObjectId(newPath, bucket[len(oldPrefix):])
+		if tx.Bucket([]byte(newBucket)) != nil {
+			return nil, fmt.Errorf("persistent storage %s already exists", newBucket)
+		}
+		dst, err := tx.CreateBucket([]byte(newBucket))
+		if err != nil {
+			return nil, err
+		}
+		err = tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			return dst.Put(k, v)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.DeleteBucket([]byte(bucket)); err != nil {
+			return nil, err
+		}
+		if err := migrateStorageMeta(tx, bucket, newBucket); err != nil {
+			return nil, err
+		}
+		if err := owners.Delete([]byte(bucket)); err != nil {
+			return nil, err
+		}
+		if err := owners.Put([]byte(newBucket), []byte(newPath)); err != nil {
+			return nil, err
+		}
+		moved = append(moved, bucket)
+	}
+	return moved, nil
+}
+
+// MigrateScriptStorages moves local storages of the script to
+// the new script path, so the script keeps its storages after
+// renaming. The paths are physical ones without the disabled suffix.
+// The script is unloaded before moving, so it can't recreate its
+// storages under the old path until the file is renamed, and it's
+// loaded back if moving fails. If the script file already exists
+// under the new path (e.g. when moving the storages back after
+// failed renaming), it's reloaded after moving
+func (engine *ESEngine) MigrateScriptStorages(oldPath, newPath string) error {
+	if engine.persistentDB == nil {
+		return nil
+	}
+
+	r := make(chan error)
+	engine.WhenEngineReady(func() {
+		unloaded := engine.unloadScript(oldPath)
+		var moved []string
+		err := engine.persistentDB.Update(func(tx *bolt.Tx) (err error) {
+			moved, err = migrateScriptStorages(tx, oldPath, newPath)
+			return
+		})
+		if err != nil {
+			if unloaded {
+				engine.reloadScript(oldPath)
+			}
+			r <- err
+			return
+		}
+		if len(moved) > 0 {
+			wbgong.Info.Printf("moved %d persistent storage(s) of %s to %s", len(moved), oldPath, newPath)
+		}
+		engine.reloadScript(newPath)
+		r <- nil
+	})
+	return <-r
+}
@@ -1,11 +1,14 @@
 package wbrules
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/wirenboard/wbgong"
 	"github.com/wirenboard/wbgong/testutils"
+	bolt "go.etcd.io/bbolt"
 )
 
 type PersistentStorageSuite struct {
@@ -92,9 +95,275 @@ func (s *PersistentStorageSuite) TestLocalPersistentStorage2() {
 	s.SkipTill("[info] file2: read objects undefined, \"hello_from_2\"")
 }
 
+// the script is unloaded before its storages are moved,
+// so it can't recreate them until the file is renamed
+func (s *PersistentStorageSuite) TestMigrateScriptStorages() {
+	s.publish("/devices/vdev/controls/localWrite1/on", "1", "vdev/localWrite1")
+	s.SkipTill("[info] file1: write to local PS")
+
+	oldPath, newPath := s.tmpDir+"/testrules_persistent.js", s.tmpDir+"/testrules_persistent_renamed.js"
+	s.Require().NoError(s.engine.MigrateScriptStorages(oldPath, newPath))
+	loaded := make(chan bool)
+	s.engine.CallSync(func() {
+		_, ok := s.engine.localCtxs[oldPath]
+		loaded <- ok
+	})
+	s.False(<-loaded)
+
+	s.Require().NoError(os.Rename(oldPath, newPath))
+	s.Require().NoError(s.engine.LiveLoadFile(newPath))
+	s.SkipTill("[info] loaded file 1")
+	s.publish("/devices/vdev/controls/localRead1/on", "1", "vdev/localRead1")
+	s.SkipTill("[info] file1: read objects \"hello_from_1\", undefined")
+}
+
 func TestPersistentStorageSuite(t *testing.T) {
 	s := new(PersistentStorageSuite)
 	s.SetupFixture()
 	defer s.TearDownFixture()
 	testutils.RunSuites(t, s)
 }
+
+type PersistentTransactionSuite struct {
+	RuleSuiteBase
+}
+
+func (s *PersistentTransactionSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_persistent_tx.js")
+}
+
+func (s *PersistentTransactionSuite) TestCommit() {
+	s.engine.EvalScript("testCommit()")
+	s.Verify(
+		"[info] inside: a = 1, has b: true",
+		"[info] result: done",
+		"[info] keys: [\"a\",\"b\"], has a: true, has c: false",
+	)
+}
+
+func (s *PersistentTransactionSuite) TestRollback() {
+	s.engine.EvalScript("testRollback()")
+	s.Verify(
+		"[info] caught: oops",
+		"[info] a = 1",
+		"[info] keys: [\"a\"], has a: true, has c: false",
+	)
+}
+
+func (s *PersistentTransactionSuite) TestNestedTransactions() {
+	s.engine.EvalScript("testNested()")
+	s.Verify(
+		"[info] caught: outer failed",
+		"[info] keys: [], has a: false, has c: false",
+	)
+}
+
+func (s *PersistentTransactionSuite) TestClear() {
+	s.engine.EvalScript("testClear()")
+	s.Verify(
+		"[info] keys: [], has a: false, has c: false",
+	)
+}
+
+func (s *PersistentTransactionSuite) TestWriteError() {
+	s.engine.EvalScript("testWriteError()")
+	s.Verify(
+		"[info] caught: can't write to persistent storage test_tx: '': key required",
+		"[info] caught: can't write reserved PersistentStorage key '_psapi'",
+		"[info] keys = 1, has keys: true",
+		"[info] caught: PersistentStorage expected",
+	)
+}
+
+func TestPersistentTransactionSuite(t *testing.T) {
+	testutils.RunSuites(t, new(PersistentTransactionSuite))
+}
+
+func TestStorageBucketOwners(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := bolt.Open(tmpDir+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+
+	engine := &ESEngine{
+		persistentDB: db,
+		sourceRoot:   "/etc/wb-rules",
+		sources: map[string]*LocFileEntry{
+			"/etc/wb-rules/heating.js":           {VirtualPath: "heating.js"},
+			"/usr/share/wb-rules/system.js":      {},
+			"/etc/wb-rules/disabled.js.disabled": {VirtualPath: "disabled.js"},
+		},
+	}
+	heating := localObjectId("/etc/wb-rules/heating.js", "state")
+	system := localObjectId("/usr/share/wb-rules/system.js", "state")
+	orphan := localObjectId("/etc/wb-rules/removed.js", "state")
+	for _, bucket := range []string{heating, system, orphan, "counters"} {
+		require.NoError(t, engine.StorageSet(bucket, "key", json.RawMessage(`1`)))
+	}
+	require.ErrorIs(t, engine.StorageSet(RULE_STATES_BUCKET, "key", json.RawMessage(`1`)), errBucketNotFound)
+	require.NoError(t, engine.StoreRuleState("heater", true))
+
+	buckets, err := engine.StorageBuckets()
+	require.NoError(t, err)
+	scripts := make(map[string]string)
+	names := make(map[string]string)
+	for _, b := range buckets {
+		scripts[b.Bucket] = b.Script
+		names[b.Bucket] = b.Name
+		require.Equal(t, []string{"key"}, b.Keys)
+	}
+	require.Equal(t, map[string]string{
+		heating:    "heating.js",
+		system:     "/usr/share/wb-rules/system.js",
+		orphan:     "",
+		"counters": "",
+	}, scripts)
+	require.Equal(t, "state", names[heating])
+	require.Equal(t, orphan, names[orphan])
+
+	dump, err := engine.StorageExport(nil)
+	require.NoError(t, err)
+	require.Len(t, dump.Buckets, 4)
+	require.Equal(t, "heating.js", dump.Buckets[heating].Script)
+}
+
+func TestStorageImport(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := bolt.Open(tmpDir+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	engine := &ESEngine{persistentDB: db}
+	parseDump := func(s string) *StorageDump {
+		var dump StorageDump
+		require.NoError(t, json.Unmarshal([]byte(s), &dump))
+		return &dump
+	}
+
+	require.NoError(t, engine.StorageImport(parseDump(`{"buckets": {
+		"counters": {"values": {"total": 42, "last": {"room": "hall"}}},
+		"modes": {"values": {"hall": "eco"}}
+	}}`), false))
+	require.NoError(t, engine.StorageImport(parseDump(`{"buckets": {
+		"counters": {"values": {"total": 43, "last": null}}
+	}}`), false))
+	value, err := engine.StorageGet("counters", "total")
+	require.NoError(t, err)
+	require.JSONEq(t, `43`, string(value))
+	_, err = engine.StorageGet("counters", "last")
+	require.ErrorIs(t, err, errKeyNotFound)
+
+	require.NoError(t, engine.StorageImport(parseDump(`{"buckets": {
+		"modes": {"values": {"kitchen": "comfort"}}
+	}}`), true))
+	exported, err := engine.StorageExport([]string{"modes"})
+	require.NoError(t, err)
+	out, err := json.Marshal(exported)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"buckets": {"modes": {"values": {"kitchen": "comfort"}}}}`, string(out))
+
+	require.ErrorIs(t, engine.StorageImport(&StorageDump{
+		Buckets: map[string]*StorageDumpBucket{RULE_STATES_BUCKET: {}},
+	}, false), errBucketNotFound)
+	require.ErrorIs(t, engine.StorageDelete("nosuchstorage", ""), errBucketNotFound)
+}
+
+func TestStorageGC(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := bolt.Open(tmpDir+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	engine := &ESEngine{persistentDB: db, sourceRoot: tmpDir}
+
+	scripts := map[string]string{
+		"heating.js":  tmpDir + "/heating.js",
+		"lights.js":   tmpDir + "/lights.js",
+		"disabled.js": tmpDir + "/disabled.js",
+	}
+	require.NoError(t, os.WriteFile(scripts["heating.js"], []byte("// heating"), 0644))
+	require.NoError(t, os.WriteFile(scripts["disabled.js"]+FILE_DISABLED_SUFFIX, []byte("// disabled"), 0644))
+	for _, path := range scripts {
+		bucket := localObjectId(path, "state")
+		require.NoError(t, engine.setStorageOwner(bucket, path))
+		require.NoError(t, engine.StorageSet(bucket, "mode", json.RawMessage(`"eco"`)))
+	}
+	// owner of the storage that has never been written
+	require.NoError(t, engine.setStorageOwner(localObjectId(tmpDir+"/empty.js", "state"), tmpDir+"/empty.js"))
+	// local storage created before owners were recorded
+	unknown := localObjectId(tmpDir+"/old.js", "state")
+	require.NoError(t, engine.StorageSet(unknown, "mode", json.RawMessage(`"off"`)))
+	// global storages
+	require.NoError(t, engine.StorageSet("counters", "total", json.RawMessage(`1`)))
+	require.NoError(t, engine.StorageSet("_x", "total", json.RawMessage(`1`)))
+
+	lights := localObjectId(scripts["lights.js"], "state")
+	unknownInfo := StorageBucketInfo{Bucket: unknown, Name: unknown, Keys: []string{"mode"}, OwnerUnknown: true}
+	expected := []StorageBucketInfo{
+		{Bucket: lights, Name: "state", Script: "lights.js", Keys: []string{"mode"}},
+		unknownInfo,
+	}
+	orphans, err := engine.StorageGC(false)
+	require.NoError(t, err)
+	require.Equal(t, expected, orphans)
+
+	orphans, err = engine.StorageGC(true)
+	require.NoError(t, err)
+	require.Equal(t, expected, orphans)
+	_, err = engine.StorageGet(lights, "mode")
+	require.ErrorIs(t, err, errBucketNotFound)
+	_, err = engine.StorageGet(unknown, "mode")
+	require.NoError(t, err)
+
+	orphans, err = engine.StorageGC(false)
+	require.NoError(t, err)
+	require.Equal(t, []StorageBucketInfo{unknownInfo}, orphans)
+	db.View(func(tx *bolt.Tx) error {
+		require.Equal(t, 2, tx.Bucket([]byte(STORAGE_OWNERS_BUCKET)).Stats().KeyN)
+		return nil
+	})
+}
+
+func TestMigrateScriptStorages(t *testing.T) {
+	tmpDir := t.TempDir()
+	db, err := bolt.Open(tmpDir+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	engine := &ESEngine{persistentDB: db, sourceRoot: tmpDir}
+
+	oldPath, newPath := tmpDir+"/heating.js", tmpDir+"/rooms/heating.js"
+	require.NoError(t, engine.setStorageOwner(localObjectId(oldPath, "state"), oldPath))
+	require.NoError(t, engine.StorageSet(localObjectId(oldPath, "state"), "mode", json.RawMessage(`"eco"`)))
+	// storage created before owners were recorded
+	require.NoError(t, engine.StorageSet(localObjectId(oldPath, "stats"), "runs", json.RawMessage(`3`)))
+	require.NoError(t, engine.StorageSet(localObjectId(tmpDir+"/lights.js", "state"), "on", json.RawMessage(`true`)))
+
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		moved, err := migrateScriptStorages(tx, oldPath, newPath)
+		require.Len(t, moved, 2)
+		return err
+	}))
+
+	buckets, err := engine.StorageBuckets()
+	require.NoError(t, err)
+	scripts := make(map[string]string)
+	for _, b := range buckets {
+		scripts[b.Name] = b.Script
+	}
+	require.Equal(t, map[string]string{
+		"state": "rooms/heating.js",
+		"stats": "rooms/heating.js",
+		localObjectId(tmpDir+"/lights.js", "state"): "",
+	}, scripts)
+	value, err := engine.StorageGet(localObjectId(newPath, "stats"), "runs")
+	require.NoError(t, err)
+	require.JSONEq(t, `3`, string(value))
+
+	// existing storages are not overwritten
+	require.NoError(t, engine.StorageSet(localObjectId(oldPath, "state"), "mode", json.RawMessage(`"comfort"`)))
+	require.Error(t, db.Update(func(tx *bolt.Tx) error {
+		_, err := migrateScriptStorages(tx, oldPath, newPath)
+		return err
+	}))
+	value, err = engine.StorageGet(localObjectId(newPath, "state"), "mode")
+	require.NoError(t, err)
+	require.JSONEq(t, `"eco"`, string(value))
+}
@@ -0,0 +1,223 @@
+package wbrules
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/stretchr/objx"
+	duktape "github.com/wirenboard/go-duktape"
+	bolt "go.etcd.io/bbolt"
+)
+
+// storageWatcher is a callback registered by PersistentStorage.onChange()
+type storageWatcher struct {
+	key      string
+	callback ESCallbackFunc
+	// removed is set by the cleanup of the script,
+	// accessed from the sync loop only
+	removed bool
+}
+
+// storageChange is a change of the persistent storage key.
+// Nil value means that the key is removed
+type storageChange struct {
+	bucket   string
+	key      string
+	value    []byte
+	oldValue []byte
+}
+
+func (change *storageChange) args() objx.Map {
+	args := objx.Map{"key": change.key}
+	if change.value != nil {
+		args["value"] = string(change.value)
+	}
+	if change.oldValue != nil {
+		args["oldValue"] = string(change.oldValue)
+	}
+	return args
+}
+
+func (engine *ESEngine) storageWatched(bucket string) bool {
+	engine.storageWatchersMtx.Lock()
+	defer engine.storageWatchersMtx.Unlock()
+	return len(engine.storageWatchers[bucket]) > 0
+}
+
+// addStorageWatcher registers the callback for changes of the key.
+// The watcher is removed by the cleanups of the current scope
+func (engine *ESEngine) addStorageWatcher(bucket, key string, callback ESCallbackFunc) {
+	w := &storageWatcher{key: key, callback: callback}
+
+	engine.storageWatchersMtx.Lock()
+	engine.storageWatchers[bucket] = append(engine.storageWatchers[bucket], w)
+	engine.storageWatchersMtx.Unlock()
+
+	engine.cleanup.AddCleanup(func() {
+		w.removed = true
+
+		engine.storageWatchersMtx.Lock()
+		defer engine.storageWatchersMtx.Unlock()
+		watchers := engine.storageWatchers[bucket]
+		for i, other := range watchers {
+			if other == w {
+				watchers = append(watchers[:i:i], watchers[i+1:]...)
+				break
+			}
+		}
+		if len(watchers) == 0 {
+			delete(engine.storageWatchers, bucket)
+		} else {
+			engine.storageWatchers[bucket] = watchers
+		}
+	})
+}
+
+// keyChange returns the change of the key if the bucket is watched
+// and the value differs from the stored one. The bucket may be nil
+func (engine *ESEngine) keyChange(b *bolt.Bucket, bucket, key string, value []byte) []storageChange {
+	if !engine.storageWatched(bucket) {
+		return nil
+	}
+	var oldValue []byte
+	if b != nil {
+		if v := b.Get([]byte(key)); v != nil {
+			oldValue = append([]byte(nil), v...)
+		}
+	}
+	if oldValue == nil && value == nil || oldValue != nil && value != nil && bytes.Equal(oldValue, value) {
+		return nil
+	}
+	return []storageChange{{bucket, key, value, oldValue}}
+}
+
+// bucketSnapshot returns the values of the bucket if it's watched.
+// The bucket may be nil
+func (engine *ESEngine) bucketSnapshot(b *bolt.Bucket, bucket string) map[string][]byte {
+	if !engine.storageWatched(bucket) {
+		return nil
+	}
+	values := make(map[string][]byte)
+	if b != nil {
+		b.ForEach(func(k, v []byte) error {
+			values[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	}
+	return values
+}
+
+// bucketChanges compares the snapshots of the bucket
+func bucketChanges(bucket string, before, after map[string][]byte) []storageChange {
+	if before == nil || after == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(before)+len(after))
+	for key := range before {
+		keys = append(keys, key)
+	}
+	for key := range after {
+		if _, found := before[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]storageChange, 0)
+	for _, key := range keys {
+		oldValue, value := before[key], after[key]
+		if oldValue != nil && value != nil && bytes.Equal(oldValue, value) {
+			continue
+		}
+		changes = append(changes, storageChange{bucket, key, value, oldValue})
+	}
+	return changes
+}
+
+// commitStorageChanges notifies the watchers about the changes made by
+// a script. The changes made within PersistentStorage.transaction()
+// are delayed until the transaction is committed
+func (engine *ESEngine) commitStorageChanges(changes []storageChange) {
+	if engine.persistentTx != nil {
+		engine.persistentTxChanges = append(engine.persistentTxChanges, changes...)
+		return
+	}
+	engine.notifyStorageChanges(changes)
+}
+
+// notifyStorageChanges queues the callbacks of the watchers. The callbacks
+// are invoked in the sync loop in the order of the changes
+func (engine *ESEngine) notifyStorageChanges(changes []storageChange) {
+	for i := range changes {
+		change := &changes[i]
+
+		engine.storageWatchersMtx.Lock()
+		watchers := make([]*storageWatcher, 0)
+		for _, w := range engine.storageWatchers[change.bucket] {
+			if w.key == change.key {
+				watchers = append(watchers, w)
+			}
+		}
+		engine.storageWatchersMtx.Unlock()
+
+		for _, w := range watchers {
+			w, args := w, change.args()
+			engine.queueStorageNotification(func() {
+				// the script may be reloaded after the change
+				if !w.removed {
+					w.callback(args)
+				}
+			})
+		}
+	}
+}
+
+func (engine *ESEngine) queueStorageNotification(thunk func()) {
+	engine.storageNotifyMtx.Lock()
+	defer engine.storageNotifyMtx.Unlock()
+
+	engine.storageNotifyQueue = append(engine.storageNotifyQueue, thunk)
+	if !engine.storageNotifying {
+		engine.storageNotifying = true
+		// changes are usually made from the sync loop,
+		// so the callbacks can't be called synchronously
+		go engine.deliverStorageNotifications()
+	}
+}
+
+func (engine *ESEngine) deliverStorageNotifications() {
+	for {
+		engine.storageNotifyMtx.Lock()
+		if len(engine.storageNotifyQueue) == 0 {
+			engine.storageNotifying = false
+			engine.storageNotifyMtx.Unlock()
+			return
+		}
+		thunk := engine.storageNotifyQueue[0]
+		engine.storageNotifyQueue = engine.storageNotifyQueue[1:]
+		engine.storageNotifyMtx.Unlock()
+
+		engine.CallSync(thunk)
+	}
+}
+
+// Registers the callback for changes of persistent storage key.
+// Used in 'PersistentStorage.onChange(key, callback)'
+func (engine *ESEngine) esPersistentOnChange(ctx *ESContext) int {
+	// arguments: (bucket string, key string, callback function)
+	if ctx.GetTop() != 3 || !ctx.IsString(0) || !ctx.IsString(1) || !ctx.IsFunction(2) {
+		engine.Log(ENGINE_LOG_ERROR, "bad persistent storage onChange() call")
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+	bucket, key := ctx.GetString(0), ctx.GetString(1)
+
+	currentFilename := ctx.GetCurrentFilename()
+	if currentFilename != "" {
+		engine.cleanup.PushCleanupScope(currentFilename)
+		defer engine.cleanup.PopCleanupScope(currentFilename)
+	}
+
+	engine.addStorageWatcher(bucket, key, ctx.WrapCallback(2))
+
+	return 0
+}
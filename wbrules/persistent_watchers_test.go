@@ -0,0 +1,89 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type PersistentWatchSuite struct {
+	RuleSuiteBase
+}
+
+func (s *PersistentWatchSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_persistent_watch.js")
+}
+
+func (s *PersistentWatchSuite) write(code string) {
+	s.Ck("EvalScript()", s.engine.EvalScript(
+		"(function (ps) {"+code+"})(new PersistentStorage('shared', { global: true }))"))
+}
+
+func (s *PersistentWatchSuite) TestOnChange() {
+	s.write("ps.mode = 'eco'")
+	s.Verify(`[info] watcher 1: mode changed from undefined to "eco"`)
+
+	// same value and other keys don't trigger the callback
+	s.write("ps.mode = 'eco'; ps.other = 1")
+	s.write("ps.mode = StorableObject({ target: 21 })")
+	s.Verify(`[info] watcher 1: mode changed from "eco" to {"target":21}`)
+
+	s.write("ps.mode = null")
+	s.Verify(`[info] watcher 1: mode changed from {"target":21} to undefined`)
+
+	s.write("ps.mode = 'comfort'; ps.clear()")
+	s.Verify(
+		`[info] watcher 1: mode changed from undefined to "comfort"`,
+		`[info] watcher 1: mode changed from "comfort" to undefined`,
+	)
+}
+
+func (s *PersistentWatchSuite) TestOnChangeTransaction() {
+	s.write(`
+		try {
+			ps.transaction(function (s) {
+				s.mode = 'eco';
+				throw new Error('oops');
+			});
+		} catch (e) {
+			log('rolled back');
+		}
+		ps.transaction(function (s) {
+			s.mode = 'eco';
+			s.mode = 'comfort';
+		});
+		log('committed');
+	`)
+	s.Verify(
+		"[info] rolled back",
+		"[info] committed",
+		`[info] watcher 1: mode changed from undefined to "eco"`,
+		`[info] watcher 1: mode changed from "eco" to "comfort"`,
+	)
+}
+
+func (s *PersistentWatchSuite) TestOnChangeReload() {
+	s.ReplaceScript("testrules_persistent_watch.js", "testrules_persistent_watch_2.js")
+	s.SkipTill("[changed] testrules_persistent_watch.js")
+
+	s.write("ps.mode = 'eco'")
+	s.Verify(`[info] watcher 2: mode changed from undefined to "eco"`)
+}
+
+func TestPersistentWatchSuite(t *testing.T) {
+	testutils.RunSuites(t, new(PersistentWatchSuite))
+}
+
+func TestBucketChanges(t *testing.T) {
+	before := map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}
+	after := map[string][]byte{"b": []byte("2"), "c": []byte("4"), "d": []byte("5")}
+	require.Equal(t, []storageChange{
+		{"s", "a", nil, []byte("1")},
+		{"s", "c", []byte("4"), []byte("3")},
+		{"s", "d", []byte("5"), nil},
+	}, bucketChanges("s", before, after))
+
+	// the bucket is not watched
+	require.Nil(t, bucketChanges("s", nil, after))
+}
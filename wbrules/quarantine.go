@@ -0,0 +1,118 @@
+package wbrules
+
+import (
+	"fmt"
+
+	"github.com/wirenboard/wbgong"
+)
+
+// noteScriptError counts the runtime error of the script and quarantines
+// the script if there are too many errors within the quarantine window.
+// It's called by the callback error handler of the script context
+func (engine *ESEngine) noteScriptError(path string, err ESError) {
+	if engine.quarantineErrors <= 0 {
+		return
+	}
+	now := engine.clock.Now()
+
+	engine.sourcesMtx.Lock()
+	entry := engine.sources[path]
+	if entry == nil || entry.Quarantine != nil {
+		engine.sourcesMtx.Unlock()
+		return
+	}
+	recent := entry.errorTimes[:0]
+	for _, t := range entry.errorTimes {
+		if now.Sub(t) < engine.quarantineWindow {
+			recent = append(recent, t)
+		}
+	}
+	entry.errorTimes = append(recent, now)
+	exceeded := len(entry.errorTimes) >= engine.quarantineErrors
+	if exceeded {
+		entry.errorTimes = nil
+	}
+	engine.sourcesMtx.Unlock()
+
+	if !exceeded {
+		return
+	}
+	reason := fmt.Sprintf("%d runtime errors within %s, last error: %s",
+		engine.quarantineErrors, engine.quarantineWindow, err.Message)
+	// the context of the script can't be removed
+	// while its callback is being invoked
+	go engine.CallSync(func() {
+		engine.quarantineScript(path, entry, reason)
+	})
+}
+
+// quarantineScript unloads the script keeping its entry in the
+// sources list marked as quarantined. The script is loaded again
+// when it's changed or by UnquarantineScript()
+func (engine *ESEngine) quarantineScript(path string, entry *LocFileEntry, reason string) {
+	engine.sourcesMtx.Lock()
+	current := engine.sources[path]
+	engine.sourcesMtx.Unlock()
+	if current != entry || entry.Quarantine != nil {
+		// reloaded or removed already
+		return
+	}
+
+	_, _, underSourceRoot, _, err := engine.checkSourcePath(path)
+	if err != nil {
+		wbgong.Error.Printf("checkSourcePath() failed for %s: %s", path, err)
+		return
+	}
+
+	engine.runCleanups(path)
+
+	engine.cleanup.PushCleanupScope(path)
+	defer engine.cleanup.PopCleanupScope(path)
+	engine.addSourceEntry(&LocFileEntry{
+		Enabled:      true,
+		Error:        entry.Error,
+		VirtualPath:  entry.VirtualPath,
+		PhysicalPath: path,
+		Devices:      make([]LocItem, 0),
+		Rules:        make([]LocItem, 0),
+		Timers:       make([]LocItem, 0),
+		Quarantine: &ScriptQuarantine{
+			Since:  engine.clock.Now(),
+			Reason: reason,
+		},
+	}, underSourceRoot)
+
+	engine.Refresh()
+	engine.maybePublishUpdate("changed", path)
+	engine.Logf(ENGINE_LOG_ERROR, "script %s is quarantined: %s", engine.scriptName(path), reason)
+}
+
+// UnquarantineScript implements LocFileManager
+func (engine *ESEngine) UnquarantineScript(virtualPath string) (bool, error) {
+	type result struct {
+		reloaded bool
+		err      error
+	}
+	r := make(chan result)
+	engine.WhenEngineReady(func() {
+		engine.sourcesMtx.Lock()
+		var entry *LocFileEntry
+		path, found := engine.editableSources[virtualPath]
+		if found {
+			entry = engine.sources[path]
+		}
+		engine.sourcesMtx.Unlock()
+
+		switch {
+		case entry == nil:
+			r <- result{false, fmt.Errorf("script not found: %s", virtualPath)}
+		case entry.Quarantine == nil:
+			r <- result{false, nil}
+		default:
+			engine.Logf(ENGINE_LOG_INFO, "script %s is released from quarantine", virtualPath)
+			r <- result{true, engine.loadScriptAndRefresh(path, true)}
+		}
+	})
+	res := <-r
+	return res.reloaded, res.err
+}
@@ -0,0 +1,189 @@
+package wbrules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// replay must not keep the engine busy for long, so the
+	// whole replay and every callback in it are limited in time
+	REPLAY_TIMEOUT          = time.Minute
+	REPLAY_CALLBACK_TIMEOUT = 5 * time.Second
+)
+
+var (
+	errJournalDisabled = errors.New("event journal is disabled")
+)
+
+// ReplayRequest describes the time window of recorded events
+// to be replayed and the scripts to replay them against
+type ReplayRequest struct {
+	From time.Time
+	To   time.Time
+	// Scripts are virtual paths of the scripts.
+	// All the enabled scripts are used if it's empty
+	Scripts []string
+	// IncludeLocal makes the changes of the engine's own devices
+	// be replayed as /on commands. By default only the changes
+	// of external devices are replayed, as the engine's devices
+	// are changed by the replayed rules themselves
+	IncludeLocal bool
+}
+
+type ReplayResult struct {
+	Events int      `json:"events"`
+	Output []string `json:"output"`
+}
+
+// EventReplayer replays control change events recorded in the event journal
+type EventReplayer interface {
+	ReplayEvents(req *ReplayRequest) (*ReplayResult, error)
+}
+
+// journalSimScript converts the journal entries to the simulation script
+// starting at from. The last values of the controls recorded before
+// from are published at the start of simulation
+func journalSimScript(entries []JournalEntry, from, to time.Time, includeLocal bool) *SimScript {
+	script := &SimScript{
+		Start:    from.Format(time.RFC3339Nano),
+		Duration: to.Sub(from).String(),
+	}
+	typed := make(map[string]bool)
+	add := func(entry JournalEntry, at time.Duration) {
+		control := entry.Device + "/" + entry.Control
+		ev := SimEvent{At: at.String(), Control: control, Value: entry.Value, On: entry.Local}
+		if !typed[control] && !entry.Local {
+			ev.Type = entry.Type
+			typed[control] = true
+		}
+		script.Events = append(script.Events, ev)
+	}
+
+	initial := make(map[string]JournalEntry)
+	var window []JournalEntry
+	for _, entry := range entries {
+		switch {
+		case strings.Contains(entry.Control, "#"):
+			// meta changes are replayed along with the values
+			continue
+		case entry.Local && !includeLocal:
+			continue
+		case entry.Time.Before(from):
+			if !entry.Local {
+				initial[entry.Device+"/"+entry.Control] = entry
+			}
+		case entry.Time.Before(to):
+			window = append(window, entry)
+		}
+	}
+
+	controls := make([]string, 0, len(initial))
+	for control := range initial {
+		controls = append(controls, control)
+	}
+	sort.Strings(controls)
+	for _, control := range controls {
+		add(initial[control], 0)
+	}
+	for _, entry := range window {
+		add(entry, entry.Time.Sub(from))
+	}
+	return script
+}
+
+// scriptPaths returns physical paths of the enabled scripts with the
+// given virtual paths or of all the enabled scripts if none is given
+func (engine *ESEngine) scriptPaths(virtualPaths []string) ([]string, error) {
+	engine.sourcesMtx.Lock()
+	defer engine.sourcesMtx.Unlock()
+
+	var paths []string
+	if len(virtualPaths) == 0 {
+		for path, entry := range engine.sources {
+			if entry.Enabled {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	for _, virtualPath := range virtualPaths {
+		found := false
+		for path, entry := range engine.sources {
+			if entry.VirtualPath == virtualPath || path == virtualPath {
+				paths = append(paths, path)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("script not found: %s", virtualPath)
+		}
+	}
+	return paths, nil
+}
+
+// ReplayEvents runs the scripts against the recorded events in
+// an isolated engine using virtual time. The isolated engine has
+// its own in-memory MQTT broker and temporary persistent storage,
+// external commands are only logged. Replay fails if it takes
+// longer than REPLAY_TIMEOUT
+func (engine *ESEngine) ReplayEvents(req *ReplayRequest) (*ReplayResult, error) {
+	journal := engine.eventBuffer.Journal()
+	if journal == nil {
+		return nil, errJournalDisabled
+	}
+	if !req.From.Before(req.To) {
+		return nil, fmt.Errorf("invalid time window: %s - %s", req.From, req.To)
+	}
+
+	scripts, err := engine.scriptPaths(req.Scripts)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := journal.Window(req.From, req.To)
+	if err != nil {
+		return nil, fmt.Errorf("can't read event journal: %w", err)
+	}
+	script := journalSimScript(entries, req.From, req.To, req.IncludeLocal)
+
+	tmpDir, err := os.MkdirTemp("", "wbrules-replay")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := NewESEngineOptions()
+	options.SetPersistentDBFile(filepath.Join(tmpDir, "persistent.db"))
+	options.SetModulesDirs(engine.modulesDirs)
+	options.SetLocation(engine.location)
+	options.SetCallbackWatchdog(REPLAY_CALLBACK_TIMEOUT, 0)
+
+	var out bytes.Buffer
+	sim, err := NewSimulator(&out, req.From, options)
+	if err != nil {
+		return nil, err
+	}
+	sim.SetDeadline(time.Now().Add(REPLAY_TIMEOUT))
+	err = sim.LoadScripts(scripts)
+	if err == nil {
+		err = sim.Run(script)
+	}
+	sim.Stop()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReplayResult{
+		Events: len(script.Events),
+		Output: strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"),
+	}, nil
+}
@@ -0,0 +1,94 @@
+package wbrules
+
+import (
+	"fmt"
+	"os"
+)
+
+// rotatingFile is an append-only file that is rotated when it
+// exceeds the size limit: path is renamed to path.1, path.1 to
+// path.2 and so on, keeping up to maxFiles files including the
+// current one. It's used by the event journal and file log sinks
+// and is not safe for concurrent use
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	st, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, st.Size()
+	return nil
+}
+
+// rotatedPath returns the path of the n-th file, 0 is the current one
+func (f *rotatingFile) rotatedPath(n int) string {
+	if n == 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	os.Remove(f.rotatedPath(f.maxFiles - 1))
+	for n := f.maxFiles - 2; n >= 0; n-- {
+		if err := os.Rename(f.rotatedPath(n), f.rotatedPath(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// Write appends data to the file rotating it first if data doesn't
+// fit. Data is never split between files. If the file can't be
+// reopened after rotation, it's retried on the next write
+func (f *rotatingFile) Write(data []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(data)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(data)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -2,6 +2,7 @@ package wbrules
 
 import (
 	"context"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/stretchr/objx"
@@ -10,6 +11,10 @@ import (
 
 const (
 	RULE_OR_COND_CAPACITY = 10
+
+	// timer names used in rule traces
+	RULE_COND_TIMER_DEBOUNCE = "debounce"
+	RULE_COND_TIMER_HOLD_FOR = "holdFor"
 )
 
 type CheckMode int8
@@ -27,8 +32,18 @@ type DepTracker interface {
 	SetUninitializedRule(rule *Rule)
 }
 
+// ruleTracer keeps track of the trace entry of the rule being
+// currently checked, so errors thrown by rule callbacks may be
+// attributed to it. activeSyncWait returns the time the handler
+// being currently executed spent in the sync queue, if it was queued
+type ruleTracer interface {
+	swapActiveTrace(entry *RuleTraceEntry) *RuleTraceEntry
+	activeSyncWait() (time.Duration, bool)
+}
+
 type Cron interface {
 	AddFunc(spec string, cmd func()) (cron.EntryID, error)
+	Schedule(schedule cron.Schedule, cmd cron.Job) cron.EntryID
 	Remove(id cron.EntryID)
 	Start()
 	Stop() context.Context
@@ -113,6 +128,147 @@ func (ruleCond *EdgeTriggeredRuleCondition) Check(e *ControlChangeEvent) (bool,
 	return shouldFire, nil
 }
 
+// CondTimers starts and stops one-shot timers
+// used by condition filters
+type CondTimers interface {
+	StartTimer(name string, callback func(), interval time.Duration, periodic bool) TimerId
+	StopTimerByIndex(n TimerId)
+}
+
+// CondFilterOptions specifies filters applied to the value of
+// 'when' or 'asSoonAs' condition function
+type CondFilterOptions struct {
+	// Hysteresis keeps the condition active after it became true
+	// until this function returns false
+	Hysteresis func() bool
+	// Debounce is the time the condition value must stay unchanged
+	// to be accepted
+	Debounce time.Duration
+	// HoldFor is the time the condition must stay true
+	// before it's considered true
+	HoldFor time.Duration
+}
+
+func (opts CondFilterOptions) IsEmpty() bool {
+	return opts.Hysteresis == nil && opts.Debounce == 0 && opts.HoldFor == 0
+}
+
+// condFilterTimer is a one-shot timer of a condition filter
+type condFilterTimer struct {
+	id      TimerId
+	expired bool
+}
+
+// CondFilter applies hysteresis, debounce and holdFor filters
+// (in this order) to the condition value. Filters that need
+// to wait use one-shot engine timers, the rule is rechecked when
+// such timer expires.
+type CondFilter struct {
+	opts    CondFilterOptions
+	cond    func() bool
+	timers  CondTimers
+	recheck func(timerName string)
+
+	latched     bool
+	debounced   bool
+	debounceTmr condFilterTimer
+	holdTmr     condFilterTimer
+}
+
+func NewCondFilter(cond func() bool, opts CondFilterOptions, timers CondTimers) *CondFilter {
+	return &CondFilter{
+		opts:   opts,
+		cond:   cond,
+		timers: timers,
+	}
+}
+
+// Value returns filtered condition value
+func (f *CondFilter) Value() bool {
+	v := f.cond()
+	if f.opts.Hysteresis != nil {
+		if f.latched && !v {
+			v = f.opts.Hysteresis()
+		}
+		f.latched = v
+	}
+	if f.opts.Debounce > 0 {
+		v = f.debounce(v)
+	}
+	if f.opts.HoldFor > 0 {
+		v = f.holdFor(v)
+	}
+	return v
+}
+
+func (f *CondFilter) debounce(v bool) bool {
+	if v == f.debounced {
+		f.stopTimer(&f.debounceTmr)
+		return v
+	}
+	if f.debounceTmr.expired {
+		f.debounceTmr.expired = false
+		f.debounced = v
+		return v
+	}
+	f.startTimer(&f.debounceTmr, f.opts.Debounce, RULE_COND_TIMER_DEBOUNCE)
+	return f.debounced
+}
+
+func (f *CondFilter) holdFor(v bool) bool {
+	if !v {
+		f.stopTimer(&f.holdTmr)
+		f.holdTmr.expired = false
+		return false
+	}
+	if f.holdTmr.expired {
+		return true
+	}
+	f.startTimer(&f.holdTmr, f.opts.HoldFor, RULE_COND_TIMER_HOLD_FOR)
+	return false
+}
+
+func (f *CondFilter) startTimer(tmr *condFilterTimer, d time.Duration, name string) {
+	if tmr.id != 0 {
+		return
+	}
+	tmr.id = f.timers.StartTimer(NO_TIMER_NAME, func() {
+		tmr.id = 0
+		tmr.expired = true
+		if f.recheck != nil {
+			f.recheck(name)
+		}
+	}, d, false)
+}
+
+func (f *CondFilter) stopTimer(tmr *condFilterTimer) {
+	if tmr.id != 0 {
+		f.timers.StopTimerByIndex(tmr.id)
+		tmr.id = 0
+	}
+}
+
+// Stop stops pending filter timers
+func (f *CondFilter) Stop() {
+	f.recheck = nil
+	f.stopTimer(&f.debounceTmr)
+	f.stopTimer(&f.holdTmr)
+}
+
+// FilteredRuleCondition wraps level or edge triggered condition
+// which uses CondFilter value as its condition function
+type FilteredRuleCondition struct {
+	RuleCondition
+	filter *CondFilter
+}
+
+func NewFilteredRuleCondition(cond RuleCondition, filter *CondFilter) *FilteredRuleCondition {
+	return &FilteredRuleCondition{
+		RuleCondition: cond,
+		filter:        filter,
+	}
+}
+
 type CellChangedRuleCondition struct {
 	RuleConditionBase
 	ctrlSpec ControlSpec
@@ -238,14 +394,40 @@ func (ruleCond *OrRuleCondition) Check(e *ControlChangeEvent) (bool, any) {
 	return res, newValue
 }
 
-type CronRuleCondition struct {
+// ScheduledRuleCondition is a condition of the rule
+// that is run by cron instead of checking controls
+type ScheduledRuleCondition interface {
+	RuleCondition
+	MaybeAddToCron(cron Cron, thunk func()) error
+	RemoveFromCron(cron Cron)
+	IsScheduled() bool
+	// Spec returns the schedule description for tracing and logging
+	Spec() string
+}
+
+type scheduledRuleConditionBase struct {
 	RuleConditionBase
-	spec    string
 	entryId cron.EntryID
 }
 
+func (ruleCond *scheduledRuleConditionBase) RemoveFromCron(cron Cron) {
+	if ruleCond.entryId != 0 {
+		cron.Remove(ruleCond.entryId)
+		ruleCond.entryId = 0
+	}
+}
+
+func (ruleCond *scheduledRuleConditionBase) IsScheduled() bool {
+	return ruleCond.entryId != 0
+}
+
+type CronRuleCondition struct {
+	scheduledRuleConditionBase
+	spec string
+}
+
 func NewCronRuleCondition(spec string) *CronRuleCondition {
-	return &CronRuleCondition{spec: spec, entryId: 0}
+	return &CronRuleCondition{spec: spec}
 }
 
 func (ruleCond *CronRuleCondition) MaybeAddToCron(cron Cron, thunk func()) (err error) {
@@ -253,6 +435,30 @@ func (ruleCond *CronRuleCondition) MaybeAddToCron(cron Cron, thunk func()) (err
 	return
 }
 
+func (ruleCond *CronRuleCondition) Spec() string {
+	return ruleCond.spec
+}
+
+// SunRuleCondition runs the rule daily at the solar event
+// (e.g. 30 minutes after sunset)
+type SunRuleCondition struct {
+	scheduledRuleConditionBase
+	schedule *SunSchedule
+}
+
+func NewSunRuleCondition(schedule *SunSchedule) *SunRuleCondition {
+	return &SunRuleCondition{schedule: schedule}
+}
+
+func (ruleCond *SunRuleCondition) MaybeAddToCron(c Cron, thunk func()) error {
+	ruleCond.entryId = c.Schedule(ruleCond.schedule, cron.FuncJob(thunk))
+	return nil
+}
+
+func (ruleCond *SunRuleCondition) Spec() string {
+	return "sun:" + ruleCond.schedule.String()
+}
+
 // RuleId is returned from defineRule to control rule
 type RuleId uint32
 
@@ -267,6 +473,14 @@ type Rule struct {
 	isIndependent bool
 	hasDeps       bool
 	enabled       bool
+	switchable    bool
+	script        string // script the rule is defined in
+	priority      int
+	trace         *RuleTrace
+	tracer        ruleTracer
+	metrics       *RuleMetrics
+	// number of callback execution time limit violations
+	watchdogViolations int
 }
 
 func NewRule(tracker DepTracker, id RuleId, name string, cond RuleCondition, then ESCallbackFunc) *Rule {
@@ -281,10 +495,31 @@ func NewRule(tracker DepTracker, id RuleId, name string, cond RuleCondition, the
 		hasDeps:       false,
 		enabled:       true,
 	}
+	if filteredCond, ok := cond.(*FilteredRuleCondition); ok {
+		filteredCond.filter.recheck = rule.recheck
+	}
 	rule.StoreInitiallyKnownDeps()
 	return rule
 }
 
+// SetPriority sets the rule priority. Rules with higher priority
+// are checked later, so they may override outputs of other rules
+func (rule *Rule) SetPriority(priority int) {
+	rule.priority = priority
+}
+
+// RunsBefore defines the order of rule checks: rules are sorted by
+// priority (ascending), then by script path, then by definition order
+func (rule *Rule) RunsBefore(other *Rule) bool {
+	if rule.priority != other.priority {
+		return rule.priority < other.priority
+	}
+	if rule.script != other.script {
+		return rule.script < other.script
+	}
+	return rule.id < other.id
+}
+
 func (rule *Rule) StoreInitiallyKnownDeps() {
 	for _, ctrlSpec := range rule.cond.GetControlSpecs() {
 		rule.tracker.StoreRuleControlSpec(rule, ctrlSpec)
@@ -299,7 +534,7 @@ func (rule *Rule) SetCheckMode(mode CheckMode) {
 	rule.checkMode = mode
 }
 
-func (rule *Rule) Check(e *ControlChangeEvent) {
+func (rule *Rule) Check(e *ControlChangeEvent, timerName string) {
 	if e != nil && rule.checkMode == CheckModeNone {
 		// Don't invoke js if no cells mentioned in the
 		// condition callback changed. If rules are run
@@ -307,6 +542,9 @@ func (rule *Rule) Check(e *ControlChangeEvent) {
 		// to call JS though.
 		return
 	}
+	entry, prevEntry := rule.beginTrace(newRuleTraceEntry(e, timerName))
+	defer rule.endTrace(entry, prevEntry)
+
 	rule.tracker.StartTrackingDeps()
 
 	noDeps := rule.checkMode == CheckModeIndependent
@@ -323,6 +561,10 @@ func (rule *Rule) Check(e *ControlChangeEvent) {
 
 	rule.tracker.StoreRuleDeps(rule)
 
+	if entry != nil {
+		entry.CondResult = shouldFire
+	}
+
 	if !rule.enabled || !shouldFire {
 		return
 	}
@@ -343,15 +585,100 @@ func (rule *Rule) Check(e *ControlChangeEvent) {
 	if wbgong.DebuggingEnabled() {
 		wbgong.Debug.Printf("[rule] firing Rule ruleId=%d", rule.id)
 	}
+	if entry == nil {
+		rule.then(args)
+		return
+	}
+	entry.Fired = true
+	thenStart := time.Now()
 	rule.then(args)
+	entry.thenDuration = time.Since(thenStart)
+}
+
+// recheck checks the rule outside of RunRules,
+// e.g. when its condition filter timer expires
+func (rule *Rule) recheck(timerName string) {
+	if rule.then == nil {
+		// destroyed
+		return
+	}
+	rule.Check(nil, timerName)
+}
+
+// Run unconditionally invokes rule's then callback (runRule() in JS)
+func (rule *Rule) Run() {
+	entry, prevEntry := rule.beginTrace(&RuleTraceEntry{
+		Timestamp:  time.Now(),
+		Trigger:    RULE_TRACE_TRIGGER_RUN,
+		CondResult: true,
+		Fired:      true,
+	})
+	defer rule.endTrace(entry, prevEntry)
+
+	rule.then(nil)
+}
+
+// beginTrace makes the entry current for the rule tracer.
+// It returns nil entry if the rule has no tracer
+func (rule *Rule) beginTrace(entry *RuleTraceEntry) (*RuleTraceEntry, *RuleTraceEntry) {
+	if rule.tracer == nil {
+		return nil, nil
+	}
+	entry.rule = rule
+	entry.syncWait, entry.syncQueued = rule.tracer.activeSyncWait()
+	return entry, rule.tracer.swapActiveTrace(entry)
+}
+
+func (rule *Rule) endTrace(entry, prevEntry *RuleTraceEntry) {
+	if entry == nil {
+		return
+	}
+	rule.tracer.swapActiveTrace(prevEntry)
+	duration := time.Since(entry.Timestamp)
+	entry.DurationUs = duration.Microseconds()
+	if entry.Fired && entry.thenDuration == 0 {
+		// cron and runRule() invoke then only
+		entry.thenDuration = duration
+	}
+	if rule.trace != nil {
+		rule.trace.Push(*entry)
+	}
+	if rule.metrics != nil {
+		rule.metrics.Observe(entry)
+	}
+}
+
+// SetTracer sets the tracer used to attribute
+// errors thrown by rule callbacks to the rule
+func (rule *Rule) SetTracer(tracer ruleTracer) {
+	rule.tracer = tracer
+}
+
+// SetTrace enables execution tracing for the rule
+func (rule *Rule) SetTrace(trace *RuleTrace) {
+	rule.trace = trace
+}
+
+// SetMetrics enables execution metrics for the rule
+func (rule *Rule) SetMetrics(metrics *RuleMetrics) {
+	rule.metrics = metrics
 }
 
 func (rule *Rule) MaybeAddToCron(cron Cron) {
-	if cronCond, ok := rule.cond.(*CronRuleCondition); ok {
+	if cronCond, ok := rule.cond.(ScheduledRuleCondition); ok {
 		err := cronCond.MaybeAddToCron(cron, func() {
-			if rule.then != nil {
-				rule.then(nil)
+			if rule.then == nil {
+				return
 			}
+			entry, prevEntry := rule.beginTrace(&RuleTraceEntry{
+				Timestamp:  time.Now(),
+				Trigger:    RULE_TRACE_TRIGGER_CRON,
+				Cron:       cronCond.Spec(),
+				CondResult: true,
+				Fired:      true,
+			})
+			defer rule.endTrace(entry, prevEntry)
+			rule.then(nil)
 		})
 		rule.isIndependent = err == nil
 		if err != nil {
@@ -377,19 +704,22 @@ func (rule *Rule) HasDeps() bool {
 	return rule.isIndependent || rule.hasDeps
 }
 
+// SetSwitchable makes the rule switchable by the operator. The rule gets
+// a switch control on the rule switches device and its state is saved
+func (rule *Rule) SetSwitchable(switchable bool) {
+	rule.switchable = switchable
+}
+
 func (rule *Rule) SetState(state bool, cron Cron) {
 	rule.enabled = state
 
-	if cronCond, ok := rule.cond.(*CronRuleCondition); ok {
+	if cronCond, ok := rule.cond.(ScheduledRuleCondition); ok {
 		if state {
-			if cronCond.entryId == 0 {
+			if !cronCond.IsScheduled() {
 				rule.MaybeAddToCron(cron)
 			}
 		} else {
-			if cronCond.entryId != 0 {
-				cron.Remove(cronCond.entryId)
-				cronCond.entryId = 0
-			}
+			cronCond.RemoveFromCron(cron)
 		}
 	}
 }
@@ -0,0 +1,215 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleCondFiltersSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleCondFiltersSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_cond_filters.js")
+}
+
+func (s *RuleCondFiltersSuite) TestHoldFor() {
+	s.publish("/devices/somedev/controls/hold/meta/type", "value", "somedev/hold")
+	s.publish("/devices/somedev/controls/hold", "20", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold/meta/type: [value] (QoS 1, retained)",
+		"tst -> /devices/somedev/controls/hold: [20] (QoS 1, retained)",
+		"new fake timer: 1, 1000",
+	)
+
+	// condition became false before holdFor expired
+	s.publish("/devices/somedev/controls/hold", "5", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold: [5] (QoS 1, retained)",
+		"timer.Stop(): 1",
+	)
+
+	s.publish("/devices/somedev/controls/hold", "20", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold: [20] (QoS 1, retained)",
+		"new fake timer: 2, 1000",
+	)
+
+	// the condition value doesn't change, the timer keeps running
+	s.publish("/devices/somedev/controls/hold", "30", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold: [30] (QoS 1, retained)",
+	)
+
+	s.FireTimer(2, s.AdvanceTime(1000*time.Millisecond))
+	s.Verify(
+		"timer.fire(): 2",
+		"[info] hold fired",
+	)
+
+	// asSoonAs doesn't fire again while the condition is true
+	s.publish("/devices/somedev/controls/hold", "40", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold: [40] (QoS 1, retained)",
+	)
+	s.VerifyEmpty()
+}
+
+func (s *RuleCondFiltersSuite) TestDebounce() {
+	s.publish("/devices/somedev/controls/bounce/meta/type", "value", "somedev/bounce")
+	s.publish("/devices/somedev/controls/bounce", "1", "somedev/bounce")
+	s.Verify(
+		"tst -> /devices/somedev/controls/bounce/meta/type: [value] (QoS 1, retained)",
+		"tst -> /devices/somedev/controls/bounce: [1] (QoS 1, retained)",
+		"new fake timer: 1, 500",
+	)
+
+	s.publish("/devices/somedev/controls/bounce", "0", "somedev/bounce")
+	s.Verify(
+		"tst -> /devices/somedev/controls/bounce: [0] (QoS 1, retained)",
+		"timer.Stop(): 1",
+	)
+
+	s.publish("/devices/somedev/controls/bounce", "1", "somedev/bounce")
+	s.Verify(
+		"tst -> /devices/somedev/controls/bounce: [1] (QoS 1, retained)",
+		"new fake timer: 2, 500",
+	)
+	s.FireTimer(2, s.AdvanceTime(500*time.Millisecond))
+	s.Verify(
+		"timer.fire(): 2",
+		"[info] debounce fired",
+	)
+
+	// falling edge is debounced too
+	s.publish("/devices/somedev/controls/bounce", "0", "somedev/bounce")
+	s.Verify(
+		"tst -> /devices/somedev/controls/bounce: [0] (QoS 1, retained)",
+		"new fake timer: 3, 500",
+	)
+	s.publish("/devices/somedev/controls/bounce", "1", "somedev/bounce")
+	s.Verify(
+		"tst -> /devices/somedev/controls/bounce: [1] (QoS 1, retained)",
+		"timer.Stop(): 3",
+	)
+	s.VerifyEmpty()
+}
+
+func (s *RuleCondFiltersSuite) TestHysteresis() {
+	s.publish("/devices/somedev/controls/temp", "31", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [31] (QoS 1, retained)",
+		"[info] overheat",
+	)
+
+	// still above the hysteresis threshold
+	s.publish("/devices/somedev/controls/temp", "29", "somedev/temp")
+	s.publish("/devices/somedev/controls/temp", "31", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [29] (QoS 1, retained)",
+		"tst -> /devices/somedev/controls/temp: [31] (QoS 1, retained)",
+	)
+
+	s.publish("/devices/somedev/controls/temp", "27", "somedev/temp")
+	s.publish("/devices/somedev/controls/temp", "31", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [27] (QoS 1, retained)",
+		"tst -> /devices/somedev/controls/temp: [31] (QoS 1, retained)",
+		"[info] overheat",
+	)
+}
+
+func (s *RuleCondFiltersSuite) TestCleanup() {
+	s.publish("/devices/somedev/controls/hold/meta/type", "value", "somedev/hold")
+	s.publish("/devices/somedev/controls/hold", "20", "somedev/hold")
+	s.Verify(
+		"tst -> /devices/somedev/controls/hold/meta/type: [value] (QoS 1, retained)",
+		"tst -> /devices/somedev/controls/hold: [20] (QoS 1, retained)",
+		"new fake timer: 1, 1000",
+	)
+
+	s.RemoveScript("testrules_cond_filters.js")
+	s.VerifyUnordered(
+		"timer.Stop(): 1",
+		"[removed] testrules_cond_filters.js",
+	)
+}
+
+type fakeCondTimers struct {
+	nextId    TimerId
+	callbacks map[TimerId]func()
+}
+
+func newFakeCondTimers() *fakeCondTimers {
+	return &fakeCondTimers{1, make(map[TimerId]func())}
+}
+
+func (timers *fakeCondTimers) StartTimer(name string, callback func(), interval time.Duration, periodic bool) TimerId {
+	id := timers.nextId
+	timers.nextId++
+	timers.callbacks[id] = callback
+	return id
+}
+
+func (timers *fakeCondTimers) StopTimerByIndex(n TimerId) {
+	delete(timers.callbacks, n)
+}
+
+func (timers *fakeCondTimers) fire(n TimerId) {
+	callback := timers.callbacks[n]
+	delete(timers.callbacks, n)
+	callback()
+}
+
+func TestCondFilter(t *testing.T) {
+	value, hold := false, false
+	timers := newFakeCondTimers()
+	filter := NewCondFilter(func() bool { return value }, CondFilterOptions{
+		Hysteresis: func() bool { return hold },
+		Debounce:   time.Second,
+		HoldFor:    time.Second,
+	}, timers)
+	results := []bool{}
+	filter.recheck = func(timerName string) {
+		results = append(results, filter.Value())
+	}
+
+	assert.False(t, filter.Value())
+	assert.Empty(t, timers.callbacks)
+
+	value = true
+	assert.False(t, filter.Value())
+	assert.Contains(t, timers.callbacks, TimerId(1))
+
+	// debounce accepted, holdFor is started
+	timers.fire(1)
+	assert.Equal(t, []bool{false}, results)
+	assert.Contains(t, timers.callbacks, TimerId(2))
+
+	// hysteresis keeps the condition active
+	value, hold = false, true
+	timers.fire(2)
+	assert.Equal(t, []bool{false, true}, results)
+	assert.True(t, filter.Value())
+
+	// hysteresis released, debounce timer is started
+	hold = false
+	assert.True(t, filter.Value())
+	assert.Contains(t, timers.callbacks, TimerId(3))
+	timers.fire(3)
+	assert.Equal(t, []bool{false, true, false}, results)
+
+	value = true
+	assert.False(t, filter.Value())
+	filter.Stop()
+	assert.Empty(t, timers.callbacks)
+}
+
+func TestRuleCondFiltersSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleCondFiltersSuite),
+	)
+}
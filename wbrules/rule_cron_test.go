@@ -1,8 +1,10 @@
 package wbrules
 
 import (
-	"github.com/wirenboard/wbgong/testutils"
 	"testing"
+	"time"
+
+	"github.com/wirenboard/wbgong/testutils"
 )
 
 type RuleCronSuite struct {
@@ -13,14 +15,18 @@ func (s *RuleCronSuite) SetupTest() {
 	s.SetupSkippingDefs("testrules_cron.js")
 }
 
-func (s *RuleCronSuite) TestCron() {
+func (s *RuleCronSuite) waitForCron(loc *time.Location) {
 	s.WaitFor(func() bool {
 		c := make(chan bool)
 		s.engine.CallSync(func() {
-			c <- s.cron != nil && s.cron.started
+			c <- s.cron != nil && s.cron.started && s.cron.location.String() == loc.String()
 		})
 		return <-c
 	})
+}
+
+func (s *RuleCronSuite) TestCron() {
+	s.waitForCron(time.Local)
 
 	s.cron.invokeEntries("@hourly")
 	s.cron.invokeEntries("@hourly")
@@ -54,6 +60,55 @@ func (s *RuleCronSuite) TestCron() {
 	)
 }
 
+func (s *RuleCronSuite) TestCronTimezone() {
+	s.waitForCron(time.Local)
+	s.cron.invokeEntries("CRON_TZ=Europe/Moscow 0 0 9 * * *")
+	s.Verify("[info] Europe/Moscow 9:00 rule fired")
+
+	s.publish("/devices/wbrules/controls/Timezone/on", "Asia/Tokyo", "wbrules/Timezone")
+	s.Verify(
+		"tst -> /devices/wbrules/controls/Timezone/on: [Asia/Tokyo] (QoS 1)",
+		"driver -> /devices/wbrules/controls/Timezone: [Asia/Tokyo] (QoS 1, retained)",
+		"[info] cron time zone is set to Asia/Tokyo",
+	)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	s.Ck("LoadLocation()", err)
+	// cron is restarted with all the rules
+	s.waitForCron(tokyo)
+	s.cron.invokeEntries("@hourly")
+	s.cron.invokeEntries("CRON_TZ=Europe/Moscow 0 0 9 * * *")
+	s.Verify(
+		"[info] @hourly rule fired",
+		"[info] Europe/Moscow 9:00 rule fired",
+	)
+
+	s.publish("/devices/wbrules/controls/Timezone/on", "Nowhere/Town", "wbrules/Timezone")
+	s.Verify(
+		"tst -> /devices/wbrules/controls/Timezone/on: [Nowhere/Town] (QoS 1)",
+		"driver -> /devices/wbrules/controls/Timezone: [Nowhere/Town] (QoS 1, retained)",
+		"[error] invalid cron time zone \"Nowhere/Town\": unknown time zone Nowhere/Town",
+	)
+	s.EnsureGotErrors()
+	s.waitForCron(tokyo)
+
+	s.publish("/devices/wbrules/controls/Timezone/on", "", "wbrules/Timezone")
+	s.Verify(
+		"tst -> /devices/wbrules/controls/Timezone/on: [] (QoS 1)",
+		"driver -> /devices/wbrules/controls/Timezone: [] (QoS 1, retained)",
+		"[info] cron time zone is set to Local",
+	)
+	s.waitForCron(time.Local)
+}
+
+func (s *RuleCronSuite) TestInvalidCronTimezone() {
+	s.engine.EvalScript("testInvalidCronTimezone()")
+	s.Verify(
+		"[error] bad definition of rule 'badTz': error building rule condition: invalid rule -- unknown cron time zone \"Mars/Olympus\"",
+		"[info] cron time zone is specified twice",
+	)
+	s.EnsureGotErrors()
+}
+
 func TestRuleCronSuite(t *testing.T) {
 	testutils.RunSuites(t,
 		new(RuleCronSuite),
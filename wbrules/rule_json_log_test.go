@@ -0,0 +1,57 @@
+package wbrules
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleJSONLogSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleJSONLogSuite) SetupTest() {
+	s.JSONLog = true
+	var err error
+	s.LogRing, err = NewLogRing(10, "")
+	s.Ck("NewLogRing()", err)
+	s.SetupSkippingDefs("testrules_json_log.js")
+}
+
+func (s *RuleJSONLogSuite) TestJSONLog() {
+	s.publish("/devices/logtest/controls/fire/on", "1", "logtest/fire")
+	s.Verify(
+		"tst -> /devices/logtest/controls/fire/on: [1] (QoS 1)",
+		"driver -> /devices/logtest/controls/fire: [1] (QoS 1)",
+		"[warning] fired: 42",
+		regexp.MustCompile(`^wbrules-log -> /wbrules/log/json: \[\{"timestamp":"[^"]+",`+
+			`"level":"warning","script":"testrules_json_log\.js","line":14,"rule":"logRule",`+
+			`"message":"fired: 42"\}\] \(QoS 1\)$`),
+		regexp.MustCompile(`(?s:ECMAScript error:.*undefinedFunc.*)`),
+		regexp.MustCompile(`^wbrules-log -> /wbrules/log/json: \[\{"timestamp":"[^"]+",`+
+			`"level":"error","script":"testrules_json_log\.js","line":15,"rule":"logRule",`+
+			`"message":"ECMAScript error: .*undefinedFunc.*"\}\] \(QoS 1\)$`),
+	)
+	s.EnsureGotErrors()
+
+	result, err := s.engine.QueryLog(&LogQuery{Script: "testrules_json_log.js", Level: ENGINE_LOG_WARNING})
+	s.Ck("QueryLog()", err)
+	s.Require().Len(result.Entries, 2)
+	s.Equal(ENGINE_LOG_ERROR, result.Entries[0].Level)
+	s.Equal(15, result.Entries[0].Line)
+	s.Equal(LogRecord{
+		Timestamp: result.Entries[1].Timestamp,
+		Level:     ENGINE_LOG_WARNING,
+		Script:    "testrules_json_log.js",
+		Line:      14,
+		Rule:      "logRule",
+		Message:   "fired: 42",
+	}, result.Entries[1])
+}
+
+func TestRuleJSONLogSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleJSONLogSuite),
+	)
+}
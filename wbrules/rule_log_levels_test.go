@@ -0,0 +1,81 @@
+package wbrules
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleLogLevelsSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleLogLevelsSuite) SetupTest() {
+	currentDir, _ := os.Getwd()
+	s.ModulesPath = currentDir + "/test-modules"
+	s.SetupSkippingDefs("testrules_log_levels.js")
+}
+
+func (s *RuleLogLevelsSuite) fire(logs ...any) {
+	s.publish("/devices/lvltest/controls/fire/on", "1", "lvltest/fire")
+	s.Verify(append([]any{
+		"tst -> /devices/lvltest/controls/fire/on: [1] (QoS 1)",
+		"driver -> /devices/lvltest/controls/fire: [1] (QoS 1)",
+	}, logs...)...)
+	s.VerifyEmpty()
+}
+
+func (s *RuleLogLevelsSuite) TestLogLevels() {
+	s.fire(
+		"[warning] script warning",
+		"[info] module info",
+	)
+
+	// module messages follow the level of the script
+	s.engine.SetLogLevel("testrules_log_levels.js", ENGINE_LOG_DEBUG)
+	s.Verify("[info] log level of testrules_log_levels.js is set to debug")
+	s.fire(
+		"[debug] script debug",
+		"[warning] script warning",
+		"[debug] module debug",
+		"[info] module info",
+	)
+
+	// unless the level is set for the module
+	s.engine.SetLogLevel("test/chatty", ENGINE_LOG_ERROR)
+	s.Verify("[info] log level of test/chatty is set to error")
+	s.fire(
+		"[debug] script debug",
+		"[warning] script warning",
+	)
+	s.Equal(map[string]EngineLogLevel{
+		"testrules_log_levels.js": ENGINE_LOG_DEBUG,
+		"test/chatty":             ENGINE_LOG_ERROR,
+	}, s.engine.LogLevels())
+
+	s.publish("/devices/lvltest/controls/quiet/on", "1", "lvltest/quiet")
+	s.Verify(
+		"tst -> /devices/lvltest/controls/quiet/on: [1] (QoS 1)",
+		"driver -> /devices/lvltest/controls/quiet: [1] (QoS 1)",
+		"[info] log level of testrules_log_levels.js is set to error",
+	)
+	s.fire()
+
+	s.engine.ResetLogLevel("testrules_log_levels.js")
+	s.engine.ResetLogLevel("test/chatty")
+	s.Verify(
+		"[info] log level of testrules_log_levels.js is reset",
+		"[info] log level of test/chatty is reset",
+	)
+	s.fire(
+		"[warning] script warning",
+		"[info] module info",
+	)
+}
+
+func TestRuleLogLevelsSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleLogLevelsSuite),
+	)
+}
@@ -0,0 +1,32 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RulePrioritySuite struct {
+	RuleSuiteBase
+}
+
+func (s *RulePrioritySuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_priority.js")
+}
+
+func (s *RulePrioritySuite) TestPriority() {
+	s.publish("/devices/somedev/controls/temp", "42", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [42] (QoS 1, retained)",
+		"[info] early",
+		"[info] first",
+		"[info] second",
+		"[info] interlock",
+	)
+}
+
+func TestRulePrioritySuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RulePrioritySuite),
+	)
+}
@@ -0,0 +1,78 @@
+package wbrules
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleQuarantineSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleQuarantineSuite) SetupTest() {
+	s.QuarantineErrors = 2
+	s.QuarantineWindow = time.Minute
+	s.SetupSkippingDefs("testrules_quarantine.js")
+}
+
+func (s *RuleQuarantineSuite) fail() {
+	s.publish("/devices/qtest/controls/fail/on", "1", "qtest/fail")
+	s.Verify(
+		"tst -> /devices/qtest/controls/fail/on: [1] (QoS 1)",
+		"driver -> /devices/qtest/controls/fail: [1] (QoS 1)",
+		regexp.MustCompile(`(?s:ECMAScript error:.*failing rule.*)`),
+	)
+}
+
+func (s *RuleQuarantineSuite) sourceEntry() LocFileEntry {
+	entries, err := s.engine.ListSourceFiles()
+	s.Ck("ListSourceFiles", err)
+	for _, entry := range entries {
+		if entry.VirtualPath == "testrules_quarantine.js" {
+			return entry
+		}
+	}
+	s.Require().Fail("script entry not found")
+	return LocFileEntry{}
+}
+
+func (s *RuleQuarantineSuite) TestQuarantine() {
+	s.fail()
+	s.Nil(s.sourceEntry().Quarantine)
+
+	s.fail()
+	s.SkipTill("[changed] testrules_quarantine.js")
+	s.SkipTill(regexp.MustCompile(`^\[error\] script testrules_quarantine\.js is quarantined: ` +
+		`2 runtime errors within 1m0s, last error: .*failing rule`))
+
+	entry := s.sourceEntry()
+	s.Require().NotNil(entry.Quarantine)
+	s.Contains(entry.Quarantine.Reason, "failing rule")
+	s.Empty(entry.Rules, "rules of the quarantined script must be unloaded")
+	s.Empty(entry.Devices, "devices of the quarantined script must be removed")
+
+	reloaded, err := s.engine.UnquarantineScript("testrules_quarantine.js")
+	s.Ck("UnquarantineScript", err)
+	s.True(reloaded)
+	s.SkipTill("[info] script testrules_quarantine.js is released from quarantine")
+	s.SkipTill("[changed] testrules_quarantine.js")
+	entry = s.sourceEntry()
+	s.Nil(entry.Quarantine)
+	s.Equal([]LocItem{{11, "failingRule"}}, entry.Rules)
+
+	reloaded, err = s.engine.UnquarantineScript("testrules_quarantine.js")
+	s.Ck("UnquarantineScript", err)
+	s.False(reloaded)
+
+	s.fail()
+	s.EnsureGotErrors()
+}
+
+func TestRuleQuarantineSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleQuarantineSuite),
+	)
+}
@@ -0,0 +1,51 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleSunSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleSunSuite) SetupTest() {
+	s.Location = &GeoLocation{55.7558, 37.6173}
+	s.SetupSkippingDefs("testrules_sun.js")
+}
+
+func (s *RuleSunSuite) TestSun() {
+	s.WaitFor(func() bool {
+		c := make(chan bool)
+		s.engine.CallSync(func() {
+			c <- s.cron != nil && s.cron.started
+		})
+		return <-c
+	})
+
+	s.cron.invokeEntries("sunset+30m0s")
+	s.cron.invokeEntries("sunrise-15m0s")
+	s.cron.invokeEntries("dusk")
+	s.Verify(
+		"[info] sunset+30m rule fired",
+		"[info] sunrise-15m rule fired",
+		"[info] dusk rule fired",
+	)
+}
+
+func (s *RuleSunSuite) TestInvalidSun() {
+	s.engine.EvalScript("testInvalidSun()")
+	s.Verify(
+		"[error] bad definition of rule 'badEvent': error building rule condition: invalid rule -- unknown sun event \"moonrise\"",
+		"[error] bad definition of rule 'badOffset': error building rule condition: invalid rule -- sun schedule offset: invalid duration: \"soon\"",
+		"[error] bad definition of rule 'noLon': error building rule condition: invalid rule -- sun schedule needs both 'lat' and 'lon'",
+	)
+	s.EnsureGotErrors()
+}
+
+func TestRuleSunSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleSunSuite),
+	)
+}
@@ -0,0 +1,224 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/stretchr/objx"
+	"github.com/wirenboard/wbgong"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	RULE_SWITCHES_DEV_NAME     = "wbrules_switches"
+	RULE_SWITCHES_DEV_TITLE    = "Rule switches"
+	RULE_SWITCHES_DEV_TITLE_RU = "Включение правил"
+
+	// persistent DB bucket for the states of switchable rules
+	RULE_STATES_BUCKET = "_wbrules_rule_states"
+)
+
+// RuleStateStorage keeps enabled/disabled states of switchable rules
+type RuleStateStorage interface {
+	LoadRuleState(name string) (enabled bool, found bool)
+	StoreRuleState(name string, enabled bool) error
+}
+
+func validateRuleSwitchName(name string) error {
+	if name == "" {
+		return fmt.Errorf("switchable rule must have a name")
+	}
+	if strings.ContainsAny(name, "/+#") {
+		return fmt.Errorf("switchable rule name must not contain '/', '+' or '#'")
+	}
+	return nil
+}
+
+func (engine *RuleEngine) checkRuleSwitch(rule *Rule) error {
+	if other, found := engine.ruleSwitches[rule.name]; found {
+		return fmt.Errorf("rule switch '%s' is already defined in %s", rule.name, other.script)
+	}
+	return nil
+}
+
+// addRuleSwitch publishes the switch control for the rule on
+// the rule switches device, restoring the rule state saved before.
+// The control is removed when the rule is removed
+func (engine *RuleEngine) addRuleSwitch(rule *Rule) {
+	engine.ruleSwitches[rule.name] = rule
+
+	if engine.ruleStates != nil {
+		if enabled, found := engine.ruleStates.LoadRuleState(rule.name); found {
+			rule.SetState(enabled, engine.cron)
+		}
+	}
+
+	args := wbgong.NewControlArgs().SetId(rule.name)
+	err := fillControlArgs(RULE_SWITCHES_DEV_NAME, rule.name, objx.Map{
+		"type":         "switch",
+		"value":        rule.enabled,
+		"readonly":     false,
+		"forceDefault": true,
+	}, args)
+	if err == nil {
+		err = engine.driver.Access(func(tx wbgong.DriverTx) (err error) {
+			dev := tx.GetDevice(RULE_SWITCHES_DEV_NAME)
+			if dev == nil {
+				devArgs := wbgong.NewLocalDeviceArgs().
+					SetId(RULE_SWITCHES_DEV_NAME).
+					SetVirtual(true).
+					SetTitle(wbgong.Title{
+						"en": RULE_SWITCHES_DEV_TITLE,
+						"ru": RULE_SWITCHES_DEV_TITLE_RU,
+					})
+				if dev, err = tx.CreateDevice(devArgs)(); err != nil {
+					return
+				}
+			}
+			localDevice, isLocal := dev.(wbgong.LocalDevice)
+			if !isLocal {
+				return wbgong.ExternalDeviceError
+			}
+			_, err = localDevice.CreateControl(args)()
+			return
+		})
+	}
+
+	engine.cleanup.AddCleanup(func() {
+		if engine.ruleSwitches[rule.name] != rule {
+			return
+		}
+		delete(engine.ruleSwitches, rule.name)
+		engine.removeRuleSwitchControl(rule.name)
+	})
+
+	if err != nil {
+		engine.Logf(ENGINE_LOG_ERROR, "failed to create switch of rule '%s': %s", rule.name, err)
+	}
+}
+
+// removeRuleSwitchControl removes the switch control of the rule
+// and the rule switches device after the last control is removed
+func (engine *RuleEngine) removeRuleSwitchControl(name string) {
+	err := engine.driver.Access(func(tx wbgong.DriverTx) error {
+		dev := tx.GetDevice(RULE_SWITCHES_DEV_NAME)
+		if dev == nil {
+			return nil
+		}
+		localDevice, isLocal := dev.(wbgong.LocalDevice)
+		if !isLocal {
+			return wbgong.ExternalDeviceError
+		}
+		if localDevice.GetControl(name) != nil {
+			if err := localDevice.RemoveControl(name)(); err != nil {
+				return err
+			}
+		}
+		if len(localDevice.ControlsList()) == 0 {
+			return tx.RemoveDevice(localDevice)()
+		}
+		return nil
+	})
+	if err != nil {
+		wbgong.Warn.Printf("failed to remove switch of rule %s: %s", name, err)
+	}
+}
+
+func (engine *RuleEngine) isRuleSwitchControl(ctrlSpec ControlSpec) bool {
+	return ctrlSpec.DeviceId == RULE_SWITCHES_DEV_NAME
+}
+
+// updateRuleFromSwitch applies the value of the rule switch
+// control to the rule. Must be called from the sync loop
+func (engine *RuleEngine) updateRuleFromSwitch(name string) {
+	rule, found := engine.ruleSwitches[name]
+	if !found {
+		return
+	}
+	var enabled bool
+	err := engine.driver.Access(func(tx wbgong.DriverTx) error {
+		dev := tx.GetDevice(RULE_SWITCHES_DEV_NAME)
+		if dev == nil {
+			return ControlNotFoundError
+		}
+		ctrl := dev.GetControl(name)
+		if ctrl == nil {
+			return ControlNotFoundError
+		}
+		v, err := ctrl.GetValue()
+		if err == nil {
+			enabled, _ = v.(bool)
+		}
+		return err
+	})
+	if err != nil || enabled == rule.enabled {
+		return
+	}
+	engine.SetRuleState(rule, enabled)
+	if enabled {
+		engine.Logf(ENGINE_LOG_INFO, "rule '%s' is enabled by switch", name)
+	} else {
+		engine.Logf(ENGINE_LOG_INFO, "rule '%s' is disabled by switch", name)
+	}
+}
+
+// SetRuleState enables or disables the rule. The state of switchable
+// rules is saved and reflected by their switch controls
+func (engine *RuleEngine) SetRuleState(rule *Rule, enabled bool) {
+	rule.SetState(enabled, engine.cron)
+	if !rule.switchable || engine.ruleSwitches[rule.name] != rule {
+		return
+	}
+
+	if engine.ruleStates != nil {
+		if err := engine.ruleStates.StoreRuleState(rule.name, enabled); err != nil {
+			engine.Logf(ENGINE_LOG_ERROR, "failed to save state of rule '%s': %s", rule.name, err)
+		}
+	}
+
+	err := engine.driver.Access(func(tx wbgong.DriverTx) error {
+		dev := tx.GetDevice(RULE_SWITCHES_DEV_NAME)
+		if dev == nil {
+			return ControlNotFoundError
+		}
+		ctrl := dev.GetControl(rule.name)
+		if ctrl == nil {
+			return ControlNotFoundError
+		}
+		if v, err := ctrl.GetValue(); err == nil && v == enabled {
+			return nil
+		}
+		return ctrl.UpdateValue(enabled, true)()
+	})
+	if err != nil {
+		wbgong.Warn.Printf("failed to update switch of rule %s: %s", rule.name, err)
+	}
+}
+
+// LoadRuleState implements RuleStateStorage using the persistent DB
+func (engine *ESEngine) LoadRuleState(name string) (enabled bool, found bool) {
+	engine.persistentView(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(RULE_STATES_BUCKET))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(name)); v != nil {
+			found = json.Unmarshal(v, &enabled) == nil
+		}
+		return nil
+	})
+	return
+}
+
+// StoreRuleState implements RuleStateStorage using the persistent DB
+func (engine *ESEngine) StoreRuleState(name string, enabled bool) error {
+	value, _ := json.Marshal(enabled)
+	return engine.persistentUpdate(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(RULE_STATES_BUCKET))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(name), value)
+	})
+}
@@ -0,0 +1,101 @@
+package wbrules
+
+import (
+	"os"
+	"testing"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleSwitchesSuite struct {
+	RuleSuiteBase
+	tmpDir string
+}
+
+func (s *RuleSwitchesSuite) SetupFixture() {
+	var err error
+
+	// persistent DB file should be kept between tests
+	s.tmpDir, err = os.MkdirTemp("", "wbrulestest")
+	if err != nil {
+		s.FailNow("can't create temp directory")
+	}
+}
+
+func (s *RuleSwitchesSuite) TearDownFixture() {
+	os.RemoveAll(s.tmpDir)
+}
+
+func (s *RuleSwitchesSuite) SetupTest() {
+	s.PersistentDBFile = s.tmpDir + "/test_persistent.db"
+	s.SetupSkippingDefs("testrules_switches.js")
+}
+
+func (s *RuleSwitchesSuite) TestInvalidSwitchable() {
+	s.engine.EvalScript("testInvalidSwitchable()")
+	s.Verify(
+		"[error] bad definition of rule '': invalid rule -- switchable rule must have a name",
+		"[error] bad definition of rule 'heating/night': invalid rule -- switchable rule name must not contain '/', '+' or '#'",
+		"[error] bad definition of rule 'lights': invalid rule -- switchable must be a boolean",
+	)
+	s.EnsureGotErrors()
+}
+
+func (s *RuleSwitchesSuite) TestRuleSwitches() {
+	s.publish("/devices/switchtest/controls/heat/on", "1", "switchtest/heat")
+	s.Verify(
+		"tst -> /devices/switchtest/controls/heat/on: [1] (QoS 1)",
+		"driver -> /devices/switchtest/controls/heat: [1] (QoS 1)",
+		"[info] heating rule fired",
+	)
+
+	s.publish("/devices/wbrules_switches/controls/heating/on", "0", "wbrules_switches/heating")
+	s.Verify(
+		"tst -> /devices/wbrules_switches/controls/heating/on: [0] (QoS 1)",
+		"driver -> /devices/wbrules_switches/controls/heating: [0] (QoS 1, retained)",
+		"[info] rule 'heating' is disabled by switch",
+	)
+	s.publish("/devices/switchtest/controls/heat/on", "1", "switchtest/heat")
+	s.Verify(
+		"tst -> /devices/switchtest/controls/heat/on: [1] (QoS 1)",
+		"driver -> /devices/switchtest/controls/heat: [1] (QoS 1)",
+	)
+
+	// disableRule() updates the switch
+	s.engine.EvalScript("disableVentilation()")
+	s.expectControlChange("wbrules_switches/ventilation")
+	s.Verify(
+		"driver -> /devices/wbrules_switches/controls/ventilation: [0] (QoS 1, retained)",
+	)
+}
+
+// the states of the rules are restored after restart
+func (s *RuleSwitchesSuite) TestRuleSwitchesRestored() {
+	s.publish("/devices/switchtest/controls/heat/on", "1", "switchtest/heat")
+	s.publish("/devices/switchtest/controls/vent/on", "1", "switchtest/vent")
+	s.Verify(
+		"tst -> /devices/switchtest/controls/heat/on: [1] (QoS 1)",
+		"driver -> /devices/switchtest/controls/heat: [1] (QoS 1)",
+		"tst -> /devices/switchtest/controls/vent/on: [1] (QoS 1)",
+		"driver -> /devices/switchtest/controls/vent: [1] (QoS 1)",
+	)
+
+	s.publish("/devices/wbrules_switches/controls/heating/on", "1", "wbrules_switches/heating")
+	s.Verify(
+		"tst -> /devices/wbrules_switches/controls/heating/on: [1] (QoS 1)",
+		"driver -> /devices/wbrules_switches/controls/heating: [1] (QoS 1, retained)",
+		"[info] rule 'heating' is enabled by switch",
+	)
+	s.publish("/devices/switchtest/controls/heat/on", "1", "switchtest/heat")
+	s.Verify(
+		"tst -> /devices/switchtest/controls/heat/on: [1] (QoS 1)",
+		"driver -> /devices/switchtest/controls/heat: [1] (QoS 1)",
+		"[info] heating rule fired",
+	)
+}
+
+func TestRuleSwitchesSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleSwitchesSuite),
+	)
+}
@@ -22,14 +22,15 @@ const (
 )
 
 type fakeCron struct {
-	t       *testing.T
-	started bool
-	entries map[string][]func()
-	lastID  cron.EntryID
+	t        *testing.T
+	location *time.Location
+	started  bool
+	entries  map[string][]func()
+	lastID   cron.EntryID
 }
 
-func newFakeCron(t *testing.T) *fakeCron {
-	return &fakeCron{t, false, make(map[string][]func()), 0}
+func newFakeCron(t *testing.T, loc *time.Location) *fakeCron {
+	return &fakeCron{t, loc, false, make(map[string][]func()), 0}
 }
 
 func (cron *fakeCron) AddFunc(spec string, cmd func()) (cron.EntryID, error) {
@@ -42,6 +43,13 @@ func (cron *fakeCron) AddFunc(spec string, cmd func()) (cron.EntryID, error) {
 	return cron.lastID, nil
 }
 
+// Schedule adds the entry that may be invoked using
+// the string representation of the schedule as the spec
+func (cron *fakeCron) Schedule(schedule cron.Schedule, cmd cron.Job) cron.EntryID {
+	id, _ := cron.AddFunc(fmt.Sprint(schedule), cmd.Run)
+	return id
+}
+
 func (cron *fakeCron) Remove(id cron.EntryID) {
 }
 
@@ -68,6 +76,25 @@ func (cron *fakeCron) invokeEntries(spec string) {
 	}
 }
 
+// fakeClock runs engine timers on the suite's fake timers
+// and cron rules on fakeCron
+type fakeClock struct {
+	s *RuleSuiteBase
+}
+
+func (c fakeClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c fakeClock) NewTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer {
+	return c.s.NewFakeTimerOrTicker(uint64(id), d, periodic)
+}
+
+func (c fakeClock) NewCron(loc *time.Location) Cron {
+	c.s.cron = newFakeCron(c.s.T(), loc)
+	return c.s.cron
+}
+
 type RuleSuiteBase struct {
 	testutils.Suite
 	*testutils.FakeMQTTFixture
@@ -87,7 +114,17 @@ type RuleSuiteBase struct {
 	PersistentDBFile string
 	VdevStorageFile  string
 	ModulesPath      string /* ':'-separated list */
+	Location         *GeoLocation
 	CleanUp          func()
+
+	CallbackBudget     time.Duration
+	CallbackViolations int
+
+	QuarantineErrors int
+	QuarantineWindow time.Duration
+
+	JSONLog bool
+	LogRing *LogRing
 }
 
 var logVerifyRx = regexp.MustCompile(`^\[(info|debug|warning|error)\] (.*)`)
@@ -259,17 +296,17 @@ func (s *RuleSuiteBase) SetupTest(waitForRetained bool, ruleFiles ...string) {
 	defaultModulesPath := filepath.Join(currentDir, "..", "modules")
 	moduleDirs := append(strings.Split(s.ModulesPath, ":"), defaultModulesPath)
 	engineOptions.SetModulesDirs(moduleDirs)
+	engineOptions.SetClock(fakeClock{s})
+	engineOptions.SetLocation(s.Location)
+	engineOptions.SetCallbackWatchdog(s.CallbackBudget, s.CallbackViolations)
+	engineOptions.SetScriptQuarantine(s.QuarantineErrors, s.QuarantineWindow)
+	engineOptions.SetJSONLog(s.JSONLog)
+	engineOptions.SetLogRing(s.LogRing)
 	s.logClient = s.Broker.MakeClient("wbrules-log")
 
 	s.engine, err = NewESEngine(s.driver, s.logClient, engineOptions)
 	s.Ck("NewESEngine()", err)
 
-	s.engine.SetTimerFunc(s.newFakeTimer)
-	s.engine.SetCronMaker(func() Cron {
-		s.cron = newFakeCron(s.T())
-		return s.cron
-	})
-
 	s.controlChange = s.engine.SubscribeControlChange()
 	s.DataFileFixture = testutils.NewDataFileFixture(s.T())
 	s.FakeTimerFixture = testutils.NewFakeTimerFixture(s.T(), s.Recorder)
@@ -336,10 +373,6 @@ func (s *RuleSuiteBase) SetupSkippingDefs(ruleFiles ...string) {
 	}
 }
 
-func (s *RuleSuiteBase) newFakeTimer(id TimerId, d time.Duration, periodic bool) wbgong.Timer {
-	return s.NewFakeTimerOrTicker(uint64(id), d, periodic)
-}
-
 func (s *RuleSuiteBase) publish(topic, value string, expectedCellNames ...string) {
 	retained := !strings.HasSuffix(topic, "/on")
 	wbgong.Debug.Printf("publishing %s to %s, expecting change of %v", value, topic, expectedCellNames)
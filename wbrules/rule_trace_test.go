@@ -0,0 +1,218 @@
+package wbrules
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/objx"
+	"github.com/stretchr/testify/assert"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleTraceSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleTraceSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_trace.js")
+}
+
+func (s *RuleTraceSuite) lastTraceEntry(name string) (entry RuleTraceEntry) {
+	s.WaitFor(func() bool {
+		traces := s.engine.RuleTraces(name)
+		if len(traces) != 1 || len(traces[0].Entries) == 0 {
+			return false
+		}
+		entries := traces[0].Entries
+		entry = entries[len(entries)-1]
+		return entry.Control == "somedev/temp"
+	})
+	return
+}
+
+func (s *RuleTraceSuite) TestTrace() {
+	s.publish("/devices/somedev/controls/temp", "25", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [25] (QoS 1, retained)",
+		"[info] temp: 25",
+	)
+
+	traces := s.engine.RuleTraces("traceTemp")
+	s.Require().Len(traces, 1)
+	s.Equal("traceTemp", traces[0].Name)
+	s.Equal("testrules_trace.js", traces[0].Script)
+
+	entry := s.lastTraceEntry("traceTemp")
+	s.Equal(RULE_TRACE_TRIGGER_CONTROL, entry.Trigger)
+	s.True(entry.CondResult)
+	s.True(entry.Fired)
+	s.Nil(entry.Error)
+
+	entry = s.lastTraceEntry("traceNever")
+	s.False(entry.CondResult)
+	s.False(entry.Fired)
+
+	s.publish("/devices/somedev/controls/temp", "42", "somedev/temp")
+	s.Verify(
+		"tst -> /devices/somedev/controls/temp: [42] (QoS 1, retained)",
+		regexp.MustCompile(`(?s:ECMAScript error:.*too hot.*)`),
+	)
+	s.EnsureGotErrors()
+
+	s.WaitFor(func() bool {
+		return s.lastTraceEntry("traceTemp").Error != nil
+	})
+	entry = s.lastTraceEntry("traceTemp")
+	s.True(entry.Fired)
+	s.Contains(entry.Error.Message, "too hot")
+	s.Contains(entry.Error.Traceback, LocItem{7, "testrules_trace.js"})
+
+	s.Empty(s.engine.RuleTraces("noSuchRule"))
+}
+
+type RulesRpcSuite struct {
+	testutils.Suite
+	*testutils.RpcFixture
+	journalDisabled bool
+	replayRequest   *ReplayRequest
+}
+
+func (s *RulesRpcSuite) T() *testing.T {
+	return s.Suite.T()
+}
+
+func (s *RulesRpcSuite) SetupTest() {
+	s.Suite.SetupTest()
+	s.RpcFixture = testutils.NewRpcFixture(
+		s.T(), "wbrules", "Rules", "wbrules",
+		NewRules(s, true),
+		"Trace", "Replay")
+}
+
+func (s *RulesRpcSuite) TearDownTest() {
+	s.TearDownRPC()
+	s.Suite.TearDownTest()
+}
+
+func (s *RulesRpcSuite) RuleTraces(name string) []RuleTraceInfo {
+	if name != "" && name != "sample" {
+		return []RuleTraceInfo{}
+	}
+	return []RuleTraceInfo{
+		{
+			Id:     1,
+			Name:   "sample",
+			Script: "sample.js",
+			Entries: []RuleTraceEntry{
+				{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "t1", CondResult: true, Fired: true, DurationUs: 10},
+				{Trigger: RULE_TRACE_TRIGGER_CONTROL, Control: "somedev/temp", Value: 42, DurationUs: 5},
+			},
+		},
+	}
+}
+
+func (s *RulesRpcSuite) ReplayEvents(req *ReplayRequest) (*ReplayResult, error) {
+	if s.journalDisabled {
+		return nil, errJournalDisabled
+	}
+	s.replayRequest = req
+	return &ReplayResult{
+		Events: 2,
+		Output: []string{"[00:00:00.000] input /devices/somedev/temp: 42", "[00:00:00.000] log [info] temp: 42"},
+	}, nil
+}
+
+func (s *RulesRpcSuite) TestTrace() {
+	s.VerifyRpc("Trace", objx.Map{"name": "sample", "limit": 1}, []objx.Map{
+		{
+			"id":     1,
+			"name":   "sample",
+			"script": "sample.js",
+			"entries": []objx.Map{
+				{
+					"timestamp":  "0001-01-01T00:00:00Z",
+					"trigger":    "control",
+					"control":    "somedev/temp",
+					"value":      42,
+					"condResult": false,
+					"fired":      false,
+					"durationUs": 5,
+				},
+			},
+		},
+	})
+}
+
+func (s *RulesRpcSuite) TestTraceUnknownRule() {
+	s.VerifyRpcError("Trace", objx.Map{"name": "foobar"},
+		RULES_ERROR_RULE_NOT_FOUND, "RulesError", "Rule not found")
+}
+
+func (s *RulesRpcSuite) TestReplay() {
+	s.VerifyRpc("Replay", objx.Map{
+		"from":    "2026-03-01T10:00:00Z",
+		"to":      "2026-03-01T12:30:00+01:00",
+		"scripts": []string{"sample.js"},
+	}, objx.Map{
+		"events": 2,
+		"output": []string{"[00:00:00.000] input /devices/somedev/temp: 42", "[00:00:00.000] log [info] temp: 42"},
+	})
+	s.Require().NotNil(s.replayRequest)
+	s.Equal(time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), s.replayRequest.From.UTC())
+	s.Equal(time.Date(2026, 3, 1, 11, 30, 0, 0, time.UTC), s.replayRequest.To.UTC())
+	s.Equal([]string{"sample.js"}, s.replayRequest.Scripts)
+	s.False(s.replayRequest.IncludeLocal)
+}
+
+func (s *RulesRpcSuite) TestReplayInvalidTimeRange() {
+	s.VerifyRpcError("Replay", objx.Map{"from": "2026-03-01T10:00:00Z", "to": "2026-03-01T10:00:00Z"},
+		RULES_ERROR_INVALID_TIME_RANGE, "RulesError", "Invalid time range")
+	s.VerifyRpcError("Replay", objx.Map{"from": "yesterday", "to": "2026-03-01T10:00:00Z"},
+		RULES_ERROR_INVALID_TIME_RANGE, "RulesError", "Invalid time range")
+	s.Nil(s.replayRequest)
+}
+
+func (s *RulesRpcSuite) TestReplayJournalDisabled() {
+	s.journalDisabled = true
+	s.VerifyRpcError("Replay", objx.Map{"from": "2026-03-01T10:00:00Z", "to": "2026-03-01T11:00:00Z"},
+		RULES_ERROR_JOURNAL_DISABLED, "RulesError", "Event journal is disabled")
+}
+
+func (s *RulesRpcSuite) TestReplayDisabled() {
+	var result ReplayResult
+	s.Equal(replayDisabledError, NewRules(s, false).Replay(&RulesReplayArgs{
+		From: "2026-03-01T10:00:00Z",
+		To:   "2026-03-01T11:00:00Z",
+	}, &result))
+	s.Nil(s.replayRequest)
+}
+
+func TestRuleTraceRing(t *testing.T) {
+	trace := NewRuleTrace(3)
+	assert.Empty(t, trace.Entries())
+
+	for _, timer := range []string{"a", "b"} {
+		trace.Push(RuleTraceEntry{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: timer})
+	}
+	assert.Equal(t, []RuleTraceEntry{
+		{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "a"},
+		{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "b"},
+	}, trace.Entries())
+
+	for _, timer := range []string{"c", "d", "e"} {
+		trace.Push(RuleTraceEntry{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: timer})
+	}
+	assert.Equal(t, []RuleTraceEntry{
+		{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "c"},
+		{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "d"},
+		{Trigger: RULE_TRACE_TRIGGER_TIMER, Timer: "e"},
+	}, trace.Entries())
+}
+
+func TestRuleTraceSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleTraceSuite),
+		new(RulesRpcSuite),
+	)
+}
@@ -0,0 +1,59 @@
+package wbrules
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type RuleWatchdogSuite struct {
+	RuleSuiteBase
+}
+
+func (s *RuleWatchdogSuite) SetupTest() {
+	s.CallbackBudget = 100 * time.Millisecond
+	s.CallbackViolations = 2
+	s.SetupSkippingDefs("testrules_watchdog.js")
+}
+
+func (s *RuleWatchdogSuite) pressLoop() {
+	s.publish("/devices/wdtest/controls/loop/on", "1", "wdtest/loop")
+	s.Verify(
+		"tst -> /devices/wdtest/controls/loop/on: [1] (QoS 1)",
+		"driver -> /devices/wdtest/controls/loop: [1] (QoS 1)",
+		"[info] busy loop started",
+		regexp.MustCompile(`(?s:ECMAScript error:.*RangeError.*)`),
+		regexp.MustCompile(`^\[error\] callback of rule 'busyLoop' \(testrules_watchdog\.js\): `+
+			`execution time limit of 100ms exceeded \(\d+ms\), interrupted at testrules_watchdog\.js:18`),
+	)
+}
+
+func (s *RuleWatchdogSuite) TestWatchdog() {
+	s.pressLoop()
+
+	// the engine is not blocked by the loop
+	s.publish("/devices/wdtest/controls/quick/on", "1", "wdtest/quick")
+	s.Verify(
+		"tst -> /devices/wdtest/controls/quick/on: [1] (QoS 1)",
+		"driver -> /devices/wdtest/controls/quick: [1] (QoS 1)",
+		"[info] quick rule fired",
+	)
+
+	s.pressLoop()
+	s.Verify("[error] rule 'busyLoop' is disabled after 2 execution time limit violations")
+
+	s.publish("/devices/wdtest/controls/loop/on", "1", "wdtest/loop")
+	s.Verify(
+		"tst -> /devices/wdtest/controls/loop/on: [1] (QoS 1)",
+		"driver -> /devices/wdtest/controls/loop: [1] (QoS 1)",
+	)
+	s.EnsureGotErrors()
+}
+
+func TestRuleWatchdogSuite(t *testing.T) {
+	testutils.RunSuites(t,
+		new(RuleWatchdogSuite),
+	)
+}
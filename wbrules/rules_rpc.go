@@ -0,0 +1,124 @@
+package wbrules
+
+import (
+	"errors"
+	"time"
+)
+
+// RuleTraceSource provides access to rule execution traces
+type RuleTraceSource interface {
+	RuleTraces(name string) []RuleTraceInfo
+}
+
+// RulesSource is the engine side of the Rules service
+type RulesSource interface {
+	RuleTraceSource
+	EventReplayer
+}
+
+type Rules struct {
+	source   RulesSource
+	writable bool
+}
+
+type RulesError struct {
+	code    int32
+	message string
+}
+
+func (err *RulesError) Error() string {
+	return err.message
+}
+
+func (err *RulesError) ErrorCode() int32 {
+	return err.code
+}
+
+const (
+	// no iota here because these values may be used
+	// by external software
+	RULES_ERROR_RULE_NOT_FOUND     = 1100
+	RULES_ERROR_JOURNAL_DISABLED   = 1101
+	RULES_ERROR_INVALID_TIME_RANGE = 1102
+	RULES_ERROR_REPLAY_FAILED      = 1103
+	RULES_ERROR_REPLAY_DISABLED    = 1104
+)
+
+var (
+	ruleNotFoundError     = &RulesError{RULES_ERROR_RULE_NOT_FOUND, "Rule not found"}
+	journalDisabledError  = &RulesError{RULES_ERROR_JOURNAL_DISABLED, "Event journal is disabled"}
+	invalidTimeRangeError = &RulesError{RULES_ERROR_INVALID_TIME_RANGE, "Invalid time range"}
+	replayDisabledError   = &RulesError{RULES_ERROR_REPLAY_DISABLED, "Replay is disabled"}
+)
+
+// NewRules creates the rules service. Unless writable is set,
+// Replay, which runs the scripts, fails
+func NewRules(source RulesSource, writable bool) *Rules {
+	return &Rules{source, writable}
+}
+
+type RulesTraceArgs struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+}
+
+// Trace returns execution traces of all rules or of the rules
+// with the specified name. If limit is set, only last limit
+// entries are returned for every rule
+func (rules *Rules) Trace(args *RulesTraceArgs, reply *[]RuleTraceInfo) error {
+	traces := rules.source.RuleTraces(args.Name)
+	if args.Name != "" && len(traces) == 0 {
+		return ruleNotFoundError
+	}
+
+	if args.Limit > 0 {
+		for i := range traces {
+			if n := len(traces[i].Entries); n > args.Limit {
+				traces[i].Entries = traces[i].Entries[n-args.Limit:]
+			}
+		}
+	}
+
+	*reply = traces
+	return nil
+}
+
+type RulesReplayArgs struct {
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Scripts      []string `json:"scripts"`
+	IncludeLocal bool     `json:"includeLocal"`
+}
+
+// Replay runs the scripts in an isolated engine against the control
+// change events recorded in the event journal between from and to
+// (RFC 3339 timestamps) and returns the log of the run
+func (rules *Rules) Replay(args *RulesReplayArgs, reply *ReplayResult) error {
+	if !rules.writable {
+		return replayDisabledError
+	}
+	from, err := time.Parse(time.RFC3339, args.From)
+	if err != nil {
+		return invalidTimeRangeError
+	}
+	to, err := time.Parse(time.RFC3339, args.To)
+	if err != nil || !from.Before(to) {
+		return invalidTimeRangeError
+	}
+
+	result, err := rules.source.ReplayEvents(&ReplayRequest{
+		From:         from,
+		To:           to,
+		Scripts:      args.Scripts,
+		IncludeLocal: args.IncludeLocal,
+	})
+	switch {
+	case errors.Is(err, errJournalDisabled):
+		return journalDisabledError
+	case err != nil:
+		return &RulesError{RULES_ERROR_REPLAY_FAILED, err.Error()}
+	}
+
+	*reply = *result
+	return nil
+}
@@ -8,7 +8,15 @@ const (
 )
 
 type CleanupFunc func()
-type cleanupMap map[string][]CleanupFunc
+
+// cleanupEntry is either a cleanup function
+// or a child scope whose cleanups are run
+type cleanupEntry struct {
+	fn    CleanupFunc
+	child string
+}
+
+type cleanupMap map[string][]cleanupEntry
 
 // ScopedCleanup manages a list of cleanup functions
 // that must be invoked when some named scope ceases
@@ -17,32 +25,83 @@ type cleanupMap map[string][]CleanupFunc
 type ScopedCleanup struct {
 	cleanupLists cleanupMap
 	scopeStack   []string
+	// parents maps child scopes to their parent scopes
+	parents map[string]string
 }
 
 func MakeScopedCleanup() *ScopedCleanup {
 	return &ScopedCleanup{
 		make(cleanupMap),
 		make([]string, 0, SCOPE_STACK_CAPACITY),
+		make(map[string]string),
 	}
 }
 
+// within checks whether the scope is the parent scope itself
+// or its (possibly indirect) child
+func (sc *ScopedCleanup) within(scope, parent string) bool {
+	for ; scope != ""; scope = sc.parents[scope] {
+		if scope == parent {
+			return true
+		}
+	}
+	return false
+}
+
+// PushCleanupScope makes the scope current. If the current scope
+// is a child of the pushed one, the child scope stays current,
+// so the cleanups are still added to the child scope.
+// The scope that becomes current is returned
 func (sc *ScopedCleanup) PushCleanupScope(scope string) string {
 	if scope == "" {
 		panic("trying to push an empty scope")
 	}
+	if top := len(sc.scopeStack) - 1; top >= 0 && sc.within(sc.scopeStack[top], scope) {
+		scope = sc.scopeStack[top]
+	}
 	sc.scopeStack = append(sc.scopeStack, scope)
 	return scope
 }
 
 func (sc *ScopedCleanup) PopCleanupScope(scope string) string {
 	top := len(sc.scopeStack) - 1
-	if top < 0 || sc.scopeStack[top] != scope {
+	if top < 0 || !sc.within(sc.scopeStack[top], scope) {
 		panic("scoped cleanup stack error")
 	}
+	scope = sc.scopeStack[top]
 	sc.scopeStack = sc.scopeStack[:top]
 	return scope
 }
 
+// AddChildScope makes the child scope a part of the parent one.
+// The cleanups of the child scope run along with the cleanups
+// of the parent scope but can also be run separately
+func (sc *ScopedCleanup) AddChildScope(parent, child string) {
+	if parent == "" || child == "" || parent == child {
+		panic("bad child cleanup scope")
+	}
+	sc.parents[child] = parent
+	sc.cleanupLists[parent] = append(sc.cleanupLists[parent], cleanupEntry{child: child})
+}
+
+// removeChildScope removes the child scope from the cleanup list
+// of its parent, so the list doesn't grow when the child scopes
+// are created and run separately many times
+func (sc *ScopedCleanup) removeChildScope(parent, child string) {
+	l, found := sc.cleanupLists[parent]
+	if !found {
+		return
+	}
+	// the list may be being run, so it's not modified in place
+	filtered := make([]cleanupEntry, 0, len(l))
+	for _, entry := range l {
+		if entry.child != child {
+			filtered = append(filtered, entry)
+		}
+	}
+	sc.cleanupLists[parent] = filtered
+}
+
 func (sc *ScopedCleanup) AddCleanup(cleanupFn CleanupFunc) {
 	if len(sc.scopeStack) == 0 {
 		wbgong.Debug.Printf("global scope, cleanup will not run")
@@ -51,19 +110,27 @@ func (sc *ScopedCleanup) AddCleanup(cleanupFn CleanupFunc) {
 	scope := sc.scopeStack[len(sc.scopeStack)-1]
 	l, found := sc.cleanupLists[scope]
 	if !found {
-		l = make([]CleanupFunc, 0, CLEANUP_LIST_CAPACITY)
+		l = make([]cleanupEntry, 0, CLEANUP_LIST_CAPACITY)
 	}
-	sc.cleanupLists[scope] = append(l, cleanupFn)
+	sc.cleanupLists[scope] = append(l, cleanupEntry{fn: cleanupFn})
 }
 
 func (sc *ScopedCleanup) RunCleanups(scope string) {
+	if parent, found := sc.parents[scope]; found {
+		delete(sc.parents, scope)
+		sc.removeChildScope(parent, scope)
+	}
 	l, found := sc.cleanupLists[scope]
 	if !found {
 		return
 	}
 	defer delete(sc.cleanupLists, scope)
-	for _, cleanupFn := range l {
-		cleanupFn()
+	for _, entry := range l {
+		if entry.child != "" {
+			sc.RunCleanups(entry.child)
+		} else {
+			entry.fn()
+		}
 	}
 }
 
@@ -0,0 +1,417 @@
+package wbrules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wirenboard/wbgong"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	SIM_DRIVER_ID        = "wb-rules"
+	SIM_DRIVER_CLIENT_ID = "rules"
+	SIM_ENGINE_CLIENT_ID = "wb-rules-engine"
+	SIM_INPUT_CLIENT_ID  = "simulator"
+
+	SIM_READY_TIMEOUT = 10 * time.Second
+
+	// the simulator considers the engine idle after this many
+	// consecutive checks without any activity
+	SIM_SETTLE_QUIET_ROUNDS = 3
+	SIM_SETTLE_INTERVAL     = 5 * time.Millisecond
+)
+
+var errSimTimeout = errors.New("simulation time limit exceeded")
+
+// SimEvent is a single step of a simulation script. Every event
+// advances virtual time and then publishes a control value
+// or an arbitrary MQTT message (if any)
+type SimEvent struct {
+	// At is the time of the event relative to the start of simulation
+	At string `yaml:"at"`
+	// After is the time of the event relative to the previous one
+	After string `yaml:"after"`
+
+	// Control is "device/control" to publish the value to. The value
+	// is published to the control topic (as an external device would
+	// do) or to its /on subtopic if On is set
+	Control string `yaml:"control"`
+	Type    string `yaml:"type"`
+	Value   any    `yaml:"value"`
+	On      bool   `yaml:"on"`
+
+	// Topic, Payload and Retain describe a raw MQTT message
+	Topic   string `yaml:"topic"`
+	Payload string `yaml:"payload"`
+	Retain  bool   `yaml:"retain"`
+}
+
+// SimScript is a simulation script. It may be written in YAML or JSON
+type SimScript struct {
+	// Start is the initial virtual time in RFC3339 format
+	Start string `yaml:"start"`
+	// Duration is the total duration of simulation. If it's not
+	// set, simulation stops after the last event
+	Duration string     `yaml:"duration"`
+	Events   []SimEvent `yaml:"events"`
+}
+
+func ParseSimScript(data []byte) (*SimScript, error) {
+	var script SimScript
+	// JSON is a subset of YAML, so there's no need to parse it separately
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, fmt.Errorf("invalid simulation script: %v", err)
+	}
+	return &script, nil
+}
+
+func LoadSimScript(path string) (*SimScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSimScript(data)
+}
+
+// StartTime returns the initial virtual time of the script
+func (script *SimScript) StartTime() (time.Time, error) {
+	if script.Start == "" {
+		return time.Now().Truncate(time.Second), nil
+	}
+	t, err := time.Parse(time.RFC3339, script.Start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid start time: %q", script.Start)
+	}
+	return t, nil
+}
+
+// offsets returns times of the script events
+// relative to the start of simulation
+func (script *SimScript) offsets() ([]time.Duration, error) {
+	r := make([]time.Duration, len(script.Events))
+	var prev time.Duration
+	for i, ev := range script.Events {
+		var err error
+		switch {
+		case ev.At != "" && ev.After != "":
+			return nil, fmt.Errorf("event %d: both 'at' and 'after' are specified", i)
+		case ev.At != "":
+			r[i], err = ParseDuration(ev.At)
+		case ev.After != "":
+			r[i], err = ParseDuration(ev.After)
+			r[i] += prev
+		default:
+			r[i] = prev
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %v", i, err)
+		}
+		if r[i] < prev {
+			return nil, fmt.Errorf("event %d: events must be ordered by time", i)
+		}
+		if ev.Control != "" && ev.Topic != "" {
+			return nil, fmt.Errorf("event %d: both 'control' and 'topic' are specified", i)
+		}
+		if ev.Control != "" && len(strings.Split(ev.Control, "/")) != 2 {
+			return nil, fmt.Errorf("event %d: control must be specified as device/control", i)
+		}
+		prev = r[i]
+	}
+	return r, nil
+}
+
+func simPayload(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// messages returns MQTT messages to be published for the event
+func (ev *SimEvent) messages() []wbgong.MQTTMessage {
+	if ev.Topic != "" {
+		return []wbgong.MQTTMessage{{Topic: ev.Topic, Payload: ev.Payload, QoS: 1, Retained: ev.Retain}}
+	}
+	if ev.Control == "" {
+		return nil
+	}
+
+	parts := strings.Split(ev.Control, "/")
+	topic := fmt.Sprintf("/devices/%s/controls/%s", parts[0], parts[1])
+	var r []wbgong.MQTTMessage
+	if ev.Type != "" {
+		r = append(r, wbgong.MQTTMessage{Topic: topic + "/meta/type", Payload: ev.Type, QoS: 1, Retained: true})
+	}
+	if ev.On {
+		return append(r, wbgong.MQTTMessage{Topic: topic + "/on", Payload: simPayload(ev.Value), QoS: 1})
+	}
+	return append(r, wbgong.MQTTMessage{Topic: topic, Payload: simPayload(ev.Value), QoS: 1, Retained: true})
+}
+
+// Simulator runs rule scripts on an in-memory MQTT broker
+// in virtual time and reports everything they do
+type Simulator struct {
+	out    io.Writer
+	outMtx sync.Mutex
+
+	broker *MemMQTTBroker
+	input  *MemMQTTClient
+	clock  *VirtualClock
+	driver wbgong.Driver
+	engine *ESEngine
+	start  time.Time
+
+	controlChange <-chan *ControlChangeEvent
+	changes       uint64
+	changesMtx    sync.Mutex
+	done          chan struct{}
+
+	// simulation fails with errSimTimeout
+	// after the deadline (if it's set)
+	deadline time.Time
+}
+
+// NewSimulator creates the driver and the engine for simulation.
+// Persistent storage file must be set in engineOptions
+func NewSimulator(out io.Writer, start time.Time, engineOptions *ESEngineOptions) (sim *Simulator, err error) {
+	sim = &Simulator{
+		out:    out,
+		broker: NewMemMQTTBroker(),
+		clock:  NewVirtualClock(start),
+		start:  start,
+		done:   make(chan struct{}),
+	}
+	sim.input = sim.broker.MakeClient(SIM_INPUT_CLIENT_ID)
+	sim.input.Start()
+	sim.broker.OnPublish(sim.onPublish)
+
+	driverArgs := wbgong.NewDriverArgs().
+		SetId(SIM_DRIVER_ID).
+		SetMqtt(sim.broker.MakeClient(SIM_DRIVER_CLIENT_ID)).
+		SetUseStorage(false).
+		SetReownUnknownDevices(true).
+		SetTesting()
+	if sim.driver, err = wbgong.NewDriverBase(driverArgs); err != nil {
+		return nil, fmt.Errorf("error creating driver: %v", err)
+	}
+	if err = sim.driver.StartLoop(); err != nil {
+		return nil, fmt.Errorf("error starting the driver: %v", err)
+	}
+	sim.driver.WaitForReady()
+	sim.driver.SetFilter(&wbgong.AllDevicesFilter{})
+
+	engineOptions.SetClock(sim.clock)
+	engineOptions.SetExportMetrics(false)
+	// simulated scripts must not run commands, send
+	// notifications or make HTTP requests for real
+	engineOptions.SetSpawn(sim.spawn)
+	sim.engine, err = NewESEngine(sim.driver, sim.broker.MakeClient(SIM_ENGINE_CLIENT_ID), engineOptions)
+	if err != nil {
+		sim.driver.StopLoop()
+		return nil, fmt.Errorf("error creating engine: %v", err)
+	}
+	sim.controlChange = sim.engine.SubscribeControlChange()
+	go sim.watchControlChanges()
+	sim.engine.Start()
+
+	return sim, nil
+}
+
+func (sim *Simulator) printf(format string, args ...any) {
+	sim.outMtx.Lock()
+	defer sim.outMtx.Unlock()
+	elapsed := sim.clock.Now().Sub(sim.start)
+	fmt.Fprintf(sim.out, "[%s] %s\n", formatSimTime(elapsed), fmt.Sprintf(format, args...))
+}
+
+// SetDeadline limits the real time the simulation may take
+func (sim *Simulator) SetDeadline(deadline time.Time) {
+	sim.deadline = deadline
+}
+
+func (sim *Simulator) expired() bool {
+	return !sim.deadline.IsZero() && time.Now().After(sim.deadline)
+}
+
+// spawn reports external commands instead of running them.
+// The commands succeed without any output
+func (sim *Simulator) spawn(name string, args []string, captureOutput bool, captureErrorOutput bool, input *string) (*CommandResult, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	if input != nil {
+		sim.printf("spawn %s (input: %q)", cmd, *input)
+	} else {
+		sim.printf("spawn %s", cmd)
+	}
+	return &CommandResult{}, nil
+}
+
+func formatSimTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func (sim *Simulator) onPublish(clientId string, msg wbgong.MQTTMessage) {
+	if clientId == SIM_INPUT_CLIENT_ID {
+		return
+	}
+	if level, found := strings.CutPrefix(msg.Topic, ENGINE_LOG_TOPIC_BASE); found {
+		sim.printf("log [%s] %s", level, msg.Payload)
+		return
+	}
+	retained := ""
+	if msg.Retained {
+		retained = " (retained)"
+	}
+	sim.printf("publish %s: %s%s", msg.Topic, msg.Payload, retained)
+}
+
+func (sim *Simulator) watchControlChanges() {
+	for {
+		select {
+		case e := <-sim.controlChange:
+			sim.changesMtx.Lock()
+			sim.changes++
+			sim.changesMtx.Unlock()
+			if strings.Contains(e.Spec.ControlId, "#") {
+				// meta change
+				continue
+			}
+			sim.printf("change %s: %v -> %v", e.Spec, e.PrevValue, e.Value)
+		case <-sim.done:
+			return
+		}
+	}
+}
+
+func (sim *Simulator) activity() uint64 {
+	sim.changesMtx.Lock()
+	defer sim.changesMtx.Unlock()
+	return sim.broker.Delivered() + sim.clock.Fired() + sim.changes
+}
+
+func (sim *Simulator) syncBarrier() {
+	done := make(chan struct{})
+	sim.engine.CallSync(func() {
+		close(done)
+	})
+	<-done
+}
+
+// settle waits until the engine handles all pending messages,
+// control changes and timer events
+func (sim *Simulator) settle() {
+	for quiet := 0; quiet < SIM_SETTLE_QUIET_ROUNDS; {
+		before := sim.activity()
+		sim.syncBarrier()
+		time.Sleep(SIM_SETTLE_INTERVAL)
+		if sim.activity() == before && sim.broker.Idle() && sim.engine.eventBuffer.length() == 0 {
+			quiet++
+		} else {
+			quiet = 0
+		}
+	}
+}
+
+// LoadScripts loads script files and directories
+// and waits for the engine to become ready
+func (sim *Simulator) LoadScripts(paths []string) error {
+	var files []string
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, ".js") && !strings.HasPrefix(d.Name(), ".") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(files) == 0 {
+		return errors.New("no scripts found")
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if err := sim.engine.LoadFile(file); err != nil {
+			sim.printf("error loading %s: %v", file, err)
+		}
+	}
+
+	select {
+	case <-sim.engine.ReadyCh():
+	case <-time.After(SIM_READY_TIMEOUT):
+		return errors.New("engine is not ready")
+	}
+	sim.settle()
+	return nil
+}
+
+func (sim *Simulator) advanceTo(offset time.Duration) error {
+	if d := offset - sim.clock.Now().Sub(sim.start); d > 0 {
+		sim.clock.Advance(d, func() bool {
+			sim.settle()
+			return !sim.expired()
+		})
+	}
+	if sim.expired() {
+		return errSimTimeout
+	}
+	return nil
+}
+
+// Run runs the simulation script
+func (sim *Simulator) Run(script *SimScript) error {
+	offsets, err := script.offsets()
+	if err != nil {
+		return err
+	}
+	var duration time.Duration
+	if script.Duration != "" {
+		if duration, err = ParseDuration(script.Duration); err != nil {
+			return err
+		}
+	}
+
+	for i, ev := range script.Events {
+		if err := sim.advanceTo(offsets[i]); err != nil {
+			return err
+		}
+		for _, msg := range ev.messages() {
+			sim.printf("input %s: %s", msg.Topic, msg.Payload)
+			sim.input.Publish(msg)
+		}
+		sim.settle()
+	}
+	return sim.advanceTo(duration)
+}
+
+func (sim *Simulator) Stop() {
+	sim.engine.Stop()
+	close(sim.done)
+	sim.engine.ClosePersistentDB()
+	sim.engine.Destroy()
+	sim.driver.StopLoop()
+	sim.driver.Close()
+}
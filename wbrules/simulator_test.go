@@ -0,0 +1,379 @@
+package wbrules
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	_ "time/tzdata" // DST tests need time zone database
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong"
+)
+
+func TestMqttTopicMatch(t *testing.T) {
+	for _, c := range []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"/devices/a/controls/b", "/devices/a/controls/b", true},
+		{"/devices/a/controls/b", "/devices/a/controls/c", false},
+		{"/devices/+/controls/+", "/devices/a/controls/b", true},
+		{"/devices/+/controls/+", "/devices/a/controls/b/on", false},
+		{"/devices/#", "/devices/a/controls/b/meta/type", true},
+		{"/devices/+/meta/#", "/devices/a/meta", true},
+		{"/devices/+", "/devices", false},
+		{"#", "/wbrules/log/info", true},
+	} {
+		assert.Equal(t, c.match, mqttTopicMatch(c.pattern, c.topic), "%s %s", c.pattern, c.topic)
+	}
+}
+
+func TestMemMQTTBroker(t *testing.T) {
+	broker := NewMemMQTTBroker()
+	var published []string
+	broker.OnPublish(func(clientId string, msg wbgong.MQTTMessage) {
+		published = append(published, clientId+" -> "+msg.Topic+": "+msg.Payload)
+	})
+
+	pub := broker.MakeClient("pub")
+	pub.Start()
+	pub.Publish(wbgong.MQTTMessage{Topic: "/a/b", Payload: "1", Retained: true})
+	pub.Publish(wbgong.MQTTMessage{Topic: "/a/c", Payload: "2", Retained: true})
+	pub.Publish(wbgong.MQTTMessage{Topic: "/a/c", Payload: "", Retained: true})
+	pub.Publish(wbgong.MQTTMessage{Topic: "/a/d", Payload: "3"})
+
+	var mtx sync.Mutex
+	var received []wbgong.MQTTMessage
+	sub := broker.MakeClient("sub")
+	sub.Start()
+	sub.Subscribe(func(msg wbgong.MQTTMessage) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, msg)
+	}, "/a/+")
+	pub.Publish(wbgong.MQTTMessage{Topic: "/a/e", Payload: "4", Retained: true})
+	pub.Publish(wbgong.MQTTMessage{Topic: "/b/e", Payload: "5"})
+
+	for !broker.Idle() {
+		time.Sleep(time.Millisecond)
+	}
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, []wbgong.MQTTMessage{
+		{Topic: "/a/b", Payload: "1", Retained: true},
+		{Topic: "/a/e", Payload: "4", Retained: false},
+	}, received)
+	assert.Equal(t, uint64(2), broker.Delivered())
+	assert.Equal(t, []string{
+		"pub -> /a/b: 1",
+		"pub -> /a/c: 2",
+		"pub -> /a/c: ",
+		"pub -> /a/d: 3",
+		"pub -> /a/e: 4",
+		"pub -> /b/e: 5",
+	}, published)
+}
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+
+	var fired []string
+	watch := func(name string, timer wbgong.Timer) func() {
+		return func() {
+			select {
+			case ts := <-timer.GetChannel():
+				fired = append(fired, name+"@"+ts.Sub(start).String())
+			default:
+			}
+		}
+	}
+
+	oneShot := clock.NewTimer(1, 3*time.Second, false)
+	ticker := clock.NewTimer(2, 2*time.Second, true)
+	stopped := clock.NewTimer(3, time.Second, false)
+	stopped.Stop()
+
+	settle := func() bool {
+		watch("oneShot", oneShot)()
+		watch("ticker", ticker)()
+		return true
+	}
+	clock.Advance(5*time.Second, settle)
+	assert.Equal(t, []string{"ticker@2s", "oneShot@3s", "ticker@4s"}, fired)
+	assert.Equal(t, start.Add(5*time.Second), clock.Now())
+	assert.Equal(t, uint64(3), clock.Fired())
+
+	ticker.Stop()
+	clock.Advance(time.Minute, settle)
+	assert.Equal(t, uint64(3), clock.Fired())
+
+	// advancing stops when settle returns false
+	ticker = clock.NewTimer(4, time.Second, true)
+	clock.Advance(time.Minute, func() bool { return false })
+	assert.Equal(t, start.Add(66*time.Second), clock.Now())
+	assert.Equal(t, uint64(4), clock.Fired())
+	ticker.Stop()
+}
+
+func TestVirtualCron(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	c := clock.NewCron(time.UTC)
+
+	var fired []string
+	_, err := c.AddFunc("@every 20m", func() {
+		fired = append(fired, "every20m@"+clock.Now().Format("15:04"))
+	})
+	require.NoError(t, err)
+	hourly, err := c.AddFunc("0 0 * * * *", func() {
+		fired = append(fired, "hourly@"+clock.Now().Format("15:04"))
+	})
+	require.NoError(t, err)
+	_, err = c.AddFunc("bad spec", func() {})
+	assert.Error(t, err)
+
+	clock.Advance(time.Hour, nil)
+	assert.Empty(t, fired, "cron is not started")
+
+	c.Start()
+	clock.Advance(time.Hour, nil)
+	assert.Equal(t, []string{"every20m@01:20", "every20m@01:40", "hourly@02:00", "every20m@02:00"}, fired)
+
+	c.Remove(hourly)
+	fired = nil
+	clock.Advance(time.Hour, nil)
+	assert.Equal(t, []string{"every20m@02:20", "every20m@02:40", "every20m@03:00"}, fired)
+
+	c.Stop()
+	fired = nil
+	clock.Advance(time.Hour, nil)
+	assert.Empty(t, fired)
+}
+
+func TestVirtualCronTimezone(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewVirtualClock(start)
+	c := clock.NewCron(moscow)
+
+	var fired []string
+	for _, spec := range []string{"0 0 9 * * *", "CRON_TZ=UTC 0 0 9 * * *", "TZ=Asia/Tokyo 0 0 9 * * *"} {
+		spec := spec
+		_, err := c.AddFunc(spec, func() {
+			fired = append(fired, spec+"@"+clock.Now().UTC().Format("01-02 15:04"))
+		})
+		require.NoError(t, err)
+	}
+	c.Start()
+	clock.Advance(24*time.Hour, nil)
+	assert.Equal(t, []string{
+		"0 0 9 * * *@01-01 06:00",
+		"CRON_TZ=UTC 0 0 9 * * *@01-01 09:00",
+		"TZ=Asia/Tokyo 0 0 9 * * *@01-02 00:00",
+	}, fired)
+}
+
+func TestVirtualCronDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	run := func(from time.Time, d time.Duration, specs ...string) (fired []string) {
+		clock := NewVirtualClock(from)
+		c := clock.NewCron(berlin)
+		for _, spec := range specs {
+			spec := spec
+			_, err := c.AddFunc(spec, func() {
+				fired = append(fired, spec+"@"+clock.Now().In(berlin).Format("01-02 15:04 MST"))
+			})
+			require.NoError(t, err)
+		}
+		c.Start()
+		clock.Advance(d, nil)
+		return
+	}
+
+	// 2026-03-29 02:00 CET -> 03:00 CEST: the skipped run
+	// happens right after the transition
+	assert.Equal(t, []string{
+		"0 30 2 * * *@03-29 03:00 CEST",
+		"0 30 2 * * *@03-30 02:30 CEST",
+	}, run(time.Date(2026, 3, 28, 12, 0, 0, 0, berlin), 48*time.Hour, "0 30 2 * * *"))
+	assert.Equal(t, []string{
+		"0 0 3 * * *@03-29 03:00 CEST",
+		"0 30 2 * * *@03-29 03:00 CEST",
+	}, run(time.Date(2026, 3, 29, 0, 0, 0, 0, berlin), 2*time.Hour, "0 0 3 * * *", "0 30 2 * * *"))
+	assert.Equal(t, []string{
+		"@hourly@03-29 01:00 CET",
+		"@hourly@03-29 03:00 CEST",
+		"@hourly@03-29 04:00 CEST",
+	}, run(time.Date(2026, 3, 29, 0, 30, 0, 0, berlin), 3*time.Hour, "@hourly"))
+	assert.Equal(t, []string{
+		"0 0 9 * * *@03-28 09:00 CET",
+		"0 0 9 * * *@03-29 09:00 CEST",
+	}, run(time.Date(2026, 3, 28, 0, 0, 0, 0, berlin), 47*time.Hour, "0 0 9 * * *"))
+
+	// 2026-10-25 03:00 CEST -> 02:00 CET: the repeated
+	// wall time runs once, hourly rules run each hour
+	assert.Equal(t, []string{
+		"0 30 2 * * *@10-25 02:30 CEST",
+		"0 30 2 * * *@10-26 02:30 CET",
+	}, run(time.Date(2026, 10, 24, 12, 0, 0, 0, berlin), 48*time.Hour, "0 30 2 * * *"))
+	assert.Equal(t, []string{
+		"@hourly@10-25 01:00 CEST",
+		"@hourly@10-25 02:00 CEST",
+		"@hourly@10-25 02:00 CET",
+		"@hourly@10-25 03:00 CET",
+	}, run(time.Date(2026, 10, 25, 0, 30, 0, 0, berlin), 4*time.Hour, "@hourly"))
+}
+
+func TestSimScript(t *testing.T) {
+	script, err := ParseSimScript([]byte(`
+start: "2026-01-01T10:00:00Z"
+duration: 1h
+events:
+  - control: somedev/temp
+    type: temperature
+    value: 19.5
+  - after: 5m
+    control: somedev/sw
+    value: true
+  - at: 30m
+    control: vdev/sw
+    value: false
+    on: true
+  - after: 1s
+    topic: /some/topic
+    payload: hello
+`))
+	require.NoError(t, err)
+
+	start, err := script.StartTime()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), start)
+
+	offsets, err := script.offsets()
+	require.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, 5 * time.Minute, 30 * time.Minute, 30*time.Minute + time.Second}, offsets)
+
+	assert.Equal(t, []wbgong.MQTTMessage{
+		{Topic: "/devices/somedev/controls/temp/meta/type", Payload: "temperature", QoS: 1, Retained: true},
+		{Topic: "/devices/somedev/controls/temp", Payload: "19.5", QoS: 1, Retained: true},
+	}, script.Events[0].messages())
+	assert.Equal(t, []wbgong.MQTTMessage{
+		{Topic: "/devices/somedev/controls/sw", Payload: "1", QoS: 1, Retained: true},
+	}, script.Events[1].messages())
+	assert.Equal(t, []wbgong.MQTTMessage{
+		{Topic: "/devices/vdev/controls/sw/on", Payload: "0", QoS: 1},
+	}, script.Events[2].messages())
+	assert.Equal(t, []wbgong.MQTTMessage{
+		{Topic: "/some/topic", Payload: "hello", QoS: 1},
+	}, script.Events[3].messages())
+
+	// JSON is accepted as well
+	script, err = ParseSimScript([]byte(`{"events": [{"at": "10m"}, {"at": "5m"}]}`))
+	require.NoError(t, err)
+	_, err = script.offsets()
+	assert.EqualError(t, err, "event 1: events must be ordered by time")
+}
+
+func TestSimulator(t *testing.T) {
+	tmpDir := t.TempDir()
+	options := NewESEngineOptions()
+	options.SetPersistentDBFile(filepath.Join(tmpDir, "persistent.db"))
+
+	var out bytes.Buffer
+	sim, err := NewSimulator(&out, time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC), options)
+	require.NoError(t, err)
+	defer sim.Stop()
+
+	data, err := os.ReadFile("testrules_simulate.js")
+	require.NoError(t, err)
+	scriptPath := filepath.Join(tmpDir, "testrules_simulate.js")
+	require.NoError(t, os.WriteFile(scriptPath, data, 0644))
+	require.NoError(t, sim.LoadScripts([]string{scriptPath}))
+
+	script, err := ParseSimScript([]byte(`
+duration: 20m
+events:
+  - control: somedev/temp
+    type: temperature
+    value: 19
+  - after: 1m
+    control: somedev/temp
+    value: 25
+`))
+	require.NoError(t, err)
+	require.NoError(t, sim.Run(script))
+
+	lines := strings.Split(out.String(), "\n")
+	for _, expected := range []string{
+		"[00:00:00.000] input /devices/somedev/controls/temp: 19",
+		"[00:01:00.000] input /devices/somedev/controls/temp: 25",
+		"[00:01:00.000] log [info] overheat: 25",
+		"[00:01:00.000] publish /devices/simdev/controls/alarm: 1 (retained)",
+		"[00:01:00.000] change simdev/alarm: false -> true",
+		"[00:01:00.000] spawn /bin/sh -c echo overheat | wall",
+		"[00:01:00.000] log [info] notified: 0",
+		"[00:11:00.000] log [info] alarm reset",
+		"[00:11:00.000] change simdev/alarm: true -> false",
+	} {
+		assert.Contains(t, lines, expected)
+	}
+}
+
+func TestSimulatorVirtualClockDay(t *testing.T) {
+	tmpDir := t.TempDir()
+	options := NewESEngineOptions()
+	options.SetPersistentDBFile(filepath.Join(tmpDir, "persistent.db"))
+
+	var out bytes.Buffer
+	sim, err := NewSimulator(&out, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), options)
+	require.NoError(t, err)
+	defer sim.Stop()
+
+	data, err := os.ReadFile("testrules_virtual_clock.js")
+	require.NoError(t, err)
+	scriptPath := filepath.Join(tmpDir, "testrules_virtual_clock.js")
+	require.NoError(t, os.WriteFile(scriptPath, data, 0644))
+	require.NoError(t, sim.LoadScripts([]string{scriptPath}))
+
+	started := time.Now()
+	require.NoError(t, sim.Run(&SimScript{Duration: "24h"}))
+	assert.Less(t, time.Since(started), time.Minute)
+	assert.Equal(t, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), sim.engine.Clock().Now())
+
+	lines := strings.Split(out.String(), "\n")
+	// cron entries are scheduled before timers which
+	// fire at the same time, so cron rule runs first
+	assert.Contains(t, lines, "[01:00:00.000] log [info] hourly: ticks=1 quarters=3")
+	assert.Contains(t, lines, "[12:00:00.000] log [info] hourly: ticks=23 quarters=47")
+	assert.Contains(t, lines, "[24:00:00.000] log [info] hourly: ticks=47 quarters=95")
+}
+
+func TestSimulatorDeadline(t *testing.T) {
+	tmpDir := t.TempDir()
+	options := NewESEngineOptions()
+	options.SetPersistentDBFile(filepath.Join(tmpDir, "persistent.db"))
+
+	var out bytes.Buffer
+	sim, err := NewSimulator(&out, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), options)
+	require.NoError(t, err)
+	defer sim.Stop()
+
+	data, err := os.ReadFile("testrules_virtual_clock.js")
+	require.NoError(t, err)
+	scriptPath := filepath.Join(tmpDir, "testrules_virtual_clock.js")
+	require.NoError(t, os.WriteFile(scriptPath, data, 0644))
+	require.NoError(t, sim.LoadScripts([]string{scriptPath}))
+
+	sim.SetDeadline(time.Now())
+	assert.ErrorIs(t, sim.Run(&SimScript{Duration: "24h"}), errSimTimeout)
+	assert.True(t, sim.engine.Clock().Now().Before(time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)))
+}
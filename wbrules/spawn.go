@@ -31,6 +31,9 @@ func captureCommandOutput(pipe io.ReadCloser, wg *sync.WaitGroup, result *string
 	}()
 }
 
+// SpawnFunc runs external commands started by spawn() and runShellCommand()
+type SpawnFunc func(name string, args []string, captureOutput bool, captureErrorOutput bool, input *string) (*CommandResult, error)
+
 func Spawn(name string, args []string, captureOutput bool, captureErrorOutput bool, input *string) (*CommandResult, error) {
 	r := &CommandResult{0, "", ""}
 	var err error
@@ -0,0 +1,214 @@
+package wbrules
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// StorageSource provides access to persistent storages of scripts
+type StorageSource interface {
+	StorageBuckets() ([]StorageBucketInfo, error)
+	StorageGet(bucket, key string) (json.RawMessage, error)
+	StorageSet(bucket, key string, value json.RawMessage) error
+	StorageDelete(bucket, key string) error
+	StorageExport(buckets []string) (*StorageDump, error)
+	StorageImport(dump *StorageDump, replace bool) error
+	StorageGC(remove bool) ([]StorageBucketInfo, error)
+}
+
+type Storage struct {
+	source   StorageSource
+	writable bool
+}
+
+type StorageError struct {
+	code    int32
+	message string
+}
+
+func (err *StorageError) Error() string {
+	return err.message
+}
+
+func (err *StorageError) ErrorCode() int32 {
+	return err.code
+}
+
+const (
+	// no iota here because these values may be used
+	// by external software
+	STORAGE_ERROR_DISABLED         = 1300
+	STORAGE_ERROR_BUCKET_NOT_FOUND = 1301
+	STORAGE_ERROR_KEY_NOT_FOUND    = 1302
+	STORAGE_ERROR_INVALID_BUCKET   = 1303
+	STORAGE_ERROR_INVALID_KEY      = 1304
+	STORAGE_ERROR_INVALID_VALUE    = 1305
+	STORAGE_ERROR_INVALID_DUMP     = 1306
+	STORAGE_ERROR_READ_ONLY        = 1307
+)
+
+var (
+	storageDisabledError       = &StorageError{STORAGE_ERROR_DISABLED, "Persistent storage is disabled"}
+	storageBucketNotFoundError = &StorageError{STORAGE_ERROR_BUCKET_NOT_FOUND, "Storage not found"}
+	storageKeyNotFoundError    = &StorageError{STORAGE_ERROR_KEY_NOT_FOUND, "Key not found"}
+	invalidStorageBucketError  = &StorageError{STORAGE_ERROR_INVALID_BUCKET, "Storage is not specified"}
+	invalidStorageKeyError     = &StorageError{STORAGE_ERROR_INVALID_KEY, "Key is not specified"}
+	invalidStorageValueError   = &StorageError{STORAGE_ERROR_INVALID_VALUE, "Value is not specified"}
+	invalidStorageDumpError    = &StorageError{STORAGE_ERROR_INVALID_DUMP, "Invalid storage dump"}
+	storageReadOnlyError       = &StorageError{STORAGE_ERROR_READ_ONLY, "Storage modification is disabled"}
+)
+
+// NewStorage creates the storage service. Unless writable is set,
+// the methods modifying the storages fail
+func NewStorage(source StorageSource, writable bool) *Storage {
+	return &Storage{source, writable}
+}
+
+func storageError(err error) error {
+	switch {
+	case errors.Is(err, errStorageDisabled):
+		return storageDisabledError
+	case errors.Is(err, errBucketNotFound):
+		return storageBucketNotFoundError
+	case errors.Is(err, errKeyNotFound):
+		return storageKeyNotFoundError
+	}
+	return err
+}
+
+// List returns persistent storages with their keys
+func (storage *Storage) List(args *struct{}, reply *[]StorageBucketInfo) error {
+	buckets, err := storage.source.StorageBuckets()
+	if err != nil {
+		return storageError(err)
+	}
+	*reply = buckets
+	return nil
+}
+
+type StorageKeyArgs struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+type StorageValue struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// Get returns the value of the key
+func (storage *Storage) Get(args *StorageKeyArgs, reply *StorageValue) error {
+	if args.Bucket == "" {
+		return invalidStorageBucketError
+	}
+	if args.Key == "" {
+		return invalidStorageKeyError
+	}
+	value, err := storage.source.StorageGet(args.Bucket, args.Key)
+	if err != nil {
+		return storageError(err)
+	}
+	reply.Value = value
+	return nil
+}
+
+type StorageSetArgs struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// Set writes the value of the key creating the storage if necessary.
+// Null values aren't allowed, use Delete to remove keys
+func (storage *Storage) Set(args *StorageSetArgs, reply *bool) error {
+	if !storage.writable {
+		return storageReadOnlyError
+	}
+	if args.Bucket == "" {
+		return invalidStorageBucketError
+	}
+	if args.Key == "" {
+		return invalidStorageKeyError
+	}
+	if len(args.Value) == 0 || string(args.Value) == "null" {
+		return invalidStorageValueError
+	}
+	if err := storage.source.StorageSet(args.Bucket, args.Key, args.Value); err != nil {
+		return storageError(err)
+	}
+	*reply = true
+	return nil
+}
+
+// Delete removes the key or the whole storage if the key is not specified
+func (storage *Storage) Delete(args *StorageKeyArgs, reply *bool) error {
+	if !storage.writable {
+		return storageReadOnlyError
+	}
+	if args.Bucket == "" {
+		return invalidStorageBucketError
+	}
+	if err := storage.source.StorageDelete(args.Bucket, args.Key); err != nil {
+		return storageError(err)
+	}
+	*reply = true
+	return nil
+}
+
+type StorageExportArgs struct {
+	Buckets []string `json:"buckets"`
+}
+
+// Export dumps the specified storages or all of them
+func (storage *Storage) Export(args *StorageExportArgs, reply *StorageDump) error {
+	dump, err := storage.source.StorageExport(args.Buckets)
+	if err != nil {
+		return storageError(err)
+	}
+	*reply = *dump
+	return nil
+}
+
+type StorageImportArgs struct {
+	Dump    *StorageDump `json:"dump"`
+	Replace bool         `json:"replace"`
+}
+
+// Import writes the values from the dump made by Export. If replace
+// is set, the storages from the dump are cleared before writing
+func (storage *Storage) Import(args *StorageImportArgs, reply *bool) error {
+	if !storage.writable {
+		return storageReadOnlyError
+	}
+	if args.Dump == nil || args.Dump.Buckets == nil {
+		return invalidStorageDumpError
+	}
+	for name := range args.Dump.Buckets {
+		if name == "" {
+			return invalidStorageDumpError
+		}
+	}
+	if err := storage.source.StorageImport(args.Dump, args.Replace); err != nil {
+		return storageError(err)
+	}
+	*reply = true
+	return nil
+}
+
+type StorageGCArgs struct {
+	Remove bool `json:"remove"`
+}
+
+// GC returns local storages of the scripts that don't exist anymore
+// and local-looking storages of unknown scripts. If remove is set,
+// the storages of removed scripts are removed
+func (storage *Storage) GC(args *StorageGCArgs, reply *[]StorageBucketInfo) error {
+	if args.Remove && !storage.writable {
+		return storageReadOnlyError
+	}
+	orphans, err := storage.source.StorageGC(args.Remove)
+	if err != nil {
+		return storageError(err)
+	}
+	*reply = orphans
+	return nil
+}
@@ -0,0 +1,164 @@
+package wbrules
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/objx"
+	"github.com/wirenboard/wbgong/testutils"
+	bolt "go.etcd.io/bbolt"
+)
+
+type StorageRpcSuite struct {
+	testutils.Suite
+	*testutils.RpcFixture
+	tmpDir string
+	engine *ESEngine
+}
+
+func (s *StorageRpcSuite) T() *testing.T {
+	return s.Suite.T()
+}
+
+func (s *StorageRpcSuite) SetupTest() {
+	s.Suite.SetupTest()
+	var err error
+	s.tmpDir, err = os.MkdirTemp("", "wbrulestest")
+	s.Ck("MkdirTemp()", err)
+	db, err := bolt.Open(s.tmpDir+"/test_persistent.db", PERSISTENT_DB_CHMOD, nil)
+	s.Ck("bolt.Open()", err)
+	s.engine = &ESEngine{
+		persistentDB: db,
+		sourceRoot:   "/etc/wb-rules",
+		sources: map[string]*LocFileEntry{
+			"/etc/wb-rules/heating.js": {VirtualPath: "heating.js"},
+		},
+	}
+	s.RpcFixture = testutils.NewRpcFixture(
+		s.T(), "wbrules", "Storage", "wbrules",
+		NewStorage(s.engine, true),
+		"Delete", "Export", "GC", "Get", "Import", "List", "Set")
+}
+
+func (s *StorageRpcSuite) TearDownTest() {
+	s.TearDownRPC()
+	if s.engine.persistentDB != nil {
+		s.engine.persistentDB.Close()
+	}
+	os.RemoveAll(s.tmpDir)
+	s.Suite.TearDownTest()
+}
+
+func (s *StorageRpcSuite) TestSetGetDelete() {
+	local := localObjectId("/etc/wb-rules/heating.js", "state")
+	s.VerifyRpc("List", objx.Map{}, []objx.Map{})
+
+	s.VerifyRpc("Set", objx.Map{"bucket": local, "key": "mode", "value": "eco"}, true)
+	s.VerifyRpc("Set", objx.Map{"bucket": "counters", "key": "total", "value": 42}, true)
+	s.VerifyRpc("Set", objx.Map{"bucket": "counters", "key": "last", "value": objx.Map{"room": "hall"}}, true)
+
+	s.VerifyRpc("List", objx.Map{}, []objx.Map{
+		{"bucket": local, "name": "state", "script": "heating.js", "keys": []string{"mode"}},
+		{"bucket": "counters", "name": "counters", "keys": []string{"last", "total"}},
+	})
+	s.VerifyRpc("Get", objx.Map{"bucket": "counters", "key": "last"}, objx.Map{
+		"value": objx.Map{"room": "hall"},
+	})
+
+	s.VerifyRpc("Delete", objx.Map{"bucket": "counters", "key": "last"}, true)
+	s.VerifyRpcError("Get", objx.Map{"bucket": "counters", "key": "last"},
+		STORAGE_ERROR_KEY_NOT_FOUND, "StorageError", "Key not found")
+	s.VerifyRpc("Delete", objx.Map{"bucket": "counters"}, true)
+	s.VerifyRpcError("Get", objx.Map{"bucket": "counters", "key": "total"},
+		STORAGE_ERROR_BUCKET_NOT_FOUND, "StorageError", "Storage not found")
+}
+
+func (s *StorageRpcSuite) TestExportImport() {
+	s.VerifyRpc("Import", objx.Map{
+		"dump": objx.Map{
+			"buckets": objx.Map{
+				"counters": objx.Map{"values": objx.Map{"total": 42, "name": "hall"}},
+			},
+		},
+	}, true)
+	s.VerifyRpc("Import", objx.Map{
+		"dump": objx.Map{
+			"buckets": objx.Map{
+				"counters": objx.Map{"values": objx.Map{"total": 43, "name": nil}},
+				"modes":    objx.Map{"values": objx.Map{"hall": "eco"}},
+			},
+		},
+	}, true)
+	s.VerifyRpc("Export", objx.Map{"buckets": []string{"counters"}}, objx.Map{
+		"buckets": objx.Map{
+			"counters": objx.Map{"values": objx.Map{"total": 43}},
+		},
+	})
+
+	s.VerifyRpc("Import", objx.Map{
+		"dump": objx.Map{
+			"buckets": objx.Map{
+				"modes": objx.Map{"values": objx.Map{"kitchen": "comfort"}},
+			},
+		},
+		"replace": true,
+	}, true)
+	s.VerifyRpc("Export", objx.Map{}, objx.Map{
+		"buckets": objx.Map{
+			"counters": objx.Map{"values": objx.Map{"total": 43}},
+			"modes":    objx.Map{"values": objx.Map{"kitchen": "comfort"}},
+		},
+	})
+}
+
+func (s *StorageRpcSuite) TestGC() {
+	removed := localObjectId(s.tmpDir+"/removed.js", "state")
+	s.Ck("setStorageOwner()", s.engine.setStorageOwner(removed, s.tmpDir+"/removed.js"))
+	s.VerifyRpc("Set", objx.Map{"bucket": removed, "key": "mode", "value": "eco"}, true)
+
+	orphan := objx.Map{"bucket": removed, "name": "state", "script": s.tmpDir + "/removed.js", "keys": []string{"mode"}}
+	s.VerifyRpc("GC", objx.Map{}, []objx.Map{orphan})
+	s.VerifyRpc("GC", objx.Map{"remove": true}, []objx.Map{orphan})
+	s.VerifyRpc("GC", objx.Map{}, []objx.Map{})
+	s.VerifyRpc("List", objx.Map{}, []objx.Map{})
+}
+
+func (s *StorageRpcSuite) TestErrors() {
+	s.VerifyRpcError("Get", objx.Map{"key": "total"},
+		STORAGE_ERROR_INVALID_BUCKET, "StorageError", "Storage is not specified")
+	s.VerifyRpcError("Set", objx.Map{"bucket": "counters", "value": 1},
+		STORAGE_ERROR_INVALID_KEY, "StorageError", "Key is not specified")
+	s.VerifyRpcError("Set", objx.Map{"bucket": "counters", "key": "total", "value": nil},
+		STORAGE_ERROR_INVALID_VALUE, "StorageError", "Value is not specified")
+	s.VerifyRpcError("Import", objx.Map{},
+		STORAGE_ERROR_INVALID_DUMP, "StorageError", "Invalid storage dump")
+	s.VerifyRpcError("Export", objx.Map{"buckets": []string{"nosuchstorage"}},
+		STORAGE_ERROR_BUCKET_NOT_FOUND, "StorageError", "Storage not found")
+	s.VerifyRpcError("Delete", objx.Map{"bucket": RULE_STATES_BUCKET},
+		STORAGE_ERROR_BUCKET_NOT_FOUND, "StorageError", "Storage not found")
+
+	s.engine.persistentDB.Close()
+	s.engine.persistentDB = nil
+	s.VerifyRpcError("List", objx.Map{},
+		STORAGE_ERROR_DISABLED, "StorageError", "Persistent storage is disabled")
+}
+
+func (s *StorageRpcSuite) TestReadOnly() {
+	s.VerifyRpc("Set", objx.Map{"bucket": "counters", "key": "total", "value": 42}, true)
+
+	storage := NewStorage(s.engine, false)
+	var ok bool
+	s.Equal(storageReadOnlyError, storage.Set(&StorageSetArgs{"counters", "total", []byte("1")}, &ok))
+	s.Equal(storageReadOnlyError, storage.Delete(&StorageKeyArgs{"counters", "total"}, &ok))
+	s.Equal(storageReadOnlyError, storage.Import(&StorageImportArgs{Dump: &StorageDump{}}, &ok))
+	var orphans []StorageBucketInfo
+	s.Equal(storageReadOnlyError, storage.GC(&StorageGCArgs{Remove: true}, &orphans))
+	s.Ck("GC()", storage.GC(&StorageGCArgs{}, &orphans))
+	var reply StorageValue
+	s.Ck("Get()", storage.Get(&StorageKeyArgs{"counters", "total"}, &reply))
+	s.Equal("42", string(reply.Value))
+}
+
+func TestStorageRpcSuite(t *testing.T) {
+	testutils.RunSuites(t, new(StorageRpcSuite))
+}
@@ -23,6 +23,7 @@ const (
 	VDEV_CONTROL_DESCR_PROP_MAX       = "max"
 	VDEV_CONTROL_DESCR_PROP_MIN       = "min"
 	VDEV_CONTROL_DESCR_PROP_PRECISION = "precision"
+	VDEV_CONTROL_DESCR_PROP_HISTORY   = "history"
 
 	// default value for 'readonly'
 	VDEV_CONTROL_READONLY_DEFAULT = true
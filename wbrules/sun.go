@@ -0,0 +1,162 @@
+package wbrules
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SUN_EVENT_SUNRISE = "sunrise"
+	SUN_EVENT_SUNSET  = "sunset"
+	SUN_EVENT_DAWN    = "dawn" // civil dawn
+	SUN_EVENT_DUSK    = "dusk" // civil dusk
+	SUN_EVENT_NOON    = "noon" // solar noon
+
+	// sun altitudes (in degrees) of the events
+	sunAltitudeHorizon = -0.833 // accounts for refraction and the solar disc size
+	sunAltitudeCivil   = -6.0
+
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+
+	// near the poles sunrise and sunset happen once a year,
+	// so the events are searched for more than a year ahead
+	sunScheduleMaxDays = 400
+)
+
+// GeoLocation is a location on Earth. Latitude is positive
+// to the north, longitude is positive to the east
+type GeoLocation struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ParseGeoLocation parses "latitude,longitude" string
+func ParseGeoLocation(s string) (*GeoLocation, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid location %q, latitude,longitude expected", s)
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", parts[0])
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", parts[1])
+	}
+	loc := &GeoLocation{lat, lon}
+	return loc, loc.Validate()
+}
+
+func (loc *GeoLocation) Validate() error {
+	if math.IsNaN(loc.Latitude) || loc.Latitude < -90 || loc.Latitude > 90 {
+		return fmt.Errorf("latitude must be in range [-90, 90]")
+	}
+	if math.IsNaN(loc.Longitude) || loc.Longitude < -180 || loc.Longitude > 180 {
+		return fmt.Errorf("longitude must be in range [-180, 180]")
+	}
+	return nil
+}
+
+func IsValidSunEvent(event string) bool {
+	switch event {
+	case SUN_EVENT_SUNRISE, SUN_EVENT_SUNSET, SUN_EVENT_DAWN, SUN_EVENT_DUSK, SUN_EVENT_NOON:
+		return true
+	}
+	return false
+}
+
+func sinDeg(x float64) float64 { return math.Sin(x * math.Pi / 180) }
+func cosDeg(x float64) float64 { return math.Cos(x * math.Pi / 180) }
+
+func julianToTime(j float64) time.Time {
+	secs := (j - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(math.Round(secs*1e9))).UTC()
+}
+
+// sunEventTime calculates the time of the event for the n-th day
+// since J2000 using the sunrise equation. ok is false if there's
+// no such event that day (polar day or night)
+func sunEventTime(event string, n float64, loc GeoLocation) (t time.Time, ok bool) {
+	// mean solar time
+	j := n - loc.Longitude/360
+	// solar mean anomaly
+	m := math.Mod(357.5291+0.98560028*j, 360)
+	// equation of the center
+	c := 1.9148*sinDeg(m) + 0.0200*sinDeg(2*m) + 0.0003*sinDeg(3*m)
+	// ecliptic longitude
+	lambda := math.Mod(m+c+180+102.9372, 360)
+	transit := julian2000 + j + 0.0053*sinDeg(m) - 0.0069*sinDeg(2*lambda)
+	if event == SUN_EVENT_NOON {
+		return julianToTime(transit), true
+	}
+
+	sinDecl := sinDeg(lambda) * sinDeg(23.4397)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	altitude := sunAltitudeHorizon
+	if event == SUN_EVENT_DAWN || event == SUN_EVENT_DUSK {
+		altitude = sunAltitudeCivil
+	}
+	cosHourAngle := (sinDeg(altitude) - sinDeg(loc.Latitude)*sinDecl) / (cosDeg(loc.Latitude) * cosDecl)
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, false
+	}
+	hourAngle := math.Acos(cosHourAngle) * 180 / math.Pi
+	if event == SUN_EVENT_SUNRISE || event == SUN_EVENT_DAWN {
+		return julianToTime(transit - hourAngle/360), true
+	}
+	return julianToTime(transit + hourAngle/360), true
+}
+
+// SunSchedule is a cron.Schedule that activates
+// at the solar event shifted by the offset
+type SunSchedule struct {
+	Event    string
+	Offset   time.Duration
+	Location GeoLocation
+}
+
+func NewSunSchedule(event string, offset time.Duration, loc GeoLocation) (*SunSchedule, error) {
+	if !IsValidSunEvent(event) {
+		return nil, fmt.Errorf("unknown sun event %q", event)
+	}
+	if err := loc.Validate(); err != nil {
+		return nil, err
+	}
+	return &SunSchedule{event, offset, loc}, nil
+}
+
+// Next returns the next activation time later than t. The days of
+// polar day or night without the event are skipped. Zero time, which
+// stops the schedule, is returned only if the event never happens
+// at the location
+func (s *SunSchedule) Next(t time.Time) time.Time {
+	// start a couple of days earlier, as the offset
+	// may move the event to another day
+	from := t.Add(-s.Offset)
+	day := math.Floor((float64(from.Unix())/86400+julianUnixEpoch)-julian2000) - 1
+	for i := 0; i < sunScheduleMaxDays; i++ {
+		ev, ok := sunEventTime(s.Event, day+float64(i), s.Location)
+		if !ok {
+			continue
+		}
+		if next := ev.Add(s.Offset).Truncate(time.Second); next.After(t) {
+			return next.In(t.Location())
+		}
+	}
+	return time.Time{}
+}
+
+func (s *SunSchedule) String() string {
+	switch {
+	case s.Offset > 0:
+		return s.Event + "+" + s.Offset.String()
+	case s.Offset < 0:
+		return s.Event + s.Offset.String()
+	}
+	return s.Event
+}
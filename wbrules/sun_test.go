@@ -0,0 +1,114 @@
+package wbrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGeoLocation(t *testing.T) {
+	loc, err := ParseGeoLocation("55.7558, 37.6173")
+	require.NoError(t, err)
+	assert.Equal(t, &GeoLocation{55.7558, 37.6173}, loc)
+
+	for _, s := range []string{"", "55.7", "55.7,abc", "91,0", "0,-181"} {
+		_, err := ParseGeoLocation(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestSunSchedule(t *testing.T) {
+	moscow := GeoLocation{55.7558, 37.6173}
+	msk := time.FixedZone("MSK", 3*60*60)
+	from := time.Date(2026, 6, 21, 0, 0, 0, 0, msk)
+
+	for _, c := range []struct {
+		event    string
+		offset   time.Duration
+		expected time.Time
+	}{
+		{SUN_EVENT_SUNRISE, 0, time.Date(2026, 6, 21, 3, 44, 27, 0, msk)},
+		{SUN_EVENT_NOON, 0, time.Date(2026, 6, 21, 12, 31, 12, 0, msk)},
+		{SUN_EVENT_SUNSET, 0, time.Date(2026, 6, 21, 21, 17, 57, 0, msk)},
+		{SUN_EVENT_SUNSET, 30 * time.Minute, time.Date(2026, 6, 21, 21, 47, 57, 0, msk)},
+		{SUN_EVENT_DUSK, 0, time.Date(2026, 6, 21, 22, 19, 29, 0, msk)},
+		// today's sunrise with the offset is already passed
+		{SUN_EVENT_SUNRISE, -4 * time.Hour, time.Date(2026, 6, 21, 23, 44, 40, 0, msk)},
+	} {
+		s, err := NewSunSchedule(c.event, c.offset, moscow)
+		require.NoError(t, err)
+		next := s.Next(from)
+		assert.Equal(t, c.expected, next, s.String())
+		assert.Equal(t, msk, next.Location())
+	}
+}
+
+func TestSunScheduleDaily(t *testing.T) {
+	london := GeoLocation{51.5074, -0.1278}
+	s, err := NewSunSchedule(SUN_EVENT_SUNSET, 0, london)
+	require.NoError(t, err)
+
+	// equinox, then the days become longer
+	next := s.Next(time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 3, 20, 18, 12, 18, 0, time.UTC), next)
+	for i := 0; i < 10; i++ {
+		following := s.Next(next)
+		d := following.Sub(next)
+		assert.True(t, d > 24*time.Hour && d < 24*time.Hour+3*time.Minute, "%s -> %s", next, following)
+		next = following
+	}
+	assert.Equal(t, s.Next(next.Add(-time.Second)), next)
+}
+
+func TestSunSchedulePolarDay(t *testing.T) {
+	murmansk := GeoLocation{68.97, 33.08}
+	s, err := NewSunSchedule(SUN_EVENT_SUNSET, 0, murmansk)
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 2026, next.Year())
+	assert.Equal(t, time.July, next.Month())
+
+	// there's solar noon even during polar night
+	s, err = NewSunSchedule(SUN_EVENT_NOON, 0, murmansk)
+	require.NoError(t, err)
+	next = s.Next(time.Date(2026, 12, 21, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, 21, next.Day())
+}
+
+func TestSunScheduleHighLatitude(t *testing.T) {
+	// near the pole there's no civil dawn for more than half a year
+	// between the polar night twilight and the white nights
+	loc := GeoLocation{86, 0}
+	s, err := NewSunSchedule(SUN_EVENT_DAWN, 0, loc)
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2026, 3, 25, 0, 0, 0, 0, time.UTC))
+	require.False(t, next.IsZero())
+	assert.Equal(t, time.Date(2026, 9, 29, 0, 0, 0, 0, time.UTC), next.Truncate(24*time.Hour))
+
+	// the schedule goes on after the gap
+	following := s.Next(next)
+	require.False(t, following.IsZero())
+	assert.Equal(t, next.Add(24*time.Hour).Truncate(24*time.Hour), following.Truncate(24*time.Hour))
+}
+
+func TestSunScheduleString(t *testing.T) {
+	for _, c := range []struct {
+		offset   time.Duration
+		expected string
+	}{
+		{0, "sunset"},
+		{30 * time.Minute, "sunset+30m0s"},
+		{-time.Hour, "sunset-1h0m0s"},
+	} {
+		s, err := NewSunSchedule(SUN_EVENT_SUNSET, c.offset, GeoLocation{})
+		require.NoError(t, err)
+		assert.Equal(t, c.expected, s.String())
+	}
+
+	_, err := NewSunSchedule("moonrise", 0, GeoLocation{})
+	assert.EqualError(t, err, `unknown sun event "moonrise"`)
+}
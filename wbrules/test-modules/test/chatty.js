@@ -0,0 +1,4 @@
+exports.talk = function () {
+  debug('module debug');
+  log('module info');
+};
@@ -0,0 +1,33 @@
+// -*- mode: js2-mode -*-
+
+defineRule('holdForRule', {
+  asSoonAs: function () {
+    return dev.somedev.hold > 10;
+  },
+  holdFor: 1000,
+  then: function () {
+    log('hold fired');
+  },
+});
+
+defineRule('debounceRule', {
+  asSoonAs: function () {
+    return dev.somedev.bounce == 1;
+  },
+  debounce: '500ms',
+  then: function () {
+    log('debounce fired');
+  },
+});
+
+defineRule('hysteresisRule', {
+  asSoonAs: function () {
+    return dev.somedev.temp > 30;
+  },
+  hysteresis: function () {
+    return dev.somedev.temp > 28;
+  },
+  then: function () {
+    log('overheat');
+  },
+});
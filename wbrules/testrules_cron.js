@@ -11,3 +11,21 @@ defineRule('crontest_daily', {
     log('@daily rule fired');
   },
 });
+
+defineRule('crontest_tz', {
+  when: cron('0 0 9 * * *', { tz: 'Europe/Moscow' }),
+  then: function () {
+    log('Europe/Moscow 9:00 rule fired');
+  },
+});
+
+global.__proto__.testInvalidCronTimezone = function testInvalidCronTimezone() {
+  try {
+    defineRule('badTz', { when: cron('@daily', { tz: 'Mars/Olympus' }), then: function () {} });
+  } catch (e) {}
+  try {
+    cron('TZ=UTC @daily', { tz: 'UTC' });
+  } catch (e) {
+    log(e.message);
+  }
+};
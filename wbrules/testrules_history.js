@@ -0,0 +1,40 @@
+// -*- mode: js2-mode -*-
+
+defineRule('logTemp', {
+  whenChanged: 'history/temp',
+  then: function (newValue) {
+    log('temp changed to {}', newValue);
+  },
+});
+
+global.__proto__.defineHistoryDevice = function defineHistoryDevice() {
+  defineVirtualDevice('history', {
+    cells: {
+      temp: {
+        type: 'value',
+        value: 20,
+        history: { keep: '1h', every: '10s' },
+      },
+    },
+  });
+};
+
+global.__proto__.logHistory = function logHistory() {
+  var h = getControl('history/temp').getHistory({ window: '1h' });
+  log('windows: {}, min: {}, max: {}', h.length, h[0].min, h[0].max);
+};
+
+global.__proto__.testInvalidHistory = function testInvalidHistory() {
+  [
+    { type: 'text', value: '', history: { keep: '1h' } },
+    { type: 'value', value: 0, history: { every: '1m' } },
+    { type: 'value', value: 0, history: { keep: '10s', every: '1m' } },
+    { type: 'value', value: 0, history: { keep: 'forever' } },
+  ].forEach(function (def) {
+    try {
+      defineVirtualDevice('badhistory', { cells: { ctrl: def } });
+    } catch (e) {
+      log('caught: {}', e.message);
+    }
+  });
+};
@@ -0,0 +1,17 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice('logtest', {
+  cells: {
+    fire: {
+      type: 'pushbutton',
+    },
+  },
+});
+
+defineRule('logRule', {
+  whenChanged: 'logtest/fire',
+  then: function () {
+    log.warning('fired: {}', 42);
+    undefinedFunc();
+  },
+});
@@ -0,0 +1,30 @@
+// -*- mode: js2-mode -*-
+
+var chatty = require('test/chatty');
+
+defineVirtualDevice('lvltest', {
+  cells: {
+    fire: {
+      type: 'pushbutton',
+    },
+    quiet: {
+      type: 'pushbutton',
+    },
+  },
+});
+
+defineRule('talk', {
+  whenChanged: 'lvltest/fire',
+  then: function () {
+    debug('script debug');
+    log.warning('script warning');
+    chatty.talk();
+  },
+});
+
+defineRule('quiet', {
+  whenChanged: 'lvltest/quiet',
+  then: function () {
+    log.setLevel('error');
+  },
+});
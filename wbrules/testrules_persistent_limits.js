@@ -0,0 +1,68 @@
+// -*- mode: js2-mode -*-
+
+var cache = new PersistentStorage('cache', { global: true });
+var limited = new PersistentStorage('limited', { global: true, maxKeys: 2, maxSize: 40 });
+
+PersistentStorage.onChange(cache, 'short', function (value, oldValue) {
+  log('short changed from {} to {}', JSON.stringify(oldValue), JSON.stringify(value));
+});
+
+function dump(ps) {
+  var keys = PersistentStorage.keys(ps);
+  keys.sort();
+  log('keys: {}', JSON.stringify(keys));
+}
+
+global.__proto__.testTTL = function testTTL() {
+  PersistentStorage.set(cache, 'short', 1, { ttl: 1 });
+  PersistentStorage.set(cache, 'long', 2, { ttl: '7d' });
+  PersistentStorage.set(cache, 'plain', 3);
+  log('short = {}, has short: {}', cache.short, PersistentStorage.has(cache, 'short'));
+};
+
+global.__proto__.testExpired = function testExpired() {
+  log('short = {}, has short: {}', cache.short, PersistentStorage.has(cache, 'short'));
+  dump(cache);
+};
+
+global.__proto__.testKeepTTL = function testKeepTTL() {
+  PersistentStorage.set(cache, 'obj', new StorableObject({ count: 1 }), { ttl: 200 });
+  // the field change rewrites the key without ttl option
+  cache.obj.count = 2;
+  PersistentStorage.set(cache, 'untimed', 1, { ttl: 1 });
+  PersistentStorage.set(cache, 'untimed', 2, { ttl: 0 });
+  log('obj.count = {}', cache.obj.count);
+};
+
+global.__proto__.testKeepTTLExpired = function testKeepTTLExpired() {
+  log('has obj: {}, untimed = {}', PersistentStorage.has(cache, 'obj'), cache.untimed);
+};
+
+global.__proto__.testQuota = function testQuota() {
+  limited.a = 1;
+  limited.b = 2;
+  limited.c = 3;
+  dump(limited);
+  limited.b = 4;
+  PersistentStorage.set(limited, 'd', 5);
+  dump(limited);
+};
+
+global.__proto__.testErrors = function testErrors() {
+  try {
+    limited.big = 'a very long string that does not fit the limit';
+  } catch (e) {
+    log('caught: {}', e.message);
+  }
+  try {
+    PersistentStorage.set(cache, 'bad', 1, { ttl: 'soon' });
+  } catch (e) {
+    log('caught: {}', e.message);
+  }
+  try {
+    new PersistentStorage('bad', { global: true, maxKeys: -1 });
+  } catch (e) {
+    log('caught: {}', e.message);
+  }
+  dump(limited);
+};
@@ -0,0 +1,81 @@
+// -*- mode: js2-mode -*-
+
+var ps = new PersistentStorage('test_tx', { global: true });
+
+function dump() {
+  log(
+    'keys: ' + JSON.stringify(PersistentStorage.keys(ps)) +
+      ', has a: ' + PersistentStorage.has(ps, 'a') +
+      ', has c: ' + PersistentStorage.has(ps, 'c')
+  );
+}
+
+global.__proto__.testCommit = function testCommit() {
+  var result = PersistentStorage.transaction(ps, function (s) {
+    s.a = 1;
+    s.b = 'two';
+    log('inside: a = ' + s.a + ', has b: ' + PersistentStorage.has(s, 'b'));
+    return 'done';
+  });
+  log('result: ' + result);
+  dump();
+};
+
+global.__proto__.testRollback = function testRollback() {
+  ps.a = 1;
+  try {
+    PersistentStorage.transaction(ps, function (s) {
+      s.a = 42;
+      s.c = true;
+      throw new Error('oops');
+    });
+  } catch (e) {
+    log('caught: ' + e.message);
+  }
+  log('a = ' + ps.a);
+  dump();
+};
+
+global.__proto__.testNested = function testNested() {
+  try {
+    PersistentStorage.transaction(ps, function (s) {
+      s.a = 'outer';
+      PersistentStorage.transaction(s, function (s) {
+        s.c = 'inner';
+      });
+      throw new Error('outer failed');
+    });
+  } catch (e) {
+    log('caught: ' + e.message);
+  }
+  dump();
+};
+
+global.__proto__.testClear = function testClear() {
+  ps.a = 1;
+  ps.c = 2;
+  PersistentStorage.clear(ps);
+  dump();
+};
+
+global.__proto__.testWriteError = function testWriteError() {
+  try {
+    ps[''] = 1;
+  } catch (e) {
+    log('caught: ' + e.message);
+  }
+  try {
+    ps._psapi = 1;
+  } catch (e) {
+    log('caught: ' + e.message);
+  }
+  // method names may be used as keys
+  ps.keys = 1;
+  log('keys = ' + ps.keys + ', has keys: ' + PersistentStorage.has(ps, 'keys'));
+  ps.keys = null;
+  try {
+    PersistentStorage.keys({});
+  } catch (e) {
+    log('caught: ' + e.message);
+  }
+};
@@ -0,0 +1,7 @@
+// -*- mode: js2-mode -*-
+
+var ps = new PersistentStorage('shared', { global: true });
+
+PersistentStorage.onChange(ps, 'mode', function (value, oldValue, key) {
+  log('watcher 2: {} changed from {} to {}', key, JSON.stringify(oldValue), JSON.stringify(value));
+});
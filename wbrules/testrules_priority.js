@@ -0,0 +1,31 @@
+// -*- mode: js2-mode -*-
+
+defineRule('interlock', {
+  whenChanged: 'somedev/temp',
+  priority: 10,
+  then: function () {
+    log('interlock');
+  },
+});
+
+defineRule('first', {
+  whenChanged: 'somedev/temp',
+  then: function () {
+    log('first');
+  },
+});
+
+defineRule('early', {
+  whenChanged: 'somedev/temp',
+  priority: -5,
+  then: function () {
+    log('early');
+  },
+});
+
+defineRule('second', {
+  whenChanged: 'somedev/temp',
+  then: function () {
+    log('second');
+  },
+});
@@ -0,0 +1,16 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice('qtest', {
+  cells: {
+    fail: {
+      type: 'pushbutton',
+    },
+  },
+});
+
+defineRule('failingRule', {
+  whenChanged: 'qtest/fail',
+  then: function () {
+    throw new Error('failing rule');
+  },
+});
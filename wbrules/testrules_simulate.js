@@ -0,0 +1,30 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice("simdev", {
+  title: "Simulated device",
+  cells: {
+    alarm: {
+      type: "switch",
+      value: false
+    }
+  }
+});
+
+defineRule("overheat", {
+  whenChanged: "somedev/temp",
+  then: function (newValue) {
+    if (newValue <= 20 || dev["simdev/alarm"])
+      return;
+    log("overheat: {}", newValue);
+    dev["simdev/alarm"] = true;
+    runShellCommand("echo overheat | wall", {
+      exitCallback: function (exitCode) {
+        log("notified: {}", exitCode);
+      }
+    });
+    setTimeout(function () {
+      log("alarm reset");
+      dev["simdev/alarm"] = false;
+    }, 10 * 60 * 1000);
+  }
+});
@@ -0,0 +1,34 @@
+// -*- mode: js2-mode -*-
+
+defineRule('sunsetLights', {
+  when: sun('sunset', { offset: '+30m' }),
+  then: function () {
+    log('sunset+30m rule fired');
+  },
+});
+
+defineRule('spbSunrise', {
+  when: sun('sunrise', { offset: '-15m', lat: 59.94, lon: 30.31 }),
+  then: function () {
+    log('sunrise-15m rule fired');
+  },
+});
+
+defineRule('dusk', {
+  when: sun('dusk'),
+  then: function () {
+    log('dusk rule fired');
+  },
+});
+
+global.__proto__.testInvalidSun = function testInvalidSun() {
+  try {
+    defineRule('badEvent', { when: sun('moonrise'), then: function () {} });
+  } catch (e) {}
+  try {
+    defineRule('badOffset', { when: sun('sunset', { offset: 'soon' }), then: function () {} });
+  } catch (e) {}
+  try {
+    defineRule('noLon', { when: sun('sunset', { lat: 10 }), then: function () {} });
+  } catch (e) {}
+};
@@ -0,0 +1,44 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice('switchtest', {
+  cells: {
+    heat: {
+      type: 'pushbutton',
+    },
+    vent: {
+      type: 'pushbutton',
+    },
+  },
+});
+
+defineRule('heating', {
+  switchable: true,
+  whenChanged: 'switchtest/heat',
+  then: function () {
+    log('heating rule fired');
+  },
+});
+
+var ventilationRule = defineRule('ventilation', {
+  switchable: true,
+  whenChanged: 'switchtest/vent',
+  then: function () {
+    log('ventilation rule fired');
+  },
+});
+
+global.__proto__.disableVentilation = function disableVentilation() {
+  disableRule(ventilationRule);
+};
+
+global.__proto__.testInvalidSwitchable = function testInvalidSwitchable() {
+  try {
+    defineRule({ switchable: true, whenChanged: 'switchtest/heat', then: function () {} });
+  } catch (e) {}
+  try {
+    defineRule('heating/night', { switchable: true, whenChanged: 'switchtest/heat', then: function () {} });
+  } catch (e) {}
+  try {
+    defineRule('lights', { switchable: 'yes', whenChanged: 'switchtest/heat', then: function () {} });
+  } catch (e) {}
+};
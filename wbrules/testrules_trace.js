@@ -0,0 +1,20 @@
+// -*- mode: js2-mode -*-
+
+defineRule('traceTemp', {
+  whenChanged: 'somedev/temp',
+  then: function (newValue) {
+    if (newValue > 30) {
+      throw new Error('too hot');
+    }
+    log('temp: {}', newValue);
+  },
+});
+
+defineRule('traceNever', {
+  when: function () {
+    return dev.somedev.temp > 100;
+  },
+  then: function () {
+    log('never');
+  },
+});
@@ -0,0 +1,68 @@
+// -*- mode: js2-mode -*-
+
+var room = defineVirtualDeviceTemplate('room', {
+  title: 'Room',
+  cells: {
+    temp: { type: 'value', value: 20 },
+    heater: { type: 'switch', value: false },
+  },
+  rules: {
+    thermostat: function (device, id) {
+      return {
+        whenChanged: id + '/temp',
+        then: function (newValue) {
+          log('{}: temp {}', id, newValue);
+        },
+      };
+    },
+  },
+});
+
+var kitchen;
+
+global.__proto__.createKitchen = function createKitchen() {
+  kitchen = room.instantiate('kitchen', {
+    title: 'Kitchen',
+    cells: { temp: { value: 22 }, heater: null },
+  });
+  log('kitchen created, has heater: {}', kitchen.isControlExists('heater'));
+};
+
+global.__proto__.removeKitchen = function removeKitchen() {
+  kitchen.remove();
+  log('kitchen removed: {}', getDevice('kitchen') === undefined);
+};
+
+global.__proto__.testBadInstances = function testBadInstances() {
+  [
+    function () {
+      instantiate(room, 'kitchen');
+    },
+    function () {
+      instantiate({ name: 'nosuchtemplate', rules: {} }, 'hall');
+    },
+    function () {
+      defineVirtualDeviceTemplate('room', { cells: {} });
+    },
+  ].forEach(function (f) {
+    try {
+      f();
+    } catch (e) {
+      log('caught: {}', e.message);
+    }
+  });
+};
+
+// the instance created by the rule belongs to the script
+defineVirtualDevice('templateTest', {
+  cells: {
+    create: { type: 'switch', value: false, forceDefault: true },
+  },
+});
+
+defineRule({
+  whenChanged: 'templateTest/create',
+  then: function () {
+    createKitchen();
+  },
+});
@@ -0,0 +1,25 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice('adddev', {
+  cells: {},
+});
+
+global.__proto__.defineBadDevice = function defineBadDevice() {
+  var descr = {
+    titel: 'Bad device',
+    cells: {
+      a: { type: 'value' },
+      b: { type: 'switch', value: false, readOnly: true, forceDefault: 1 },
+    },
+  };
+  try {
+    defineVirtualDevice('baddev', descr);
+  } catch (e) {
+    log('caught: {}', e.message);
+  }
+};
+
+global.__proto__.addBadControl = function addBadControl() {
+  getDevice('adddev').addControl('y', { type: 1, valeu: 1 });
+  log('has y: {}', getDevice('adddev').isControlExists('y'));
+};
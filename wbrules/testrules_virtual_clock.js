@@ -0,0 +1,25 @@
+// -*- mode: js2-mode -*-
+
+var ticks = 0, quarters = 0;
+
+setInterval(function () {
+  ticks++;
+}, 30 * 60 * 1000);
+
+startTicker("quarter", 15 * 60 * 1000);
+
+defineRule("quarters", {
+  when: function () {
+    return timers.quarter.firing;
+  },
+  then: function () {
+    quarters++;
+  }
+});
+
+defineRule("hourly", {
+  when: cron("@hourly"),
+  then: function () {
+    log("hourly: ticks={} quarters={}", ticks, quarters);
+  }
+});
@@ -0,0 +1,27 @@
+// -*- mode: js2-mode -*-
+
+defineVirtualDevice('wdtest', {
+  cells: {
+    loop: {
+      type: 'pushbutton',
+    },
+    quick: {
+      type: 'pushbutton',
+    },
+  },
+});
+
+defineRule('busyLoop', {
+  whenChanged: 'wdtest/loop',
+  then: function () {
+    log('busy loop started');
+    while (true) {}
+  },
+});
+
+defineRule('quick', {
+  whenChanged: 'wdtest/quick',
+  then: function () {
+    log('quick rule fired');
+  },
+});
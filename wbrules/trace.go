@@ -0,0 +1,109 @@
+package wbrules
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	RULE_TRACE_CAPACITY = 16
+
+	RULE_TRACE_TRIGGER_CONTROL = "control"
+	RULE_TRACE_TRIGGER_TIMER   = "timer"
+	RULE_TRACE_TRIGGER_CRON    = "cron"
+	RULE_TRACE_TRIGGER_RUN     = "run"
+	RULE_TRACE_TRIGGER_REFRESH = "refresh"
+)
+
+// RuleTraceEntry describes a single rule check
+type RuleTraceEntry struct {
+	Timestamp  time.Time    `json:"timestamp"`
+	Trigger    string       `json:"trigger"`
+	Control    string       `json:"control,omitempty"`
+	Value      any          `json:"value,omitempty"`
+	PrevValue  any          `json:"prevValue,omitempty"`
+	Timer      string       `json:"timer,omitempty"`
+	Cron       string       `json:"cron,omitempty"`
+	CondResult bool         `json:"condResult"`
+	Fired      bool         `json:"fired"`
+	DurationUs int64        `json:"durationUs"`
+	Error      *ScriptError `json:"error,omitempty"`
+
+	thenDuration time.Duration
+	syncWait     time.Duration
+	syncQueued   bool
+	rule         *Rule
+}
+
+func newRuleTraceEntry(e *ControlChangeEvent, timerName string) *RuleTraceEntry {
+	entry := &RuleTraceEntry{
+		Timestamp: time.Now(),
+		Trigger:   RULE_TRACE_TRIGGER_REFRESH,
+	}
+	switch {
+	case e != nil:
+		entry.Trigger = RULE_TRACE_TRIGGER_CONTROL
+		entry.Control = e.Spec.String()
+		entry.Value = e.Value
+		entry.PrevValue = e.PrevValue
+	case timerName != NO_TIMER_NAME:
+		entry.Trigger = RULE_TRACE_TRIGGER_TIMER
+		entry.Timer = timerName
+	}
+	return entry
+}
+
+// RuleTraceInfo is a snapshot of the trace of a single rule
+type RuleTraceInfo struct {
+	Id      RuleId           `json:"id"`
+	Name    string           `json:"name,omitempty"`
+	Script  string           `json:"script,omitempty"`
+	Entries []RuleTraceEntry `json:"entries"`
+}
+
+// RuleTrace is a fixed-size ring buffer of rule check results.
+// It's filled from the engine sync loop and may be read
+// concurrently (e.g. by RPC handlers)
+type RuleTrace struct {
+	sync.Mutex
+
+	entries []RuleTraceEntry
+	next    int
+	full    bool
+}
+
+func NewRuleTrace(capacity int) *RuleTrace {
+	return &RuleTrace{
+		entries: make([]RuleTraceEntry, capacity),
+	}
+}
+
+func (t *RuleTrace) Push(entry RuleTraceEntry) {
+	t.Lock()
+	defer t.Unlock()
+
+	if len(t.entries) == 0 {
+		return
+	}
+
+	t.entries[t.next] = entry
+	t.next++
+	if t.next == len(t.entries) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// Entries returns stored entries, oldest first
+func (t *RuleTrace) Entries() []RuleTraceEntry {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.full {
+		return append([]RuleTraceEntry(nil), t.entries[:t.next]...)
+	}
+
+	r := make([]RuleTraceEntry, 0, len(t.entries))
+	r = append(r, t.entries[t.next:]...)
+	return append(r, t.entries[:t.next]...)
+}
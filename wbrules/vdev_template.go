@@ -0,0 +1,219 @@
+package wbrules
+
+import (
+	"fmt"
+
+	"github.com/stretchr/objx"
+	duktape "github.com/wirenboard/go-duktape"
+)
+
+// VirtualDeviceTemplate is a virtual device description
+// shared by several virtual devices (instances)
+type VirtualDeviceTemplate struct {
+	Name  string
+	Descr objx.Map
+}
+
+func NewVirtualDeviceTemplate(name string, descr objx.Map) *VirtualDeviceTemplate {
+	return &VirtualDeviceTemplate{name, copyDescriptor(descr).(objx.Map)}
+}
+
+// copyDescriptor makes a deep copy of the descriptor,
+// all the nested objects are converted to objx.Map
+func copyDescriptor(value any) any {
+	switch t := value.(type) {
+	case objx.Map:
+		return copyDescriptorMap(t)
+	case map[string]any:
+		return copyDescriptorMap(t)
+	case []any:
+		r := make([]any, len(t))
+		for i, item := range t {
+			r[i] = copyDescriptor(item)
+		}
+		return r
+	}
+	return value
+}
+
+func copyDescriptorMap(m map[string]any) objx.Map {
+	r := make(objx.Map, len(m))
+	for k, v := range m {
+		r[k] = copyDescriptor(v)
+	}
+	return r
+}
+
+// Instance returns the description of the device made from the template.
+// Overrides replace the properties of the template. The controls are
+// merged property by property, null value removes the control or
+// the property of the control
+func (tmpl *VirtualDeviceTemplate) Instance(overrides objx.Map) objx.Map {
+	descr := copyDescriptor(tmpl.Descr).(objx.Map)
+	controls, _, _ := deviceControls(descr)
+	for key, value := range overrides {
+		isControls := key == VDEV_DESCR_PROP_CELLS || key == VDEV_DESCR_PROP_CONTROLS
+		ctrlOverrides, isMap := descriptorMap(value)
+		switch {
+		case value == nil:
+			delete(descr, key)
+		case isControls && isMap && controls != nil:
+			mergeControls(controls, ctrlOverrides)
+		default:
+			descr[key] = copyDescriptor(value)
+		}
+	}
+	return descr
+}
+
+func mergeControls(controls, overrides objx.Map) {
+	for ctrlId, value := range overrides {
+		ctrlOverrides, isMap := descriptorMap(value)
+		ctrlDef, hasDef := controls[ctrlId].(objx.Map)
+		switch {
+		case value == nil:
+			delete(controls, ctrlId)
+		case isMap && hasDef:
+			for prop, propValue := range ctrlOverrides {
+				if propValue == nil {
+					delete(ctrlDef, prop)
+				} else {
+					ctrlDef[prop] = copyDescriptor(propValue)
+				}
+			}
+		default:
+			controls[ctrlId] = copyDescriptor(value)
+		}
+	}
+}
+
+// Defines a virtual device template.
+// Used in 'defineVirtualDeviceTemplate(name, descr)'
+func (engine *ESEngine) esDefineVdevTemplate(ctx *ESContext) int {
+	// arguments: (name string, descr object)
+	if ctx.GetTop() != 2 || !ctx.IsString(0) || !ctx.IsObject(1) {
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+	name := ctx.GetString(0)
+	descr := ctx.GetJSObject(1).(objx.Map)
+
+	if _, found := engine.vdevTemplates[name]; found {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("virtual device template %s is already defined", name))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	if err := engine.reportDescriptorProblems(ctx, validateTemplateDescriptor(name, descr)); err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR, err.Error())
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+
+	currentFilename := ctx.GetCurrentFilename()
+	if currentFilename != "" {
+		engine.cleanup.PushCleanupScope(currentFilename)
+		defer engine.cleanup.PopCleanupScope(currentFilename)
+	}
+
+	engine.vdevTemplates[name] = NewVirtualDeviceTemplate(name, descr)
+	engine.cleanup.AddCleanup(func() {
+		delete(engine.vdevTemplates, name)
+	})
+	return 0
+}
+
+// Creates a virtual device from the template and calls the function
+// which defines the rules of the instance. The device and the rules are
+// removed together by the remove() method of the instance or when the
+// script is unloaded. Used in 'instantiate(template, id, overrides)'
+func (engine *ESEngine) esInstantiateVdev(ctx *ESContext) int {
+	// arguments: (template string, id string, overrides object, fn function)
+	if ctx.GetTop() != 4 || !ctx.IsString(0) || !ctx.IsString(1) || !ctx.IsObject(2) || !ctx.IsFunction(3) {
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+	name, devId := ctx.GetString(0), ctx.GetString(1)
+	overrides := ctx.GetJSObject(2).(objx.Map)
+
+	tmpl := engine.vdevTemplates[name]
+	if tmpl == nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("virtual device template %s is not defined", name))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	if _, found := engine.vdevInstances[devId]; found {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("virtual device instance %s already exists", devId))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	descr := tmpl.Instance(overrides)
+	if _, prop, _ := deviceControls(descr); prop == "" {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("virtual device instance %s has no controls", devId))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	if err := engine.reportDescriptorProblems(ctx, validateDeviceDescriptor(devId, descr)); err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR, err.Error())
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+
+	// the instance has its own cleanup scope, so it can be removed
+	// separately from the other items of the script
+	engine.nextInstanceScope++
+	scope := fmt.Sprintf("instance %s #%d", devId, engine.nextInstanceScope)
+	if currentFilename := ctx.GetCurrentFilename(); currentFilename != "" {
+		engine.cleanup.AddChildScope(currentFilename, scope)
+	}
+
+	engine.cleanup.PushCleanupScope(scope)
+	engine.vdevInstances[devId] = scope
+	engine.cleanup.AddCleanup(func() {
+		delete(engine.vdevInstances, devId)
+	})
+	err := engine.DefineVirtualDevice(devId, descr)
+	r := 0
+	if err == nil {
+		// [ args | fn ] -> [ args | result ]
+		r = ctx.Pcall(0)
+	}
+	engine.cleanup.PopCleanupScope(scope)
+
+	if err != nil || r != 0 {
+		engine.cleanup.RunCleanups(scope)
+	}
+	if err != nil {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR, err.Error())
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	if r != 0 {
+		// rethrow the error
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.registerSourceItem(ctx, SOURCE_ITEM_DEVICE, devId)
+	engine.sourcesMtx.Lock()
+	source := engine.sources[ctx.GetCurrentFilename()]
+	engine.sourcesMtx.Unlock()
+	if source != nil {
+		// the device is removed from the file entry along with the instance
+		engine.cleanup.PushCleanupScope(scope)
+		engine.cleanup.AddCleanup(func() {
+			engine.unregisterSourceItem(source, SOURCE_ITEM_DEVICE, devId)
+		})
+		engine.cleanup.PopCleanupScope(scope)
+	}
+	return 0
+}
+
+// Removes the virtual device created from the template
+// along with its rules. Used in 'instance.remove()'
+func (engine *ESEngine) esRemoveVdevInstance(ctx *ESContext) int {
+	if ctx.GetTop() != 1 || !ctx.IsString(0) {
+		return duktape.DUK_RET_TYPE_ERROR
+	}
+	devId := ctx.GetString(0)
+	scope, found := engine.vdevInstances[devId]
+	if !found {
+		ctx.PushErrorObject(duktape.DUK_ERR_ERROR,
+			fmt.Sprintf("virtual device instance %s doesn't exist", devId))
+		return duktape.DUK_RET_INSTACK_ERROR
+	}
+	engine.cleanup.RunCleanups(scope)
+	return 0
+}
@@ -0,0 +1,148 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/stretchr/objx"
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type VdevTemplateSuite struct {
+	RuleSuiteBase
+}
+
+func (s *VdevTemplateSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_vdev_template.js")
+}
+
+func (s *VdevTemplateSuite) hasRule(name string) bool {
+	s.engine.rulesMutex.Lock()
+	defer s.engine.rulesMutex.Unlock()
+	for _, rule := range s.engine.ruleMap {
+		if rule.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceDevices counts the devices of the script entries by names
+func (s *VdevTemplateSuite) sourceDevices() map[string]int {
+	s.engine.sourcesMtx.Lock()
+	defer s.engine.sourcesMtx.Unlock()
+	devices := make(map[string]int)
+	for _, entry := range s.engine.sources {
+		for _, item := range entry.Devices {
+			devices[item.Name]++
+		}
+	}
+	return devices
+}
+
+func (s *VdevTemplateSuite) TestInstantiate() {
+	s.engine.EvalScript("createKitchen()")
+	s.SkipTill("[info] kitchen created, has heater: false")
+	s.True(s.hasRule("kitchen_thermostat"))
+
+	s.engine.EvalScript(`dev["kitchen/temp"] = 17`)
+	s.SkipTill("[info] kitchen: temp 17")
+
+	s.engine.EvalScript("testBadInstances()")
+	s.SkipTill("[info] caught: virtual device instance kitchen already exists")
+	s.Verify(
+		"[info] caught: virtual device template nosuchtemplate is not defined",
+		"[info] caught: virtual device template room is already defined",
+	)
+
+	s.engine.EvalScript("removeKitchen()")
+	s.SkipTill("[info] kitchen removed: true")
+	s.False(s.hasRule("kitchen_thermostat"))
+	s.Zero(s.sourceDevices()["kitchen"])
+
+	// the instance and its rules can be created again,
+	// the rule creates the instance within the script
+	s.publish("/devices/templateTest/controls/create/on", "1", "templateTest/create")
+	s.SkipTill("[info] kitchen created, has heater: false")
+	s.True(s.hasRule("kitchen_thermostat"))
+	s.Equal(1, s.sourceDevices()["kitchen"])
+
+	s.engine.EvalScript("removeKitchen()")
+	s.SkipTill("[info] kitchen removed: true")
+	s.Zero(s.sourceDevices()["kitchen"])
+}
+
+func TestVdevTemplateSuite(t *testing.T) {
+	testutils.RunSuites(t, new(VdevTemplateSuite))
+}
+
+func TestVirtualDeviceTemplateInstance(t *testing.T) {
+	tmpl := NewVirtualDeviceTemplate("room", objx.Map{
+		"title": "Room",
+		"cells": map[string]any{
+			"temp":   map[string]any{"type": "value", "value": 20.0, "units": "deg C"},
+			"heater": map[string]any{"type": "switch", "value": false},
+		},
+	})
+
+	descr := tmpl.Instance(objx.Map{
+		"title": "Kitchen",
+		"cells": map[string]any{
+			"temp":   map[string]any{"value": 22.0, "units": nil},
+			"heater": nil,
+			"light":  map[string]any{"type": "switch", "value": true},
+		},
+	})
+	require.Equal(t, objx.Map{
+		"title": "Kitchen",
+		"cells": objx.Map{
+			"temp":  objx.Map{"type": "value", "value": 22.0},
+			"light": objx.Map{"type": "switch", "value": true},
+		},
+	}, descr)
+
+	// the template isn't changed by the instances
+	require.Equal(t, objx.Map{
+		"title": "Room",
+		"cells": objx.Map{
+			"temp":   objx.Map{"type": "value", "value": 20.0, "units": "deg C"},
+			"heater": objx.Map{"type": "switch", "value": false},
+		},
+	}, tmpl.Instance(nil))
+}
+
+func TestChildCleanupScope(t *testing.T) {
+	sc := MakeScopedCleanup()
+	var cleaned []string
+	addCleanup := func(name string) {
+		sc.AddCleanup(func() { cleaned = append(cleaned, name) })
+	}
+
+	sc.AddChildScope("script", "instance")
+	sc.PushCleanupScope("instance")
+	// the child scope stays current when the parent scope is pushed
+	require.Equal(t, "instance", sc.PushCleanupScope("script"))
+	addCleanup("rule")
+	require.Equal(t, "instance", sc.PopCleanupScope("script"))
+	sc.PopCleanupScope("instance")
+
+	sc.PushCleanupScope("script")
+	addCleanup("device")
+	sc.PopCleanupScope("script")
+
+	sc.RunCleanups("instance")
+	require.Equal(t, []string{"rule"}, cleaned)
+
+	sc.AddChildScope("script", "instance2")
+	sc.PushCleanupScope("instance2")
+	addCleanup("rule2")
+	sc.PopCleanupScope("instance2")
+
+	// the removed child scope is dropped from the parent scope
+	require.Len(t, sc.cleanupLists["script"], 2)
+
+	sc.RunCleanups("script")
+	require.Equal(t, []string{"rule", "device", "rule2"}, cleaned)
+	require.Empty(t, sc.cleanupLists)
+	require.Empty(t, sc.parents)
+}
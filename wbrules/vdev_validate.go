@@ -0,0 +1,340 @@
+package wbrules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/stretchr/objx"
+)
+
+// the maximum edit distance of a property name
+// suggested instead of an unknown one
+const DESCR_SUGGEST_MAX_DISTANCE = 2
+
+var (
+	knownDeviceProps = []string{
+		VDEV_DESCR_PROP_TITLE,
+		VDEV_DESCR_PROP_CELLS,
+		VDEV_DESCR_PROP_CONTROLS,
+	}
+
+	knownControlProps = []string{
+		VDEV_CONTROL_DESCR_PROP_TYPE,
+		VDEV_CONTROL_DESCR_PROP_FORCEDEFAULT,
+		VDEV_CONTROL_DESCR_PROP_LAZYINIT,
+		VDEV_CONTROL_DESCR_PROP_VALUE,
+		VDEV_CONTROL_DESCR_PROP_READONLY,
+		VDEV_CONTROL_DESCR_PROP_WRITEABLE,
+		VDEV_CONTROL_DESCR_PROP_DESCRIPTION,
+		VDEV_CONTROL_DESCR_PROP_TITLE,
+		VDEV_CONTROL_DESCR_PROP_ORDER,
+		VDEV_CONTROL_DESCR_PROP_UNITS,
+		VDEV_CONTROL_DESCR_PROP_ENUM,
+		VDEV_CONTROL_DESCR_PROP_MAX,
+		VDEV_CONTROL_DESCR_PROP_MIN,
+		VDEV_CONTROL_DESCR_PROP_PRECISION,
+		VDEV_CONTROL_DESCR_PROP_HISTORY,
+	}
+)
+
+// DescriptorError lists all problems of a virtual device or control
+// descriptor. Location is the place in the script where the device
+// is defined, it's empty for the devices defined from Go
+type DescriptorError struct {
+	Location string
+	Problems []string
+}
+
+func (err *DescriptorError) Error() string {
+	msg := strings.Join(err.Problems, "; ")
+	if err.Location != "" {
+		return err.Location + ": " + msg
+	}
+	return msg
+}
+
+// descriptorValidation collects the problems found in a descriptor.
+// Errors prevent the device from being created, warnings are
+// only reported
+type descriptorValidation struct {
+	errors   []string
+	warnings []string
+}
+
+func (v *descriptorValidation) errorf(format string, args ...any) {
+	v.errors = append(v.errors, fmt.Sprintf(format, args...))
+}
+
+func (v *descriptorValidation) warnf(format string, args ...any) {
+	v.warnings = append(v.warnings, fmt.Sprintf(format, args...))
+}
+
+// err returns DescriptorError with all the errors or nil
+// if the descriptor is valid
+func (v *descriptorValidation) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &DescriptorError{Problems: v.errors}
+}
+
+func descriptorMap(value any) (objx.Map, bool) {
+	switch t := value.(type) {
+	case objx.Map:
+		return t, true
+	case map[string]any:
+		return objx.Map(t), true
+	}
+	return nil, false
+}
+
+// deviceControls returns the controls of the device descriptor and
+// the name of the property they're taken from. 'cells' take precedence
+// over 'controls'. The property is empty if the device has no controls
+func deviceControls(obj objx.Map) (objx.Map, string, bool) {
+	prop := ""
+	switch {
+	case obj.Has(VDEV_DESCR_PROP_CELLS):
+		prop = VDEV_DESCR_PROP_CELLS
+	case obj.Has(VDEV_DESCR_PROP_CONTROLS):
+		prop = VDEV_DESCR_PROP_CONTROLS
+	default:
+		return nil, "", true
+	}
+	m, ok := descriptorMap(obj[prop])
+	return m, prop, ok
+}
+
+// sortedProps returns the property names of the descriptor in
+// alphabetical order, so the problems are reported in stable order
+func sortedProps(m objx.Map) []string {
+	props := make([]string, 0, len(m))
+	for prop := range m {
+		props = append(props, prop)
+	}
+	sort.Strings(props)
+	return props
+}
+
+// validateDeviceDescriptor checks the descriptor passed
+// to defineVirtualDevice() including all its controls
+func validateDeviceDescriptor(devId string, obj objx.Map) *descriptorValidation {
+	return validateDescriptor(devId, obj, true)
+}
+
+// validateTemplateDescriptor checks the descriptor passed to
+// defineVirtualDeviceTemplate(). The template may have no controls,
+// as they may be added by the instances
+func validateTemplateDescriptor(name string, obj objx.Map) *descriptorValidation {
+	return validateDescriptor(name, obj, false)
+}
+
+func validateDescriptor(devId string, obj objx.Map, controlsRequired bool) *descriptorValidation {
+	v := &descriptorValidation{}
+	for _, prop := range sortedProps(obj) {
+		checkKnownProp(v, devId, prop, knownDeviceProps)
+	}
+
+	if title, ok := obj[VDEV_DESCR_PROP_TITLE]; ok {
+		if _, isString := title.(string); !isString {
+			if _, isMap := descriptorMap(title); !isMap {
+				v.errorf("%s: non-string/non-map value type %T of title property", devId, title)
+			}
+		}
+	}
+
+	if obj.Has(VDEV_DESCR_PROP_CELLS) && obj.Has(VDEV_DESCR_PROP_CONTROLS) {
+		v.warnf("%s: both 'cells' and 'controls' are specified, 'controls' are ignored", devId)
+	}
+	controls, prop, ok := deviceControls(obj)
+	if !ok || prop == "" && controlsRequired {
+		v.errorf("device %s doesn't have proper 'controls' or 'cells' property", devId)
+		return v
+	}
+	if prop == "" {
+		return v
+	}
+	for _, ctrlId := range sortedProps(controls) {
+		ctrlDef, ok := descriptorMap(controls[ctrlId])
+		if !ok {
+			v.errorf("%s/%s: bad control definition", devId, ctrlId)
+			continue
+		}
+		validateControlDescriptor(v, devId, ctrlId, ctrlDef)
+	}
+	return v
+}
+
+// validateControlDescriptor checks the control descriptor passed
+// to defineVirtualDevice() or addControl()
+func validateControlDescriptor(v *descriptorValidation, devId, ctrlId string, ctrlDef objx.Map) {
+	name := devId + "/" + ctrlId
+	for _, prop := range sortedProps(ctrlDef) {
+		checkKnownProp(v, name, prop, knownControlProps)
+	}
+
+	ctrlType := ""
+	if typeRaw, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_TYPE]; !ok {
+		v.errorf("%s: no control type", name)
+	} else if ctrlType, ok = typeRaw.(string); !ok {
+		v.errorf("%s: non-string control type", name)
+	}
+
+	for _, prop := range []string{
+		VDEV_CONTROL_DESCR_PROP_FORCEDEFAULT,
+		VDEV_CONTROL_DESCR_PROP_LAZYINIT,
+		VDEV_CONTROL_DESCR_PROP_READONLY,
+	} {
+		if value, ok := ctrlDef[prop]; ok {
+			if _, isBool := value.(bool); !isBool {
+				v.errorf("%s: non-boolean value of '%s' property", name, prop)
+			}
+		}
+	}
+
+	if _, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_VALUE]; !ok && ctrlType != "" && ctrlType != "pushbutton" {
+		v.errorf("%s: control value required for control type %s", name, ctrlType)
+	}
+
+	if order, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_ORDER]; ok {
+		if n, isNumber := order.(float64); !isNumber {
+			v.errorf("%s: non-number value of order property, has %T", name, order)
+		} else if n < 0 {
+			v.errorf("%s: invalid order value, must be int >= 0", name)
+		}
+	}
+
+	if _, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_WRITEABLE]; ok {
+		v.errorf("%s: writeable flag is deprecated, use readonly instead: "+
+			"https://github.com/wirenboard/wb-rules/blob/master/README-readonly.md", name)
+	}
+
+	for _, prop := range []string{
+		VDEV_CONTROL_DESCR_PROP_UNITS,
+		VDEV_CONTROL_DESCR_PROP_DESCRIPTION,
+	} {
+		if value, ok := ctrlDef[prop]; ok {
+			if _, isString := value.(string); !isString {
+				v.errorf("%s: non-string value of %s property", name, prop)
+			}
+		}
+	}
+
+	for _, prop := range []string{
+		VDEV_CONTROL_DESCR_PROP_PRECISION,
+		VDEV_CONTROL_DESCR_PROP_MAX,
+		VDEV_CONTROL_DESCR_PROP_MIN,
+	} {
+		if value, ok := ctrlDef[prop]; ok {
+			if _, isNumber := value.(float64); !isNumber {
+				v.errorf("%s: non-numeric value of %s property", name, prop)
+			}
+		}
+	}
+
+	if enum, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_ENUM]; ok {
+		if _, isMap := descriptorMap(enum); !isMap {
+			v.errorf("%s: non-map value type %T of enum property", name, enum)
+		}
+	}
+
+	if title, ok := ctrlDef[VDEV_CONTROL_DESCR_PROP_TITLE]; ok {
+		if _, isString := title.(string); !isString {
+			if _, isMap := descriptorMap(title); !isMap {
+				v.errorf("%s: non-string/non-map value type %T of title property", name, title)
+			}
+		}
+	}
+
+	if ctrlType != "" {
+		if _, err := parseHistorySpec(devId, ctrlId, ctrlDef); err != nil {
+			v.errorf("%s", err)
+		}
+	}
+}
+
+// checkKnownProp warns about the property that isn't in the known list
+// and suggests the closest known one, as it's likely a typo
+func checkKnownProp(v *descriptorValidation, name, prop string, known []string) {
+	for _, k := range known {
+		if k == prop {
+			return
+		}
+	}
+	if suggestion := suggestProp(prop, known); suggestion != "" {
+		v.warnf("%s: unknown property '%s', did you mean '%s'?", name, prop, suggestion)
+	} else {
+		v.warnf("%s: unknown property '%s'", name, prop)
+	}
+}
+
+// suggestProp returns the known property which differs from the given
+// one in letter case only or is the closest one by edit distance.
+// Empty string is returned if there's no close enough property
+func suggestProp(prop string, known []string) string {
+	best, bestDistance := "", DESCR_SUGGEST_MAX_DISTANCE+1
+	for _, k := range known {
+		if strings.EqualFold(k, prop) {
+			return k
+		}
+		// short names are too easy to match
+		if d := editDistance(strings.ToLower(prop), strings.ToLower(k)); d < bestDistance && d < len(k)/2+1 {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of the strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// reportDescriptorProblems logs the warnings of the descriptor validation
+// with the location in the script and returns the error with all the
+// problems, if any. Must be called from the sync loop
+func (engine *ESEngine) reportDescriptorProblems(ctx *ESContext, v *descriptorValidation) error {
+	if len(v.errors) == 0 && len(v.warnings) == 0 {
+		return nil
+	}
+	record := engine.scriptLogRecord(ENGINE_LOG_WARNING, "", ctx.GetTraceback())
+	location := ""
+	if record.Script != "" {
+		location = fmt.Sprintf("%s:%d", record.Script, record.Line)
+	}
+	for _, warning := range v.warnings {
+		record.Message = warning
+		if location != "" {
+			record.Message = location + ": " + warning
+		}
+		engine.WriteLog(record)
+	}
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &DescriptorError{Location: location, Problems: v.errors}
+}
@@ -0,0 +1,122 @@
+package wbrules
+
+import (
+	"testing"
+
+	"github.com/stretchr/objx"
+	"github.com/stretchr/testify/require"
+	"github.com/wirenboard/wbgong/testutils"
+)
+
+type VdevValidateSuite struct {
+	RuleSuiteBase
+}
+
+func (s *VdevValidateSuite) SetupTest() {
+	s.SetupSkippingDefs("testrules_vdev_validate.js")
+}
+
+func (s *VdevValidateSuite) TestDefineVirtualDevice() {
+	s.engine.EvalScript("defineBadDevice()")
+	s.Verify(
+		"[warning] testrules_vdev_validate.js:16: baddev: unknown property 'titel', did you mean 'title'?",
+		"[warning] testrules_vdev_validate.js:16: baddev/b: unknown property 'readOnly', did you mean 'readonly'?",
+		"[info] caught: testrules_vdev_validate.js:16: baddev/a: control value required for control type value; "+
+			"baddev/b: non-boolean value of 'forceDefault' property",
+	)
+	s.EnsureGotWarnings()
+	s.EnsureGotErrors()
+}
+
+func (s *VdevValidateSuite) TestAddControl() {
+	s.engine.EvalScript("addBadControl()")
+	s.Verify(
+		"[warning] testrules_vdev_validate.js:23: adddev/y: unknown property 'valeu', did you mean 'value'?",
+		"[error] testrules_vdev_validate.js:23: adddev/y: non-string control type",
+		"[info] has y: false",
+	)
+	s.EnsureGotWarnings()
+	s.EnsureGotErrors()
+}
+
+func TestVdevValidateSuite(t *testing.T) {
+	testutils.RunSuites(t, new(VdevValidateSuite))
+}
+
+func TestValidateDeviceDescriptor(t *testing.T) {
+	v := validateDeviceDescriptor("dev", objx.Map{
+		"title": "Device",
+		"cells": map[string]any{
+			"temp": map[string]any{"type": "value", "value": 0.0, "units": "deg C", "order": 1.0},
+			"sw":   objx.Map{"type": "switch", "value": false, "readonly": true},
+			"btn":  objx.Map{"type": "pushbutton"},
+		},
+	})
+	require.Empty(t, v.errors)
+	require.Empty(t, v.warnings)
+	require.NoError(t, v.err())
+
+	v = validateDeviceDescriptor("dev", objx.Map{
+		"title":    42.0,
+		"controls": objx.Map{"a": "text"},
+		"Cells":    objx.Map{},
+	})
+	require.Equal(t, []string{"dev: unknown property 'Cells', did you mean 'cells'?"}, v.warnings)
+	require.EqualError(t, v.err(), "dev: non-string/non-map value type float64 of title property; "+
+		"dev/a: bad control definition")
+
+	v = validateDeviceDescriptor("dev", objx.Map{"cells": "none"})
+	require.EqualError(t, v.err(), "device dev doesn't have proper 'controls' or 'cells' property")
+
+	v = validateDeviceDescriptor("dev", objx.Map{"title": "dev"})
+	require.EqualError(t, v.err(), "device dev doesn't have proper 'controls' or 'cells' property")
+
+	// the controls of the template may be added by the instances
+	v = validateTemplateDescriptor("tmpl", objx.Map{"title": "tmpl"})
+	require.NoError(t, v.err())
+}
+
+func TestValidateControlDescriptor(t *testing.T) {
+	v := &descriptorValidation{}
+	validateControlDescriptor(v, "dev", "ctrl", objx.Map{
+		"type":       "range",
+		"value":      0.0,
+		"max":        "100",
+		"order":      -1.0,
+		"lazyinit":   true,
+		"writeable":  true,
+		"minimum":    0.0,
+		"desciption": "typo",
+	})
+	require.Equal(t, []string{
+		"dev/ctrl: unknown property 'desciption', did you mean 'description'?",
+		"dev/ctrl: unknown property 'lazyinit', did you mean 'lazyInit'?",
+		"dev/ctrl: unknown property 'minimum'",
+	}, v.warnings)
+	require.Equal(t, []string{
+		"dev/ctrl: invalid order value, must be int >= 0",
+		"dev/ctrl: writeable flag is deprecated, use readonly instead: " +
+			"https://github.com/wirenboard/wb-rules/blob/master/README-readonly.md",
+		"dev/ctrl: non-numeric value of max property",
+	}, v.errors)
+
+	v = &descriptorValidation{}
+	validateControlDescriptor(v, "dev", "ctrl", objx.Map{"value": 1.0})
+	require.Equal(t, []string{"dev/ctrl: no control type"}, v.errors)
+}
+
+func TestSuggestProp(t *testing.T) {
+	for _, tc := range []struct {
+		prop, suggestion string
+	}{
+		{"readOnly", "readonly"},
+		{"tpye", "type"},
+		{"vlaue", "value"},
+		{"unit", "units"},
+		{"forcedefault", "forceDefault"},
+		{"id", ""},
+		{"something", ""},
+	} {
+		require.Equal(t, tc.suggestion, suggestProp(tc.prop, knownControlProps), tc.prop)
+	}
+}
@@ -0,0 +1,67 @@
+package wbrules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// callbackWatchdog reports the callback that has exceeded the execution
+// time budget and disables its rule after repeated violations if
+// configured to. It's called from the sync loop after the callback returns
+func (engine *ESEngine) callbackWatchdog(ctx *ESContext, elapsed time.Duration, traceback ESTraceback) {
+	engine.callbackTimeouts.Inc()
+
+	var rule *Rule
+	if engine.activeTrace != nil {
+		rule = engine.activeTrace.rule
+	}
+
+	var where string
+	if rule != nil {
+		where = fmt.Sprintf("rule '%s' (%s)", ruleMetricLabel(rule), rule.script)
+	} else {
+		where = engine.callbackScript(ctx)
+	}
+
+	scriptErr := engine.newScriptError(ESError{
+		Message:   fmt.Sprintf("execution time limit of %s exceeded (%s)", engine.callbackBudget, elapsed.Round(time.Millisecond)),
+		Traceback: traceback,
+	})
+	engine.TraceError(scriptErr)
+
+	msg := fmt.Sprintf("callback of %s: %s", where, scriptErr.Message)
+	if len(scriptErr.Traceback) > 0 {
+		locs := make([]string, len(scriptErr.Traceback))
+		for i, loc := range scriptErr.Traceback {
+			locs[i] = fmt.Sprintf("%s:%d", loc.Name, loc.Line)
+		}
+		msg += ", interrupted at " + strings.Join(locs, " <- ")
+	}
+	engine.Logf(ENGINE_LOG_ERROR, "%s", msg)
+
+	if rule == nil || engine.callbackViolations <= 0 || !rule.enabled {
+		return
+	}
+	rule.watchdogViolations++
+	if rule.watchdogViolations < engine.callbackViolations {
+		return
+	}
+	rule.watchdogViolations = 0
+	engine.SetRuleState(rule, false)
+	engine.Logf(ENGINE_LOG_ERROR, "rule '%s' is disabled after %d execution time limit violations",
+		ruleMetricLabel(rule), engine.callbackViolations)
+}
+
+// callbackScript returns the virtual path of the script
+// the callback context belongs to
+func (engine *ESEngine) callbackScript(ctx *ESContext) string {
+	path := ctx.GetCurrentFilename()
+	if path == "" {
+		return "global context"
+	}
+	if _, virtualPath, underSourceRoot, _, err := engine.checkSourcePath(path); err == nil && underSourceRoot {
+		return virtualPath
+	}
+	return path
+}